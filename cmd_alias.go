@@ -0,0 +1,145 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"ferri/models"
+	"ferri/output"
+	"ferri/processors"
+	"ferri/utils"
+)
+
+// aliasUsage lists the alias subcommands
+const aliasUsage = "usage: ferri alias add <program> <domain>... | rm <domain>... | list"
+
+// runAlias dispatches the alias subcommands
+func runAlias(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf(aliasUsage)
+	}
+	switch args[0] {
+	case "add":
+		return runAliasAdd(args[1:])
+	case "rm":
+		return runAliasRemove(args[1:])
+	case "list":
+		return runAliasList(args[1:])
+	}
+	return fmt.Errorf("unknown alias subcommand %q; %s", args[0], aliasUsage)
+}
+
+// aliasRoot reduces a domain to the root domain aliases are keyed by, so
+// "cloud.acme.io" aliases every host under acme.io
+func aliasRoot(domain string) (string, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	root := processors.RegistrableDomain(domain)
+	if root == "" {
+		return "", fmt.Errorf("%q has no registrable domain to alias", domain)
+	}
+	if root != domain {
+		utils.Statusf("💡 Aliasing the root domain %s of %s\n", root, domain)
+	}
+	return root, nil
+}
+
+// runAliasAdd maps root domains to an existing program
+func runAliasAdd(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: ferri alias add <program> <domain>...")
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repo := models.NewProgramRepository(db)
+	program, err := lookupProgram(db, args[0])
+	if err != nil {
+		return err
+	}
+
+	for _, domain := range args[1:] {
+		root, err := aliasRoot(domain)
+		if err != nil {
+			return err
+		}
+		if err := repo.AddAlias(program.ID, root); err != nil {
+			return fmt.Errorf("failed to add alias %s: %v", root, err)
+		}
+		utils.Statusf("🔗 %s now belongs to %s\n", root, program.Name)
+	}
+	return nil
+}
+
+// runAliasRemove deletes aliases
+func runAliasRemove(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: ferri alias rm <domain>...")
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repo := models.NewProgramRepository(db)
+	for _, domain := range args {
+		root, err := aliasRoot(domain)
+		if err != nil {
+			return err
+		}
+		if err := repo.RemoveAlias(root); err == sql.ErrNoRows {
+			return fmt.Errorf("no alias for %s", root)
+		} else if err != nil {
+			return fmt.Errorf("failed to remove alias %s: %v", root, err)
+		}
+		utils.Statusf("🗑️  Removed alias %s\n", root)
+	}
+	return nil
+}
+
+// aliasRow is how ferri alias list prints an alias
+type aliasRow struct {
+	Domain  string `json:"domain"`
+	Program string `json:"program"`
+}
+
+// runAliasList prints every alias
+func runAliasList(args []string) error {
+	fs := flag.NewFlagSet("alias list", flag.ContinueOnError)
+	format := output.FormatFlag(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("usage: ferri alias list [--format f]")
+	}
+	out, err := output.New(*format, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	aliases, err := models.NewProgramRepository(db).ListAliases()
+	if err != nil {
+		return fmt.Errorf("failed to list aliases: %v", err)
+	}
+	rows := make([]aliasRow, len(aliases))
+	for i, a := range aliases {
+		rows[i] = aliasRow{Domain: a.Domain, Program: a.ProgramName}
+	}
+	return out.Write(rows)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"ferri/processors"
+	"ferri/utils"
+)
+
+// runExport writes a program and everything recorded on it as a JSON bundle
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	programName := fs.String("program", "", "program to export")
+	outPath := fs.String("o", "", "write the bundle to this file instead of stdout")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 || *programName == "" {
+		return fmt.Errorf("usage: ferri export --program <name> [-o bundle.json]")
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	program, err := lookupProgram(db, *programName)
+	if err != nil {
+		return err
+	}
+	bundle, err := processors.ExportProgram(db, program.ID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			return fmt.Errorf("failed to create bundle: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := json.NewEncoder(out).Encode(bundle); err != nil {
+		return fmt.Errorf("failed to write bundle: %v", err)
+	}
+
+	recon, findings := 0, 0
+	for _, t := range bundle.Targets {
+		recon += len(t.ReconData)
+		findings += len(t.Findings)
+	}
+	utils.Statusf("📦 Exported %s: %d targets, %d recon rows, %d findings\n",
+		program.Name, len(bundle.Targets), recon, findings)
+	return nil
+}
+
+// runImport recreates the contents of a bundle written by ferri export
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: ferri import <bundle.json>")
+	}
+
+	var in io.Reader = os.Stdin
+	if positional[0] != "-" {
+		f, err := os.Open(positional[0])
+		if err != nil {
+			return fmt.Errorf("failed to open bundle: %v", err)
+		}
+		defer f.Close()
+		in = f
+	}
+	r, err := utils.MaybeGzipReader(in)
+	if err != nil {
+		return fmt.Errorf("failed to read bundle: %v", err)
+	}
+	bundle := &processors.Bundle{}
+	if err := json.NewDecoder(r).Decode(bundle); err != nil {
+		return fmt.Errorf("failed to parse bundle: %v", err)
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := processors.ImportBundle(db, bundle)
+	if err != nil {
+		return err
+	}
+	utils.Statusf("📥 Imported %s: %d new targets (%d existing), %d recon rows (%d already present), %d findings (%d existing)\n",
+		bundle.Program.Name, result.Targets, result.ExistingTargets, result.ReconRows, result.SkippedRecon,
+		result.Findings, result.ExistingFindings)
+	return nil
+}
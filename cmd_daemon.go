@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"ferri/config"
+	"ferri/daemon"
+	"ferri/database"
+	"ferri/notify"
+	"ferri/utils"
+)
+
+// runDaemon owns the database and ingests what other ferri processes send
+// it over a Unix socket, one input at a time
+func runDaemon(args []string) error {
+	fs := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	socketPath := fs.String("socket", "", "socket to listen on (default: next to the database)")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("usage: ferri daemon [--socket path]")
+	}
+
+	dbPath, err := resolveDBPath()
+	if err != nil {
+		return err
+	}
+	dbPath = utils.ExpandPath(dbPath)
+	socket := *socketPath
+	if socket == "" {
+		if socket = database.SocketPath(dbPath); socket == "" {
+			return fmt.Errorf("an in-memory database has no default socket; pass --socket")
+		}
+	}
+
+	cfg, err := config.Load(config.Path())
+	if err != nil {
+		return err
+	}
+	if err := applyConfig(cfg); err != nil {
+		return err
+	}
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	srv := daemon.New(db)
+	srv.Warnf = log.Printf
+	if cfg.WebhookURL != "" {
+		if srv.Notifier, err = notify.New(cfg.WebhookURL, cfg.WebhookFormat, notify.DefaultTimeout); err != nil {
+			return err
+		}
+	}
+
+	l, err := listenSocket(socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socket)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	utils.Statusf("📡 Daemon listening on %s for ingests into %s\n", socket, dbPath)
+	if err := srv.Serve(ctx, l); err != nil {
+		return err
+	}
+	utils.Statusf("🛑 Daemon stopped\n")
+	return nil
+}
+
+// listenSocket listens on a Unix socket only the current user can reach.
+// A socket file left by a daemon that is gone is replaced; one a running
+// daemon answers on is not.
+func listenSocket(path string) (net.Listener, error) {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := daemon.Dial(path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("a ferri daemon is already listening on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %v", err)
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %v", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to restrict socket: %v", err)
+	}
+	return l, nil
+}
+
+// localOnlyReason names what keeps an ingest from running on the daemon,
+// or returns "": several inputs, output on this process's stdout, and
+// processing flags that would change the daemon's settings for everyone
+func localOnlyReason(inputs int, passthrough, diff bool) string {
+	switch {
+	case inputs > 1:
+		return "several input files"
+	case passthrough:
+		return "--passthrough"
+	case diff:
+		return "--diff"
+	}
+	for _, name := range []string{"strip-prefixes", "no-scope-guess", "no-scheme-guess", "program-naming", "no-create-program"} {
+		if flagSet(flag.CommandLine, name) {
+			return "--" + name
+		}
+	}
+	return ""
+}
+
+// dialDaemon connects to the daemon an ingest should use, or returns nil to
+// ingest locally. Without --socket that is the daemon running next to the
+// database, if any; with it, the daemon must be reachable and the ingest
+// suited to it.
+func dialDaemon(dbPath, socketPath string, noDaemon bool, localReason string) (*net.UnixConn, error) {
+	if socketPath == "" {
+		socket := database.SocketPath(dbPath)
+		if noDaemon || localReason != "" || socket == "" {
+			return nil, nil
+		}
+		conn, err := daemon.Dial(socket)
+		if err != nil {
+			return nil, nil // No daemon running
+		}
+		return conn, nil
+	}
+
+	switch {
+	case noDaemon:
+		return nil, errors.New("--socket and --no-daemon contradict each other")
+	case localReason != "":
+		return nil, fmt.Errorf("the daemon cannot ingest with %s; drop --socket to ingest locally", localReason)
+	}
+	conn, err := daemon.Dial(socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("no ferri daemon on %s: %v", socketPath, err)
+	}
+	return conn, nil
+}
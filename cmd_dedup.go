@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"ferri/models"
+	"ferri/output"
+	"ferri/processors"
+	"ferri/utils"
+)
+
+// dedupRow is how ferri dedup prints a duplicated target
+type dedupRow struct {
+	Target   string         `json:"target"`
+	Programs dedupInstances `json:"programs"`
+}
+
+// dedupInstance is one program's copy of a duplicated target
+type dedupInstance struct {
+	Program  string    `json:"program"`
+	TargetID int       `json:"target_id"`
+	Since    time.Time `json:"since"`
+}
+
+// dedupInstances renders as one cell in tables
+type dedupInstances []dedupInstance
+
+func (d dedupInstances) String() string {
+	parts := make([]string, len(d))
+	for i, inst := range d {
+		parts[i] = fmt.Sprintf("%s (target %d, since %s)", inst.Program, inst.TargetID, inst.Since.Format("2006-01-02 15:04"))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// runDedup reports targets stored under several programs and, with
+// --merge, folds them into one program
+func runDedup(args []string) error {
+	fs := flag.NewFlagSet("dedup", flag.ContinueOnError)
+	merge := fs.String("merge", "", "program to keep duplicated targets in, by full name or ID; the other copies are merged into it and deleted")
+	format := output.FormatFlag(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("usage: ferri dedup [--merge program] [--format f]")
+	}
+	out, err := output.New(*format, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	dups, err := processors.FindCrossProgramDuplicates(db)
+	if err != nil {
+		return err
+	}
+	if len(dups) == 0 && *format == "table" {
+		utils.Statusf("✅ No targets are stored under more than one program\n")
+		return nil
+	}
+
+	rows := make([]dedupRow, len(dups))
+	for i, dup := range dups {
+		rows[i] = dedupRow{Target: models.JoinHostPort(dup.Target, dup.Port)}
+		for _, inst := range dup.Instances {
+			rows[i].Programs = append(rows[i].Programs, dedupInstance{Program: inst.ProgramName, TargetID: inst.TargetID, Since: inst.CreatedAt})
+		}
+	}
+	if err := out.Write(rows); err != nil {
+		return err
+	}
+	if len(dups) == 0 {
+		return nil
+	}
+
+	if *merge == "" {
+		utils.Statusf("♻️  %d targets are duplicated; use --merge <program> to consolidate them\n", len(dups))
+		return nil
+	}
+
+	program, err := lookupProgramExact(db, *merge)
+	if err != nil {
+		return err
+	}
+
+	removed, err := processors.MergeDuplicates(db, dups, program.ID)
+	if err != nil {
+		return err
+	}
+	utils.Statusf("🧹 Merged %d duplicate targets into %s\n", removed, program.Name)
+	return nil
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"ferri/config"
+	"ferri/models"
+	"ferri/output"
+	"ferri/processors"
+	"ferri/utils"
+)
+
+// findingUsage lists the finding subcommands
+const findingUsage = "usage: ferri finding add|list|update|rm ..."
+
+// runFinding dispatches the finding subcommands
+func runFinding(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf(findingUsage)
+	}
+	switch args[0] {
+	case "add":
+		return runFindingAdd(args[1:])
+	case "list":
+		return runFindings(args[1:])
+	case "update":
+		return runFindingUpdate(args[1:])
+	case "rm":
+		return runFindingRemove(args[1:])
+	}
+	return fmt.Errorf("unknown finding subcommand %q; %s", args[0], findingUsage)
+}
+
+// runFindingAdd records a finding against a target, creating the target
+// (and its program) when it is not known yet
+func runFindingAdd(args []string) error {
+	fs := flag.NewFlagSet("finding add", flag.ContinueOnError)
+	targetArg := fs.String("target", "", "target ID or value the finding was made on")
+	programName := fs.String("program", "", "program the target belongs to")
+	title := fs.String("title", "", "short title of the finding")
+	severity := fs.String("severity", "", "critical, high, medium, low or info (default: the config file's default_severity, else info)")
+	findingType := fs.String("type", "", "vulnerability class, e.g. XSS")
+	desc := fs.String("desc", "", "description of the finding")
+	poc := fs.String("poc", "", "proof of concept")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 || *targetArg == "" || *title == "" {
+		return fmt.Errorf("usage: ferri finding add --target <t> --title <title> [--severity s] [--type t] [--desc d] [--poc p] [--program name]")
+	}
+
+	// An unknown target is created the way an ingest would, and a missing
+	// severity comes from the config file
+	cfg, err := config.Load(config.Path())
+	if err != nil {
+		return err
+	}
+	if err := applyConfig(cfg); err != nil {
+		return err
+	}
+
+	finding := &models.Finding{
+		Title:          *title,
+		Type:           models.NewNullString(*findingType),
+		Description:    models.NewNullString(*desc),
+		ProofOfConcept: models.NewNullString(*poc),
+		Status:         models.StatusOpen,
+	}
+	if *severity != "" {
+		if finding.Severity, err = models.ParseSeverity(*severity); err != nil {
+			return err
+		}
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := addFinding(db, *targetArg, *programName, finding); err != nil {
+		return err
+	}
+
+	utils.Statusf("📝 Recorded finding #%d: %s\n", finding.ID, finding.Title)
+	fmt.Println(finding.ID)
+	return nil
+}
+
+// addFinding records a finding on an existing target, or on one created
+// the way an ingest would when it is not known yet
+func addFinding(db *sql.DB, arg, programName string, finding *models.Finding) error {
+	if _, err := strconv.Atoi(arg); err == nil || programName == "" {
+		target, err := resolveTarget(db, arg, "")
+		if err == nil {
+			finding.TargetID = target.ID
+			if err := models.NewFindingRepository(db).Create(finding); err != nil {
+				return fmt.Errorf("failed to create finding: %v", err)
+			}
+			return nil
+		}
+		if !errors.Is(err, errTargetNotFound) {
+			return err
+		}
+	}
+
+	err := processors.RecordFinding(db, programName, arg, finding)
+	if errors.Is(err, processors.ErrInvalidProgramDomain) {
+		return fmt.Errorf("%v; pass --program to choose one", err)
+	}
+	return err
+}
+
+// runFindingUpdate changes the fields of a finding given as flags
+func runFindingUpdate(args []string) error {
+	fs := flag.NewFlagSet("finding update", flag.ContinueOnError)
+	status := fs.String("status", "", "new status, e.g. Triaged")
+	severity := fs.String("severity", "", "new severity")
+	title := fs.String("title", "", "new title")
+	findingType := fs.String("type", "", "new vulnerability class")
+	desc := fs.String("desc", "", "new description")
+	reportID := fs.String("report-id", "", "platform report ID, e.g. after submitting")
+	reported := fs.Bool("reported", false, "mark the finding as reported today")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: ferri finding update <id> [--status s] [--severity s] [--title t] [--type t] [--desc d] [--report-id id] [--reported]")
+	}
+	id, err := strconv.Atoi(positional[0])
+	if err != nil {
+		return fmt.Errorf("invalid finding ID %q", positional[0])
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repo := models.NewFindingRepository(db)
+	finding, err := repo.GetByID(id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no finding with ID %d", id)
+	} else if err != nil {
+		return err
+	}
+
+	if *status != "" {
+		if finding.Status, err = models.ParseStatus(*status); err != nil {
+			return err
+		}
+	}
+	if *severity != "" {
+		if finding.Severity, err = models.ParseSeverity(*severity); err != nil {
+			return err
+		}
+	}
+	if *title != "" {
+		finding.Title = *title
+	}
+	if *findingType != "" {
+		finding.Type = models.NewNullString(*findingType)
+	}
+	if *desc != "" {
+		finding.Description = models.NewNullString(*desc)
+	}
+	if *reportID != "" {
+		// A report belongs to one finding
+		other, err := repo.GetByReportID(*reportID)
+		if err == nil && other.ID != finding.ID {
+			return fmt.Errorf("report %s is already recorded on finding #%d", *reportID, other.ID)
+		} else if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		finding.ReportID = models.NewNullString(*reportID)
+	}
+	if *reported {
+		finding.ReportedDate = models.NewNullTime(time.Now().UTC())
+	}
+
+	if err := repo.Update(finding); err != nil {
+		return fmt.Errorf("failed to update finding: %v", err)
+	}
+	utils.Statusf("✏️  Updated finding #%d: %s [%s, %s]\n", finding.ID, finding.Title, finding.Severity, finding.Status)
+	return nil
+}
+
+// runFindingRemove deletes a finding
+func runFindingRemove(args []string) error {
+	fs := flag.NewFlagSet("finding rm", flag.ContinueOnError)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: ferri finding rm <id>")
+	}
+	id, err := strconv.Atoi(positional[0])
+	if err != nil {
+		return fmt.Errorf("invalid finding ID %q", positional[0])
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repo := models.NewFindingRepository(db)
+	finding, err := repo.GetByID(id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no finding with ID %d", id)
+	} else if err != nil {
+		return err
+	}
+	if err := repo.Delete(id); err != nil {
+		return fmt.Errorf("failed to remove finding: %v", err)
+	}
+	utils.Statusf("🗑️  Removed finding #%d: %s\n", finding.ID, finding.Title)
+	return nil
+}
+
+
+// runFindings lists findings as a table or, e.g. for spreadsheets, as CSV
+func runFindings(args []string) error {
+	fs := flag.NewFlagSet("findings", flag.ContinueOnError)
+	format := output.FormatFlag(fs)
+	programName := fs.String("program", "", "only list findings of this program")
+	severity := fs.String("severity", "", "only list findings with this severity")
+	status := fs.String("status", "", "only list findings with this status")
+	grouped := fs.Bool("grouped", false, "list each title once with the number of targets it was found on")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("usage: ferri findings [--format f] [--program name] [--severity s] [--status s] [--grouped]")
+	}
+	if *grouped && (*severity != "" || *status != "") {
+		return fmt.Errorf("--grouped only combines with --program")
+	}
+	out, err := output.New(*format, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	if *grouped {
+		return writeFindingGroups(out, *programName)
+	}
+
+	filter := models.FindingFilter{ProgramName: *programName}
+	if *severity != "" {
+		if filter.Severity, err = models.ParseSeverity(*severity); err != nil {
+			return err
+		}
+	}
+	if *status != "" {
+		if filter.Status, err = models.ParseStatus(*status); err != nil {
+			return err
+		}
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if filter.ProgramName != "" {
+		program, err := lookupProgram(db, filter.ProgramName)
+		if err != nil {
+			return err
+		}
+		filter.ProgramName = program.Name
+	}
+	findings, err := models.NewFindingRepository(db).List(filter)
+	if err != nil {
+		return fmt.Errorf("failed to list findings: %v", err)
+	}
+
+	rows := make([]findingRow, len(findings))
+	for i, f := range findings {
+		rows[i] = findingRow{
+			ID:       f.ID,
+			Program:  f.ProgramName,
+			Target:   f.Target,
+			Title:    f.Title,
+			Type:     f.Type.String,
+			Severity: string(f.Severity),
+			Status:   string(f.Status),
+			ReportID: f.ReportID.String,
+		}
+		if f.ReportedDate.Valid {
+			rows[i].ReportedDate = f.ReportedDate.Time.Format("2006-01-02")
+		}
+	}
+	return out.Write(rows)
+}
+
+// findingRow is how findings are listed; the field order is the CSV
+// column order spreadsheets are set up for
+type findingRow struct {
+	ID           int    `json:"id"`
+	Program      string `json:"program"`
+	Target       string `json:"target"`
+	Title        string `json:"title"`
+	Type         string `json:"type"`
+	Severity     string `json:"severity"`
+	Status       string `json:"status"`
+	ReportedDate string `json:"reported_date"`
+	ReportID     string `json:"report_id"`
+}
+
+// writeFindingGroups lists findings grouped by title, optionally only
+// those of one program
+func writeFindingGroups(out output.Writer, programName string) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	programID := 0
+	if programName != "" {
+		program, err := lookupProgram(db, programName)
+		if err != nil {
+			return err
+		}
+		programID = program.ID
+	}
+
+	groups, err := models.NewFindingRepository(db).GroupByTitle(programID)
+	if err != nil {
+		return fmt.Errorf("failed to group findings: %v", err)
+	}
+	rows := make([]findingGroupRow, len(groups))
+	for i, g := range groups {
+		rows[i] = findingGroupRow{Title: g.Title, Severity: string(g.Severity), Targets: g.Targets, Findings: g.Findings}
+	}
+	return out.Write(rows)
+}
+
+// findingGroupRow is how grouped findings are listed
+type findingGroupRow struct {
+	Title    string `json:"title"`
+	Severity string `json:"severity"`
+	Targets  int    `json:"targets"`
+	Findings int    `json:"findings"`
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"ferri/models"
+	"ferri/processors"
+)
+
+// runMetrics prints database totals as Prometheus gauges, for scraping or
+// a node_exporter textfile collector
+func runMetrics(args []string) error {
+	fs := flag.NewFlagSet("metrics", flag.ContinueOnError)
+	outPath := fs.String("o", "", "write the metrics to this file, replacing it atomically, instead of stdout")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("usage: ferri metrics [-o file.prom]")
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	totals, err := processors.GetTotals(db)
+	if err != nil {
+		return err
+	}
+
+	// Every severity is reported, zero or not, so series do not vanish
+	severities := map[string]int{}
+	for _, s := range []models.FindingSeverity{models.SeverityCritical, models.SeverityHigh, models.SeverityMedium, models.SeverityLow, models.SeverityInfo} {
+		severities[string(s)] = 0
+	}
+	for severity, n := range totals.FindingsBySeverity {
+		severities[severity] += n
+	}
+
+	var b bytes.Buffer
+	writeGauge(&b, "ferri_programs_total", "Programs in the database.", "", map[string]int{"": totals.Programs})
+	writeGauge(&b, "ferri_targets_total", "Targets, by whether they were last seen alive.", "alive",
+		map[string]int{"true": totals.Alive, "false": totals.Targets - totals.Alive})
+	writeGauge(&b, "ferri_findings_total", "Findings, by severity.", "severity", severities)
+	writeGauge(&b, "ferri_recon_rows_total", "Recon data rows, by the tool that produced them.", "tool", totals.ReconRowsByTool)
+
+	if *outPath == "" {
+		_, err := os.Stdout.Write(b.Bytes())
+		return err
+	}
+	return writeFileAtomic(*outPath, b.Bytes())
+}
+
+// writeGauge writes a gauge in the Prometheus text format, one sample per
+// value of label in order, or a single unlabeled sample when label is ""
+func writeGauge(b *bytes.Buffer, name, help, label string, samples map[string]int) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	if label == "" {
+		fmt.Fprintf(b, "%s %d\n", name, samples[""])
+		return
+	}
+	values := make([]string, 0, len(samples))
+	for value := range samples {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	for _, value := range values {
+		fmt.Fprintf(b, "%s{%s=\"%s\"} %d\n", name, label, escapeLabel(value), samples[value])
+	}
+}
+
+// escapeLabel escapes a label value as the text format requires
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// writeFileAtomic replaces path with data in one rename, so a collector
+// never reads a half-written file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write metrics: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metrics: %v", err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metrics: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write metrics: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write metrics: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+
+	"ferri/processors"
+	"ferri/utils"
+)
+
+// runImportNmap stores the hosts and open ports of an Nmap XML report
+func runImportNmap(args []string) error {
+	fs := flag.NewFlagSet("import-nmap", flag.ContinueOnError)
+	programName := fs.String("program", "", "program the scanned hosts belong to")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 || *programName == "" {
+		return fmt.Errorf("usage: ferri import-nmap --program <name> <file.xml>")
+	}
+
+	f, err := os.Open(positional[0])
+	if err != nil {
+		return fmt.Errorf("failed to open Nmap report: %v", err)
+	}
+	defer f.Close()
+	r, err := utils.MaybeGzipReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read Nmap report: %v", err)
+	}
+	hosts, err := processors.ParseNmapXML(r)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// The report is stored completely or not at all
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	programID, _, err := processors.GetOrCreateProgramByNameContext(ctx, tx, *programName, sql.NullString{})
+	if err != nil {
+		return err
+	}
+	summary, err := processors.ImportNmapContext(ctx, tx, programID, hosts)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit Nmap import: %v", err)
+	}
+
+	utils.Statusf("✅ Imported %d hosts and %d open ports into %s (%d new targets)\n",
+		summary.Hosts, summary.Ports, *programName, summary.Created)
+	return nil
+}
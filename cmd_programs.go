@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"ferri/models"
+	"ferri/output"
+)
+
+// programRow is how ferri programs prints a program
+type programRow struct {
+	ID       int       `json:"id"`
+	Name     string    `json:"name"`
+	Scope    []string  `json:"scope"`
+	Targets  int       `json:"targets"`
+	Alive    int       `json:"alive"`
+	Findings int       `json:"findings"`
+	Created  time.Time `json:"created_at"`
+}
+
+// runPrograms lists every program with its target, live target and finding
+// counts
+func runPrograms(args []string) error {
+	fs := flag.NewFlagSet("programs", flag.ContinueOnError)
+	format := output.FormatFlag(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("usage: ferri programs [--format f]")
+	}
+	out, err := output.New(*format, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	programs, err := models.NewProgramRepository(db).ListWithCounts()
+	if err != nil {
+		return fmt.Errorf("failed to list programs: %v", err)
+	}
+
+	rows := make([]programRow, len(programs))
+	for i, p := range programs {
+		rows[i] = programRow{
+			ID:       p.ID,
+			Name:     p.Name,
+			Scope:    []string{},
+			Targets:  p.TargetCount,
+			Alive:    p.AliveCount,
+			Findings: p.FindingCount,
+			Created:  p.CreatedAt,
+		}
+		if p.Scope.Valid && p.Scope.String != "" {
+			rows[i].Scope = strings.Split(p.Scope.String, "\n")
+		}
+	}
+	return out.Write(rows)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"ferri/models"
+	"ferri/utils"
+)
+
+// runPrune deletes recon data older than a given age
+func runPrune(args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	olderThan := fs.String("older-than", "", "delete recon data older than this, e.g. 90d, 12h, 6mo")
+	tool := fs.String("tool", "", "only prune data from this tool")
+	programName := fs.String("program", "", "only prune data of this program, by full name or ID")
+	vacuum := fs.Bool("vacuum", false, "reclaim disk space afterwards without asking")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 || *olderThan == "" {
+		return fmt.Errorf("usage: ferri prune --older-than <age> [--tool name] [--program name] [--vacuum]")
+	}
+	age, err := utils.ParseDuration(*olderThan)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	filter := models.PruneFilter{Tool: *tool}
+	if *programName != "" {
+		program, err := lookupProgramExact(db, *programName)
+		if err != nil {
+			return err
+		}
+		filter.ProgramID = program.ID
+	}
+
+	cutoff := time.Now().Add(-age)
+	removed, err := models.NewReconDataRepository(db).PruneOlderThan(cutoff, filter)
+	if err != nil {
+		return err
+	}
+	utils.Statusf("🧹 Removed %d recon rows recorded before %s\n", removed, cutoff.Format("2006-01-02 15:04"))
+	if removed == 0 {
+		return nil
+	}
+
+	// Deleted rows only free pages inside the file; VACUUM shrinks it but
+	// rewrites the whole database, so ask first
+	if *vacuum || utils.Confirm("💾 Run VACUUM to reclaim disk space?") {
+		if _, err := db.Exec("VACUUM"); err != nil {
+			return fmt.Errorf("failed to vacuum database: %v", err)
+		}
+		utils.Statusf("✅ Database vacuumed\n")
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"ferri/config"
+	"ferri/processors"
+	"ferri/utils"
+)
+
+// runReclassify re-runs type detection over stored targets, fixing the
+// types of targets ingested before a detection fix or a new target_types
+// rule
+func runReclassify(args []string) error {
+	fs := flag.NewFlagSet("reclassify", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would change without changing it")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("usage: ferri reclassify [--dry-run]")
+	}
+
+	// Classify as ingest would, with the config file's target_types
+	cfg, err := config.Load(config.Path())
+	if err != nil {
+		return err
+	}
+	if err := applyConfig(cfg); err != nil {
+		return err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := processors.ReclassifyTargets(db, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	verb := "Reclassified"
+	if *dryRun {
+		verb = "Would reclassify"
+	}
+	utils.Statusf("🏷️  %s %d of %d targets\n", verb, result.Changed, result.Checked)
+	for _, change := range result.Changes {
+		from := change.From
+		if from == "" {
+			from = "(none)"
+		}
+		utils.Statusf("   %s → %s: %d\n", from, change.To, change.Count)
+	}
+	return nil
+}
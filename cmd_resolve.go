@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"ferri/output"
+	"ferri/processors"
+	"ferri/utils"
+)
+
+// resolveRow is how ferri resolve prints an address a target resolved to
+type resolveRow struct {
+	TargetID int    `json:"target_id"`
+	Target   string `json:"target"`
+	Address  string `json:"address"`
+}
+
+// runResolve looks up the addresses of domain targets and stores them
+func runResolve(args []string) error {
+	fs := flag.NewFlagSet("resolve", flag.ContinueOnError)
+	programName := fs.String("program", "", "only resolve targets of this program")
+	workers := fs.Int("workers", 20, "number of concurrent lookups")
+	timeout := fs.Duration("timeout", 5*time.Second, "timeout of each lookup")
+	rateLimit := fs.Float64("rate", 50, "maximum lookups per second across all workers; 0 is unlimited")
+	fresh := fs.String("fresh", "24h", "skip targets resolved within this age, e.g. 12h or 7d; 0 resolves everything")
+	format := output.FormatFlag(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("usage: ferri resolve [--program name] [--workers n] [--rate n] [--timeout d] [--fresh age] [--format f]")
+	}
+	if *workers < 1 {
+		return fmt.Errorf("--workers must be at least 1")
+	}
+	if *rateLimit < 0 {
+		return fmt.Errorf("--rate cannot be negative")
+	}
+	freshFor := time.Duration(0)
+	if *fresh != "0" {
+		if freshFor, err = utils.ParseDuration(*fresh); err != nil {
+			return err
+		}
+	}
+	out, err := output.New(*format, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	opts := processors.ResolveOptions{Workers: *workers, Timeout: *timeout, FreshFor: freshFor, Rate: *rateLimit}
+	if *programName != "" {
+		program, err := lookupProgram(db, *programName)
+		if err != nil {
+			return err
+		}
+		opts.ProgramID = program.ID
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	rows := []resolveRow{}
+	summary, err := processors.ResolveTargets(ctx, db, opts, func(res processors.Resolution) {
+		for _, ip := range res.IPs {
+			rows = append(rows, resolveRow{TargetID: res.TargetID, Target: res.Host, Address: ip.String()})
+		}
+		if res.Err != nil && !res.NotFound {
+			utils.Statusf("⚠️  %s: %v\n", res.Host, res.Err)
+		}
+	})
+	if summary != nil {
+		// Print what was stored even if a later write failed
+		if werr := out.Write(rows); werr != nil && err == nil {
+			err = werr
+		}
+		utils.Statusf("🔎 Resolved %d of %d hosts (%d fresh, %d not found, %d failed)\n",
+			summary.Resolved, summary.Candidates, summary.Fresh, summary.NotFound, summary.Failed)
+	}
+	if ctx.Err() != nil {
+		utils.Statusf("🛑 Interrupted\n")
+	}
+	return err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"ferri/models"
+	"ferri/output"
+)
+
+// runRow is how ferri runs prints a past ingest
+type runRow struct {
+	ID        int       `json:"id"`
+	Started   time.Time `json:"started_at"`
+	Tool      string    `json:"tool"`
+	Source    string    `json:"source"`
+	Program   string    `json:"program"`
+	Targets   int       `json:"targets"`
+	Created   int       `json:"created"`
+	ReconRows int       `json:"recon_rows"`
+	// Finished is false for runs that crashed or are still going
+	Finished bool `json:"finished"`
+}
+
+// runRuns lists past ingests, newest first
+func runRuns(args []string) error {
+	fs := flag.NewFlagSet("runs", flag.ContinueOnError)
+	programName := fs.String("program", "", "only list runs that stored targets in this program")
+	limit := fs.Int("limit", 20, "show at most this many runs; 0 shows all")
+	format := output.FormatFlag(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("usage: ferri runs [--program name] [--limit n] [--format f]")
+	}
+	out, err := output.New(*format, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	filter := models.RunFilter{ProgramName: *programName, Limit: *limit}
+	if filter.ProgramName != "" {
+		program, err := lookupProgram(db, filter.ProgramName)
+		if err != nil {
+			return err
+		}
+		filter.ProgramName = program.Name
+	}
+	runs, err := models.NewRunRepository(db).List(filter)
+	if err != nil {
+		return fmt.Errorf("failed to list runs: %v", err)
+	}
+
+	rows := make([]runRow, len(runs))
+	for i, r := range runs {
+		rows[i] = runRow{
+			ID:        r.ID,
+			Started:   r.StartedAt,
+			Tool:      r.Tool.String,
+			Source:    r.Source.String,
+			Program:   r.ProgramName.String,
+			Targets:   r.TargetCount,
+			Created:   r.CreatedTargets,
+			ReconRows: r.ReconRows,
+			Finished:  r.FinishedAt.Valid,
+		}
+	}
+	return out.Write(rows)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	"ferri/models"
+	"ferri/processors"
+	"ferri/utils"
+)
+
+// runImportScope replaces a program's scope with the patterns from a file
+func runImportScope(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: ferri import-scope <program> <file>")
+	}
+	programName, path := args[0], args[1]
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read scope file: %v", err)
+	}
+
+	scope, err := processors.ParseScope(data)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repo := models.NewProgramRepository(db)
+	program, err := repo.GetByName(programName)
+	if err == sql.ErrNoRows {
+		program = &models.Program{Name: programName}
+		if err := repo.Create(program); err != nil {
+			return fmt.Errorf("failed to create program: %v", err)
+		}
+		utils.Statusf("✨ Created new program: %s (ID: %d)\n", program.Name, program.ID)
+	} else if err != nil {
+		return fmt.Errorf("failed to look up program: %v", err)
+	}
+
+	program.Scope = joinPatterns(scope.InScope)
+	program.OutOfScope = joinPatterns(scope.OutOfScope)
+	if err := repo.Update(program); err != nil {
+		return fmt.Errorf("failed to update program scope: %v", err)
+	}
+
+	utils.Statusf("✅ Imported scope for %s: %d in scope, %d out of scope\n",
+		program.Name, len(scope.InScope), len(scope.OutOfScope))
+	return nil
+}
+
+// joinPatterns stores scope patterns one per line, or NULL when empty
+func joinPatterns(patterns []string) models.NullString {
+	return models.NewNullString(strings.Join(patterns, "\n"))
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"ferri/database"
+	"ferri/models"
+	"ferri/output"
+	"ferri/processors"
+)
+
+// statsRow is how ferri stats prints a program
+type statsRow struct {
+	ID        int         `json:"id"`
+	Program   string      `json:"program"`
+	Targets   int         `json:"targets"`
+	Alive     int         `json:"alive"`
+	Findings  int         `json:"findings"`
+	ReconRows int         `json:"recon_rows"`
+	Tools     toolVolumes `json:"tools"`
+	// StatusCodes is how many targets last answered with each HTTP status
+	StatusCodes statusCounts `json:"status_codes"`
+}
+
+// toolVolume is the number of recon rows one tool produced
+type toolVolume struct {
+	Tool  string  `json:"tool"`
+	Rows  int     `json:"rows"`
+	Share float64 `json:"share"`
+}
+
+// toolVolumes renders compactly in tables, biggest producer first
+type toolVolumes []toolVolume
+
+func (v toolVolumes) String() string {
+	parts := make([]string, len(v))
+	for i, t := range v {
+		parts[i] = fmt.Sprintf("%s %d (%.1f%%)", t.Tool, t.Rows, 100*t.Share)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// statusCount is the number of targets that answered with one HTTP status
+type statusCount struct {
+	Code    int `json:"code"`
+	Targets int `json:"targets"`
+}
+
+// statusCounts renders compactly in tables, lowest status first
+type statusCounts []statusCount
+
+func (c statusCounts) String() string {
+	parts := make([]string, len(c))
+	for i, s := range c {
+		parts[i] = fmt.Sprintf("%d: %d", s.Code, s.Targets)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// runStats prints per-program totals and which tools produce the recon data
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	format := output.FormatFlag(fs)
+	exact := fs.Bool("exact", false, "count the tables instead of reading the stats cache")
+	refresh := fs.Bool("refresh", false, "recount the stats cache before reading it")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		return fmt.Errorf("usage: ferri stats [program] [--exact|--refresh] [--format f]")
+	}
+	out, err := output.New(*format, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if *refresh {
+		if err := database.RefreshStatsCache(db); err != nil {
+			return err
+		}
+	}
+	// The cache is kept current by triggers; --exact double-checks it
+	getStats, getVolume := processors.GetCachedProgramStats, processors.CachedReconVolumeByTool
+	if *exact {
+		getStats, getVolume = processors.GetProgramStats, processors.ReconVolumeByTool
+	}
+
+	repo := models.NewProgramRepository(db)
+	var programs []*models.Program
+	if len(positional) == 1 {
+		program, err := lookupProgram(db, positional[0])
+		if err != nil {
+			return err
+		}
+		programs = []*models.Program{program}
+	} else if programs, err = repo.List(); err != nil {
+		return fmt.Errorf("failed to list programs: %v", err)
+	}
+
+	rows := make([]statsRow, 0, len(programs))
+	for _, program := range programs {
+		stats, err := getStats(db, program.ID)
+		if err != nil {
+			return err
+		}
+		volume, err := getVolume(db, program.ID)
+		if err != nil {
+			return err
+		}
+		histogram, err := processors.StatusCodeHistogram(db, program.ID)
+		if err != nil {
+			return err
+		}
+
+		row := statsRow{
+			ID:          program.ID,
+			Program:     program.Name,
+			Targets:     stats.Targets,
+			Alive:       stats.Alive,
+			Findings:    stats.Findings,
+			ReconRows:   stats.ReconRows,
+			Tools:       toolVolumes{},
+			StatusCodes: statusCounts{},
+		}
+		for tool, count := range volume {
+			row.Tools = append(row.Tools, toolVolume{Tool: tool, Rows: count, Share: float64(count) / float64(stats.ReconRows)})
+		}
+		// Biggest producers first, so the tool worth pruning stands out
+		sort.Slice(row.Tools, func(a, b int) bool {
+			if row.Tools[a].Rows != row.Tools[b].Rows {
+				return row.Tools[a].Rows > row.Tools[b].Rows
+			}
+			return row.Tools[a].Tool < row.Tools[b].Tool
+		})
+		for code, count := range histogram {
+			row.StatusCodes = append(row.StatusCodes, statusCount{Code: code, Targets: count})
+		}
+		sort.Slice(row.StatusCodes, func(a, b int) bool { return row.StatusCodes[a].Code < row.StatusCodes[b].Code })
+		rows = append(rows, row)
+	}
+	return out.Write(rows)
+}
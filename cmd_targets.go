@@ -0,0 +1,375 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ferri/models"
+	"ferri/output"
+	"ferri/utils"
+)
+
+// defaultStaleAge is how long an alive target may go unchecked before
+// --stale lists it
+const defaultStaleAge = "7d"
+
+// runTag adds (or with --remove, removes) tags on a target
+func runTag(args []string) error {
+	fs := flag.NewFlagSet("tag", flag.ContinueOnError)
+	programName := fs.String("program", "", "program the target belongs to")
+	remove := fs.Bool("remove", false, "remove the tags instead of adding them")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) < 2 {
+		return fmt.Errorf("usage: ferri tag [--program name] [--remove] <target> <tag>...")
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	target, err := resolveTarget(db, positional[0], *programName)
+	if err != nil {
+		return err
+	}
+
+	repo := models.NewTargetRepository(db)
+	for _, tag := range positional[1:] {
+		if *remove {
+			err = repo.RemoveTag(target.ID, tag)
+		} else {
+			err = repo.AddTag(target.ID, tag)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update tag %q: %v", tag, err)
+		}
+	}
+
+	tags, err := repo.ListTags(target.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list tags: %v", err)
+	}
+	utils.Statusf("🏷️  %s: %v\n", target.Address(), tags)
+	return nil
+}
+
+// runTargets lists the targets of a program, optionally narrowed by tag,
+// port or technology
+func runTargets(args []string) error {
+	fs := flag.NewFlagSet("targets", flag.ContinueOnError)
+	tag := fs.String("tag", "", "only list targets carrying this tag")
+	port := fs.Int("port", 0, "only list targets on this port")
+	tech := fs.String("tech", "", "only list targets running this technology, e.g. wordpress")
+	notCheckedSince := fs.String("not-checked-since", "", "only list targets not checked within this age, e.g. 30d; never-checked ones included")
+	stale := fs.Bool("stale", false, "only list alive targets not re-checked within --not-checked-since (default "+defaultStaleAge+")")
+	format := output.FormatFlag(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 || (len(positional) == 0 && *tag == "" && *port == 0 && *tech == "" && *notCheckedSince == "" && !*stale) {
+		return fmt.Errorf("usage: ferri targets [program] [--tag tag] [--port port] [--tech name] [--not-checked-since age] [--stale] [--format f]")
+	}
+	if *stale && *notCheckedSince == "" {
+		*notCheckedSince = defaultStaleAge
+	}
+	var checkedBefore time.Time
+	if *notCheckedSince != "" {
+		age, err := utils.ParseDuration(*notCheckedSince)
+		if err != nil {
+			return err
+		}
+		checkedBefore = time.Now().Add(-age)
+	}
+	freshness := !checkedBefore.IsZero()
+	out, err := output.New(*format, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repo := models.NewTargetRepository(db)
+	programID := 0
+	if len(positional) == 1 {
+		program, err := lookupProgram(db, positional[0])
+		if err != nil {
+			return err
+		}
+		programID = program.ID
+	}
+
+	var targets []*models.Target
+	switch {
+	case *tag != "":
+		targets, err = repo.ListByTag(*tag)
+	case *port != 0:
+		targets, err = repo.ListByPort(*port)
+	case *tech != "":
+		targets, err = repo.ListByTechnology(*tech)
+	case freshness:
+		targets, err = repo.ListByLastChecked(checkedBefore, models.SearchOptions{ProgramID: programID, AliveOnly: *stale})
+	default:
+		targets, err = repo.ListByProgram(programID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list targets: %v", err)
+	}
+
+	// --tech narrows whichever list was fetched
+	var running map[int]bool
+	if *tech != "" && (*tag != "" || *port != 0) {
+		techTargets, err := repo.ListByTechnology(*tech)
+		if err != nil {
+			return fmt.Errorf("failed to list targets: %v", err)
+		}
+		running = make(map[int]bool, len(techTargets))
+		for _, t := range techTargets {
+			running[t.ID] = true
+		}
+	}
+
+	var matched []*models.Target
+	for _, t := range targets {
+		if (programID != 0 && t.ProgramID != programID) || (*port != 0 && t.Port != *port) {
+			continue
+		}
+		if running != nil && !running[t.ID] {
+			continue
+		}
+		// The freshness flags narrow a list fetched by another filter
+		if freshness && ((*stale && !t.Alive) || (t.LastChecked.Valid && !t.LastChecked.Time.Before(checkedBefore))) {
+			continue
+		}
+		matched = append(matched, t)
+	}
+
+	rows, err := targetRows(db, matched)
+	if err != nil {
+		return err
+	}
+	return out.Write(rows)
+}
+
+// runFind lists targets matching a glob such as '*.api.example.com'
+func runFind(args []string) error {
+	fs := flag.NewFlagSet("find", flag.ContinueOnError)
+	programName := fs.String("program", "", "only search this program")
+	alive := fs.Bool("alive", false, "only list targets marked alive")
+	format := output.FormatFlag(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: ferri find <pattern> [--program name] [--alive] [--format f]")
+	}
+	out, err := output.New(*format, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	opts := models.SearchOptions{AliveOnly: *alive}
+	if *programName != "" {
+		program, err := lookupProgram(db, *programName)
+		if err != nil {
+			return err
+		}
+		opts.ProgramID = program.ID
+	}
+
+	targets, err := models.NewTargetRepository(db).Search(positional[0], opts)
+	if err != nil {
+		return fmt.Errorf("failed to search targets: %v", err)
+	}
+
+	rows, err := targetRows(db, targets)
+	if err != nil {
+		return err
+	}
+	return out.Write(rows)
+}
+
+// targetRow is how the query commands print a target
+type targetRow struct {
+	ID      int    `json:"id"`
+	Program string `json:"program"`
+	Target  string `json:"target"`
+	Type    string `json:"type"`
+	Alive   bool   `json:"alive"`
+	Tested  bool   `json:"tested"`
+}
+
+// targetRows converts targets for output, looking up their program names
+func targetRows(db *sql.DB, targets []*models.Target) ([]targetRow, error) {
+	programs, err := models.NewProgramRepository(db).List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list programs: %v", err)
+	}
+	names := make(map[int]string, len(programs))
+	for _, p := range programs {
+		names[p.ID] = p.Name
+	}
+
+	rows := make([]targetRow, len(targets))
+	for i, t := range targets {
+		rows[i] = targetRow{
+			ID:      t.ID,
+			Program: names[t.ProgramID],
+			Target:  t.Address(),
+			Type:    string(t.Type),
+			Alive:   t.Alive,
+			Tested:  t.Tested,
+		}
+	}
+	return rows, nil
+}
+
+// runNote appends a note to a target, reading it from stdin when no text
+// argument is given so multi-line notes can be pasted
+func runNote(args []string) error {
+	fs := flag.NewFlagSet("note", flag.ContinueOnError)
+	programName := fs.String("program", "", "program the target belongs to")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) < 1 {
+		return fmt.Errorf("usage: ferri note [--program name] <target> [text]")
+	}
+
+	note := strings.Join(positional[1:], " ")
+	if note == "" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read note from stdin: %v", err)
+		}
+		note = string(data)
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	target, err := resolveTarget(db, positional[0], *programName)
+	if err != nil {
+		return err
+	}
+
+	if err := models.NewTargetRepository(db).AppendNote(target.ID, note); err != nil {
+		return fmt.Errorf("failed to add note: %v", err)
+	}
+	utils.Statusf("📝 Added note to %s\n", target.Address())
+	return nil
+}
+
+// runSetScreenshot links targets to screenshots on disk: one target given
+// as arguments, or with --csv every url,path line of stdin, such as the
+// list of an aquatone or gowitness run
+func runSetScreenshot(args []string) error {
+	fs := flag.NewFlagSet("set-screenshot", flag.ContinueOnError)
+	programName := fs.String("program", "", "program the targets belong to")
+	bulk := fs.Bool("csv", false, "read url,path lines from stdin")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if *bulk && len(positional) > 0 || !*bulk && len(positional) != 2 {
+		return fmt.Errorf("usage: ferri set-screenshot [--program name] <target> <path>\n       ferri set-screenshot --csv [--program name] < screenshots.csv")
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	repo := models.NewTargetRepository(db)
+
+	if !*bulk {
+		target, err := resolveTarget(db, positional[0], *programName)
+		if err != nil {
+			return err
+		}
+		path, err := screenshotPath(positional[1])
+		if err != nil {
+			return err
+		}
+		if err := repo.SetScreenshot(target.ID, path); err != nil {
+			return fmt.Errorf("failed to set screenshot: %v", err)
+		}
+		utils.Statusf("📸 Linked %s to %s\n", target.Address(), path)
+		return nil
+	}
+
+	r := csv.NewReader(os.Stdin)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	linked, failed := 0, 0
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to read CSV: %v", err)
+		}
+		if len(record) < 2 || line == 1 && strings.EqualFold(record[0], "url") {
+			continue // Header or not a url,path line
+		}
+
+		target, err := resolveTarget(db, record[0], *programName)
+		if err == nil {
+			var path string
+			if path, err = screenshotPath(record[1]); err == nil {
+				err = repo.SetScreenshot(target.ID, path)
+			}
+		}
+		if err != nil {
+			log.Printf("⚠️  Line %d (%s): %v\n", line, record[0], err)
+			failed++
+			continue
+		}
+		linked++
+	}
+	utils.Statusf("📸 Linked %d screenshots\n", linked)
+	if failed > 0 {
+		return fmt.Errorf("%d lines could not be linked", failed)
+	}
+	return nil
+}
+
+// screenshotPath returns the absolute form of a screenshot path, so links
+// keep working from any directory; "" stays empty and removes the link
+func screenshotPath(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	abs, err := filepath.Abs(utils.ExpandPath(path))
+	if err != nil {
+		return "", fmt.Errorf("invalid screenshot path %q: %v", path, err)
+	}
+	return abs, nil
+}
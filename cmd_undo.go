@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+
+	"ferri/processors"
+	"ferri/utils"
+)
+
+// runUndo removes what one ingest run stored
+func runUndo(args []string) error {
+	fs := flag.NewFlagSet("undo", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would be removed without removing it")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: ferri undo <run-id> [--dry-run]")
+	}
+	runID, err := strconv.Atoi(positional[0])
+	if err != nil {
+		return fmt.Errorf("invalid run ID %q; see 'ferri runs'", positional[0])
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := processors.UndoRun(db, runID, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	verb := "Removed"
+	if *dryRun {
+		verb = "Would remove"
+	}
+	utils.Statusf("↩️  %s run %d: %d recon rows, %d findings and %d targets\n", verb, runID, result.ReconRows, result.Findings, result.Targets)
+	if result.KeptTargets > 0 {
+		utils.Statusf("📌 Kept %d targets the run created that are still referenced by other runs, findings or subdomains\n",
+			result.KeptTargets)
+	}
+	return nil
+}
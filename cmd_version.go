@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"ferri/database"
+)
+
+// Build metadata, set at link time:
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Plain go builds fall back to the VCS information Go embeds.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// versionString describes this build, including the schema version it
+// migrates databases to
+func versionString() string {
+	c, date := commit, buildDate
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && c == "":
+				c = s.Value
+				if len(c) > 12 {
+					c = c[:12]
+				}
+			case s.Key == "vcs.time" && date == "":
+				date = s.Value
+			}
+		}
+	}
+	if c == "" {
+		c = "unknown"
+	}
+	if date == "" {
+		date = "unknown"
+	}
+	return fmt.Sprintf("ferri %s (commit %s, built %s, %s, schema v%d)",
+		version, c, date, runtime.Version(), database.LatestSchemaVersion())
+}
+
+// runVersion prints the build metadata
+func runVersion(args []string) error {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	fmt.Println(versionString())
+	return nil
+}
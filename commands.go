@@ -0,0 +1,398 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ferri/config"
+	"ferri/database"
+	"ferri/models"
+	"ferri/processors"
+	"ferri/utils"
+)
+
+// command is a ferri subcommand such as "import-scope"
+type command struct {
+	usage   string
+	summary string
+	run     func(args []string) error
+}
+
+// commands maps subcommand names to their implementations. Anything not
+// listed here falls through to the default stdin ingest.
+var commands = map[string]command{
+	"alias": {
+		usage:   "alias add|rm|list",
+		summary: "Map alternate root domains (acme.io, acmecloud.net) to one program",
+		run:     runAlias,
+	},
+	"daemon": {
+		usage:   "daemon [--socket path]",
+		summary: "Own the database and ingest what other ferri processes send over a Unix socket",
+		run:     runDaemon,
+	},
+	"dedup": {
+		usage:   "dedup [--merge program] [--format f]",
+		summary: "Report targets stored under several programs, optionally merging them",
+		run:     runDedup,
+	},
+	"export": {
+		usage:   "export --program <name> [-o file]",
+		summary: "Write a program's targets, recon data and findings as a JSON bundle",
+		run:     runExport,
+	},
+	"find": {
+		usage:   "find <pattern> [--program name] [--format f]",
+		summary: "List targets matching a glob such as '*.api.example.com' (--alive for live ones)",
+		run:     runFind,
+	},
+	"finding": {
+		usage:   "finding add|list|update|rm",
+		summary: "Record, list, update or remove findings",
+		run:     runFinding,
+	},
+	"findings": {
+		usage:   "findings [--grouped] [--format f]",
+		summary: "List findings, filtered by --program, --severity or --status",
+		run:     runFindings,
+	},
+	"import": {
+		usage:   "import <bundle.json>",
+		summary: "Add the contents of a bundle from ferri export, skipping what exists",
+		run:     runImport,
+	},
+	"import-nmap": {
+		usage:   "import-nmap --program <name> <file.xml>",
+		summary: "Store the hosts and open ports of an Nmap XML report (nmap -oX)",
+		run:     runImportNmap,
+	},
+	"import-scope": {
+		usage:   "import-scope <program> <file>",
+		summary: "Set a program's scope from a +/- pattern list or HackerOne JSON",
+		run:     runImportScope,
+	},
+	"metrics": {
+		usage:   "metrics [-o file.prom]",
+		summary: "Print program, target, finding and recon totals as Prometheus gauges",
+		run:     runMetrics,
+	},
+	"note": {
+		usage:   "note <target> [text]",
+		summary: "Append a timestamped note to a target (text from stdin if omitted)",
+		run:     runNote,
+	},
+	"programs": {
+		usage:   "programs [--format f]",
+		summary: "List programs with their target, alive and finding counts",
+		run:     runPrograms,
+	},
+	"prune": {
+		usage:   "prune --older-than <age>",
+		summary: "Delete recon data older than an age like 90d or 6mo (--tool, --program)",
+		run:     runPrune,
+	},
+	"reclassify": {
+		usage:   "reclassify [--dry-run]",
+		summary: "Re-run type detection over stored targets and fix the types that changed",
+		run:     runReclassify,
+	},
+	"resolve": {
+		usage:   "resolve [--program name]",
+		summary: "Look up the A/AAAA records of domain targets (--workers, --rate, --fresh)",
+		run:     runResolve,
+	},
+	"runs": {
+		usage:   "runs [--program name] [--limit n]",
+		summary: "List past ingests with the targets and recon rows each stored",
+		run:     runRuns,
+	},
+	"serve": {
+		usage:   "serve [--addr host:port]",
+		summary: "Serve a read-only JSON API over programs, targets, recon data and findings",
+		run:     runServe,
+	},
+	"set-screenshot": {
+		usage:   "set-screenshot <target> <path>",
+		summary: "Link a target to a screenshot on disk (--csv reads url,path lines from stdin)",
+		run:     runSetScreenshot,
+	},
+	"stats": {
+		usage:   "stats [program] [--exact] [--format f]",
+		summary: "Show per-program totals and recon data volume per tool",
+		run:     runStats,
+	},
+	"tag": {
+		usage:   "tag [--remove] <target> <tag>...",
+		summary: "Add or remove tags on a target",
+		run:     runTag,
+	},
+	"targets": {
+		usage:   "targets [program] [--tag t] [--port n] [--format f]",
+		summary: "List targets of a program, carrying a tag or on a port",
+		run:     runTargets,
+	},
+	"undo": {
+		usage:   "undo <run-id> [--dry-run]",
+		summary: "Remove the recon data and new targets one ingest run stored",
+		run:     runUndo,
+	},
+	"version": {
+		usage:   "version",
+		summary: "Print the version, commit, build date and schema version of this build",
+		run:     runVersion,
+	},
+}
+
+// printCommands lists the available subcommands on the flag output
+func printCommands() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Commands:\n")
+	for _, name := range names {
+		fmt.Fprintf(out, "  ferri %-32s %s\n", commands[name].usage, commands[name].summary)
+	}
+}
+
+// dbFlag is the database given with --db, before the subcommand or among
+// the ingest flags
+var dbFlag string
+
+// assumeYes is set by --yes, before the subcommand or among the ingest
+// flags, and answers yes to the schema migration prompt
+var assumeYes bool
+
+// splitDBFlag removes leading --db and --yes options, which apply to every
+// command, from the arguments. --yes sets assumeYes.
+func splitDBFlag(args []string) (string, []string) {
+	db := ""
+	for len(args) > 0 {
+		switch arg := args[0]; {
+		case arg == "--yes" || arg == "-yes" || arg == "-y":
+			assumeYes, args = true, args[1:]
+		case (arg == "--db" || arg == "-db") && len(args) > 1:
+			db, args = args[1], args[2:]
+		case strings.HasPrefix(arg, "--db="), strings.HasPrefix(arg, "-db="):
+			db, args = arg[strings.Index(arg, "=")+1:], args[1:]
+		default:
+			return db, args
+		}
+	}
+	return db, args
+}
+
+// resolveDBPath returns the database to use: --db, then $FERRI_DB_PATH, then the
+// config file's db, then the default. Any of them may be a plain path or a
+// go-sqlite3 DSN.
+func resolveDBPath() (string, error) {
+	if dbFlag != "" {
+		return dbFlag, nil
+	}
+	if path := os.Getenv("FERRI_DB_PATH"); path != "" {
+		return path, nil
+	}
+	cfg, err := config.Load(config.Path())
+	if err != nil {
+		return "", err
+	}
+	if cfg.DB != "" {
+		return cfg.DB, nil
+	}
+	return database.DefaultDBPath, nil
+}
+
+// openDB makes sure the database exists and returns a connection to it
+func openDB() (*sql.DB, error) {
+	path, err := resolveDBPath()
+	if err != nil {
+		return nil, err
+	}
+	if err := database.EnsureDBExists(path); err != nil {
+		return nil, fmt.Errorf("error ensuring database exists: %v", err)
+	}
+
+	db, err := database.InitDB(path)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing database: %v", err)
+	}
+	return db, nil
+}
+
+// applyConfig sets the processing options of the config file, which
+// ingest flags may then override
+func applyConfig(cfg *config.Config) error {
+	if len(cfg.StripPrefixes) > 0 {
+		processors.StripPrefixes = cfg.StripPrefixes
+	}
+	if cfg.ProgramNaming != "" {
+		if err := processors.SetProgramNaming(cfg.ProgramNaming); err != nil {
+			return err
+		}
+	}
+	if cfg.NoScopeGuess {
+		processors.GuessScope = false
+	}
+	if cfg.NoSchemeGuess {
+		processors.GuessScheme = false
+	}
+	if err := processors.AddSeverityAliases(cfg.SeverityMap); err != nil {
+		return err
+	}
+	if err := processors.AddContextTemplates(cfg.ContextTemplates); err != nil {
+		return err
+	}
+	if cfg.DefaultSeverity != "" {
+		if err := models.SetDefaultSeverity(cfg.DefaultSeverity); err != nil {
+			return err
+		}
+	}
+	for _, rule := range cfg.TargetTypes {
+		if err := processors.AddClassificationRule(rule.Pattern, rule.Type); err != nil {
+			return err
+		}
+	}
+	for _, fp := range cfg.TakeoverFingerprints {
+		if err := processors.AddTakeoverFingerprint(fp.Service, fp.Pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flagSet reports whether a flag was given on the command line rather than
+// left at its default
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// confirmMigration asks before an existing database is migrated, unless
+// --yes was given or ferri is not attached to a terminal, where nobody
+// could answer
+func confirmMigration(from, to int) bool {
+	if assumeYes || !utils.IsTerminal(os.Stdin) || !utils.IsTerminal(utils.Status) {
+		return true
+	}
+	return utils.Confirm(fmt.Sprintf("⚠️  Migrate database from schema v%d to v%d? A backup is taken first.", from, to))
+}
+
+// parseArgs parses flags that may appear before, between or after the
+// positional arguments, which the flag package alone does not allow
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// lookupProgram finds the program a command-line argument names, which may
+// be abbreviated to a unique prefix or part of the name. An ambiguous name
+// fails with the programs it matches.
+func lookupProgram(db *sql.DB, name string) (*models.Program, error) {
+	program, err := models.NewProgramRepository(db).Resolve(name)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("program not found: %s", name)
+	} else if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(program.Name, strings.TrimSpace(name)) {
+		utils.Statusf("🔍 %s resolved to program %s\n", name, program.Name)
+	}
+	return program, nil
+}
+
+// lookupProgramExact finds the program a command-line argument names in
+// full, ignoring case, or else the program with that numeric ID. Commands
+// that delete or merge data use it instead of lookupProgram, so an
+// abbreviation can never pick another program's data.
+func lookupProgramExact(db *sql.DB, arg string) (*models.Program, error) {
+	repo := models.NewProgramRepository(db)
+	name := strings.TrimSpace(arg)
+	program, err := repo.GetByName(name)
+	if err == sql.ErrNoRows {
+		if id, convErr := strconv.Atoi(name); convErr == nil {
+			program, err = repo.GetByID(id)
+		}
+	}
+	if err == sql.ErrNoRows {
+		if guess, guessErr := repo.Resolve(name); guessErr == nil {
+			return nil, fmt.Errorf("program not found: %s (did you mean %s? this command needs the full name or ID)", arg, guess.Name)
+		}
+		return nil, fmt.Errorf("program not found: %s", arg)
+	}
+	return program, err
+}
+
+// errTargetNotFound is returned by resolveTarget when no target has the
+// given value
+var errTargetNotFound = errors.New("target not found")
+
+// resolveTarget finds the target a command-line argument refers to, either
+// by numeric id or by value. Values are classified as ingest stores them,
+// so a URL matches in the form tools print it. A value present in several
+// programs must be narrowed down with programName.
+func resolveTarget(db *sql.DB, arg, programName string) (*models.Target, error) {
+	repo := models.NewTargetRepository(db)
+	if id, err := strconv.Atoi(arg); err == nil {
+		target, err := repo.GetByID(id)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("no target with ID %d", id)
+		}
+		return target, err
+	}
+	value, _, port := processors.ClassifyTarget(arg)
+	arg = models.JoinHostPort(value, port)
+
+	if programName != "" {
+		program, err := lookupProgram(db, programName)
+		if err != nil {
+			return nil, err
+		}
+		target, err := repo.GetByProgramAndTarget(program.ID, arg)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s in program %s", errTargetNotFound, arg, program.Name)
+		}
+		return target, err
+	}
+
+	targets, err := repo.FindByValue(arg)
+	if err != nil {
+		return nil, err
+	}
+	switch len(targets) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s", errTargetNotFound, arg)
+	case 1:
+		return targets[0], nil
+	}
+
+	ids := make([]string, len(targets))
+	for i, t := range targets {
+		ids[i] = strconv.Itoa(t.ProgramID)
+	}
+	return nil, fmt.Errorf("target %s exists in programs %s; use --program or the target ID",
+		arg, strings.Join(ids, ", "))
+}
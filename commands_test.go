@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"ferri/database"
+	"ferri/processors"
+)
+
+func TestResolveTarget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bounty.db")
+	if err := database.EnsureDBExists(path); err != nil {
+		t.Fatal(err)
+	}
+	db, err := database.InitDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	programID, _, err := processors.GetOrCreateProgram(db, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []string{"https://example.com/admin", "a.example.com:8443", "b.example.com"} {
+		if _, _, err := processors.GetOrCreateTarget(db, target, "manual", programID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		arg  string
+		want string // stored address, "" when nothing matches
+	}{
+		{"b.example.com", "b.example.com"},
+		{"B.Example.com", "b.example.com"},
+		{"a.example.com:8443", "a.example.com:8443"},
+		{"https://example.com/admin", "https://example.com/admin"},
+		{"https://example.com:443/admin", "https://example.com/admin"},
+		{"example.com/admin", "https://example.com/admin"},
+		{"c.example.com", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			target, err := resolveTarget(db, tt.arg, "")
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("resolveTarget(%q) = %s, want not found", tt.arg, target.Address())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveTarget(%q): %v", tt.arg, err)
+			}
+			if target.Address() != tt.want {
+				t.Errorf("resolveTarget(%q) = %s, want %s", tt.arg, target.Address(), tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupProgramExact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bounty.db")
+	if err := database.EnsureDBExists(path); err != nil {
+		t.Fatal(err)
+	}
+	db, err := database.InitDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, name := range []string{"example", "example-old", "acme", "42"} {
+		if _, _, err := processors.GetOrCreateProgramByNameContext(context.Background(), db, name, sql.NullString{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		arg string
+		// want is the program found, "" when the lookup must fail
+		want  string
+		fuzzy string // what lookupProgram finds instead
+	}{
+		{"example", "example", "example"},
+		{"EXAMPLE", "example", "example"},
+		{" acme ", "acme", "acme"},
+		{"3", "acme", ""},
+		{"42", "42", "42"},
+		{"1", "example", ""},
+		{"exam", "", ""},
+		{"example-o", "", "example-old"},
+		{"cme", "", "acme"},
+		{"99", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			program, err := lookupProgramExact(db, tt.arg)
+			switch {
+			case tt.want == "" && err == nil:
+				t.Errorf("lookupProgramExact(%q) = %s, want an error", tt.arg, program.Name)
+			case tt.want != "" && err != nil:
+				t.Errorf("lookupProgramExact(%q): %v", tt.arg, err)
+			case tt.want != "" && program.Name != tt.want:
+				t.Errorf("lookupProgramExact(%q) = %s, want %s", tt.arg, program.Name, tt.want)
+			}
+			if tt.fuzzy == "" {
+				return
+			}
+			if program, err := lookupProgram(db, tt.arg); err != nil || program.Name != tt.fuzzy {
+				t.Errorf("lookupProgram(%q) = %v, %v; want %s", tt.arg, program, err, tt.fuzzy)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"ferri/utils"
+)
+
+// DefaultPath is where ferri looks for its config file
+const DefaultPath = "~/.config/ferri/config.json"
+
+// Config holds the user settings read from the config file. Every field is
+// optional; zero values leave ferri's built-in defaults in place.
+type Config struct {
+	// StripPrefixes are leading labels removed from hosts whose
+	// registrable domain cannot be determined, e.g. "www."
+	StripPrefixes []string `json:"strip_prefixes,omitempty"`
+
+	// DefaultProgram collects targets no program name can be derived
+	// from, such as localhost or bare IPs
+	DefaultProgram string `json:"default_program,omitempty"`
+
+	// NoScopeGuess creates programs without the *.domain scope otherwise
+	// guessed from their first target
+	NoScopeGuess bool `json:"no_scope_guess,omitempty"`
+
+	// NoSchemeGuess stores URLs written without a scheme, such as
+	// example.com/admin, as given instead of prepending https://
+	NoSchemeGuess bool `json:"no_scheme_guess,omitempty"`
+
+	// DB is the database to use instead of ~/bugbounty/db/bounty.db,
+	// either a path or a go-sqlite3 DSN
+	DB string `json:"db,omitempty"`
+
+	// SeverityMap maps scanner severity labels ferri does not know, such
+	// as "warning", to one of critical, high, medium, low or info
+	SeverityMap map[string]string `json:"severity_map,omitempty"`
+
+	// DefaultSeverity is given to findings added without a severity,
+	// instead of info
+	DefaultSeverity string `json:"default_severity,omitempty"`
+
+	// ContextTemplates maps tools to Go templates for the context stored
+	// with their recon data, e.g. "httpx": "status={{.status_code}}"
+	ContextTemplates map[string]string `json:"context_templates,omitempty"`
+
+	// ProgramNaming names new programs after the first label of a
+	// target's domain ("first-label", the default), its
+	// "registrable-domain" or its "full-host"
+	ProgramNaming string `json:"program_naming,omitempty"`
+
+	// TargetTypes are custom classification rules, tried in order before
+	// the built-in ones
+	TargetTypes []TargetTypeRule `json:"target_types,omitempty"`
+
+	// TakeoverFingerprints add to the hosting services whose CNAMEs are
+	// flagged as potential subdomain takeovers
+	TakeoverFingerprints []TakeoverFingerprint `json:"takeover_fingerprints,omitempty"`
+
+	// CommentPrefix starts input lines that are skipped as comments,
+	// instead of the default "#"
+	CommentPrefix string `json:"comment_prefix,omitempty"`
+
+	// WebhookURL receives a POST for every finding an ingest creates
+	WebhookURL string `json:"webhook_url,omitempty"`
+
+	// WebhookFormat is the payload shape: "json" (default) or "slack"
+	WebhookFormat string `json:"webhook_format,omitempty"`
+}
+
+// TargetTypeRule types the targets matching a regular expression, e.g.
+// {"pattern": "^[a-z0-9.-]+\\.s3\\.amazonaws\\.com$", "type": "s3_bucket"}
+type TargetTypeRule struct {
+	Pattern string `json:"pattern"`
+	Type    string `json:"type"`
+}
+
+// TakeoverFingerprint flags CNAMEs matching a regular expression as
+// pointing to a service, e.g.
+// {"service": "tumblr", "pattern": "^domains\\.tumblr\\.com$"}
+type TakeoverFingerprint struct {
+	Service string `json:"service"`
+	Pattern string `json:"pattern"`
+}
+
+// Path returns the config file location, honouring FERRI_CONFIG
+func Path() string {
+	if path := os.Getenv("FERRI_CONFIG"); path != "" {
+		return utils.ExpandPath(path)
+	}
+	return utils.ExpandPath(DefaultPath)
+}
+
+// Load reads the config file at path. A missing file is not an error and
+// yields an empty Config.
+func Load(path string) (*Config, error) {
+	cfg := &Config{}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %v", path, err)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %v", path, err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ferri/utils"
+)
+
+// IgnoreFile is the name of the denylist read from the working directory
+// and from the config directory
+const IgnoreFile = ".ferriignore"
+
+// IgnorePaths returns where ignore files are looked for: the working
+// directory first, then the directory holding the config file
+func IgnorePaths() []string {
+	return []string{IgnoreFile, filepath.Join(filepath.Dir(Path()), IgnoreFile)}
+}
+
+// IgnoreList holds glob patterns of targets to skip during ingest, such as
+// CDN or third-party hosts, regardless of program
+type IgnoreList struct {
+	Patterns []string
+}
+
+// LoadIgnore reads the glob patterns in each file, one per line, skipping
+// blank lines and # comments. Missing files are not an error.
+func LoadIgnore(paths ...string) (*IgnoreList, error) {
+	list := &IgnoreList{}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read ignore file %s: %v", path, err)
+		}
+
+		scanner := bufio.NewScanner(f)
+		for n := 1; scanner.Scan(); n++ {
+			pattern := strings.TrimSpace(scanner.Text())
+			if pattern == "" || strings.HasPrefix(pattern, "#") {
+				continue
+			}
+			pattern = strings.ToLower(pattern)
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("%s:%d: invalid pattern %q: %v", path, n, pattern, err)
+			}
+			list.Patterns = append(list.Patterns, pattern)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ignore file %s: %v", path, err)
+		}
+	}
+	return list, nil
+}
+
+// Match reports whether a target matches any pattern. Patterns are tried
+// against the whole target and against its bare host, read as
+// utils.TargetHost does, so "*.cloudfront.net" also skips
+// https://d1.cloudfront.net/app.js and d1.cloudfront.net/app.js. Matching
+// ignores case.
+func (l *IgnoreList) Match(target string) bool {
+	if l == nil || len(l.Patterns) == 0 {
+		return false
+	}
+	target = strings.ToLower(strings.TrimSpace(target))
+	host := utils.TargetHost(target)
+
+	for _, pattern := range l.Patterns {
+		if ok, _ := filepath.Match(pattern, target); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
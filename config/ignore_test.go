@@ -0,0 +1,36 @@
+package config
+
+import "testing"
+
+func TestIgnoreListMatch(t *testing.T) {
+	list := &IgnoreList{Patterns: []string{"*.cloudfront.net", "cdn.example.com", "192.0.2.*", "*/logout"}}
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{"d1.cloudfront.net", true},
+		{"D1.CloudFront.net", true},
+		{"https://d1.cloudfront.net/app.js", true},
+		{"d1.cloudfront.net/app.js", true},
+		{"d1.cloudfront.net:8443/app.js?v=1", true},
+		{"d1.cloudfront.net:8443", true},
+		{"cdn.example.com/admin", true},
+		{"http://cdn.example.com:8080/", true},
+		{"192.0.2.7", true},
+		{"192.0.2.7:8080", true},
+		{"192.0.2.7/login", true},
+		{"app.example.com/logout", true},
+		{"cloudfront.net", false},
+		{"example.com/admin", false},
+		{"app.example.com", false},
+		{"https://app.example.com/cdn.example.com", false},
+	}
+	for _, tt := range tests {
+		if got := list.Match(tt.target); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.target, got, tt.want)
+		}
+	}
+	if (*IgnoreList)(nil).Match("d1.cloudfront.net") {
+		t.Error("a nil list matched")
+	}
+}
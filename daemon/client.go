@@ -0,0 +1,117 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"ferri/ingest"
+	"ferri/processors"
+)
+
+// dialTimeout bounds connecting to a daemon, which answers at once or not
+// at all
+const dialTimeout = time.Second
+
+// Dial connects to the daemon listening on path. A stale socket file left
+// by a daemon that is gone fails like a missing one.
+func Dial(path string) (*net.UnixConn, error) {
+	conn, err := net.DialTimeout("unix", path, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.UnixConn), nil
+}
+
+// remoteError is an ingest error reported by the daemon. It unwraps to the
+// matching sentinel error, so errors.Is works as for a local ingest.
+type remoteError struct {
+	msg      string
+	sentinel error
+}
+
+func (e *remoteError) Error() string { return e.msg }
+func (e *remoteError) Unwrap() error { return e.sentinel }
+
+// Ingest sends r to the daemon behind conn as the input of req and returns
+// the result of the ingest. Canceling ctx ends the input where it is, so
+// the daemon keeps what it committed and reports the ingest interrupted.
+func Ingest(ctx context.Context, conn *net.UnixConn, req Request, r io.Reader) (*ingest.Result, error) {
+	defer conn.Close()
+	req.Version = ProtocolVersion
+
+	header, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode daemon request: %v", err)
+	}
+	if err := writeFrame(conn, header); err != nil {
+		return nil, fmt.Errorf("failed to send daemon request: %v", err)
+	}
+
+	sent := make(chan error, 1)
+	go func() {
+		sent <- sendInput(conn, r)
+	}()
+	select {
+	case err := <-sent:
+		if err != nil {
+			return nil, err
+		}
+	case <-ctx.Done():
+		// Closing the write side without the final empty frame tells
+		// the daemon the input ended early
+		conn.CloseWrite()
+	}
+
+	payload, err := readFrame(conn, nil)
+	if err != nil {
+		return nil, fmt.Errorf("daemon did not answer: %v", err)
+	}
+	var resp Response
+	if err := json.Unmarshal(payload, &resp); err != nil {
+		return nil, fmt.Errorf("invalid daemon response: %v", err)
+	}
+	if resp.Error != "" {
+		rerr := &remoteError{msg: resp.Error}
+		switch resp.Kind {
+		case kindInvalidProgramDomain:
+			rerr.sentinel = processors.ErrInvalidProgramDomain
+		case kindProgramNotFound:
+			rerr.sentinel = processors.ErrProgramNotFound
+		case kindBinaryInput:
+			rerr.sentinel = ingest.ErrBinaryInput
+		}
+		return nil, rerr
+	}
+	if resp.Result == nil {
+		return nil, fmt.Errorf("daemon sent no result")
+	}
+	return resp.Result, nil
+}
+
+// sendInput copies r to conn as data frames followed by the empty frame
+// ending the input
+func sendInput(conn *net.UnixConn, r io.Reader) error {
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if werr := writeFrame(conn, buf[:n]); werr != nil {
+				return fmt.Errorf("failed to send input to daemon: %v", werr)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read input: %v", err)
+		}
+	}
+	if err := writeFrame(conn, nil); err != nil {
+		return fmt.Errorf("failed to send input to daemon: %v", err)
+	}
+	return nil
+}
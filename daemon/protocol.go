@@ -0,0 +1,145 @@
+// Package daemon lets one ferri process own the database while others send
+// it their input over a Unix socket, so parallel pipelines never compete
+// for SQLite's write lock.
+//
+// A connection carries one ingest. Every message is a frame: a 4-byte
+// big-endian length followed by that many bytes. The client sends a JSON
+// Request, then the input as data frames and an empty frame ending it; the
+// daemon answers with a single JSON Response once the ingest is done.
+package daemon
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"ferri/ingest"
+)
+
+const (
+	// ProtocolVersion is sent with every request; the daemon refuses
+	// clients speaking another version. Version 2 sends the client's
+	// ignore patterns.
+	ProtocolVersion = 2
+	// maxFrameSize bounds a single frame
+	maxFrameSize = 1024 * 1024
+	// chunkSize is how much input a client sends per data frame
+	chunkSize = 64 * 1024
+)
+
+// Error kinds in a Response, so clients can tell the failures ingest
+// reports with sentinel errors apart
+const (
+	kindInvalidProgramDomain = "invalid_program_domain"
+	kindProgramNotFound      = "program_not_found"
+	kindBinaryInput          = "binary_input"
+)
+
+// Request opens an ingest on the daemon. The fields mirror ingest.Options.
+// Settings not carried here, such as the config file's severity_map and
+// target_types, are the daemon's own.
+type Request struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	// Tool overrides the tool of the input, like ingest.Options.Tool;
+	// InputTool is the one detected by the client, like ingest.Input.Tool
+	Tool           string `json:"tool,omitempty"`
+	InputTool      string `json:"input_tool,omitempty"`
+	ProgramName    string `json:"program_name,omitempty"`
+	ProgramScope   string `json:"program_scope,omitempty"`
+	DefaultProgram string `json:"default_program,omitempty"`
+	CommentPrefix  string `json:"comment_prefix"`
+	AllowBinary    bool   `json:"allow_binary,omitempty"`
+	DryRun         bool   `json:"dry_run,omitempty"`
+	NoNotify       bool   `json:"no_notify,omitempty"`
+	Workers        int    `json:"workers,omitempty"`
+	MaxLines       int    `json:"max_lines,omitempty"`
+	// Ignore holds the patterns of the client's .ferriignore files, which
+	// depend on its working directory, in place of ingest.Options.Ignore
+	Ignore []string `json:"ignore,omitempty"`
+}
+
+// Response reports how an ingest ended: its result, or why it failed
+type Response struct {
+	Result *ingest.Result `json:"result,omitempty"`
+	Error  string         `json:"error,omitempty"`
+	Kind   string         `json:"kind,omitempty"`
+}
+
+// errFrameTooLarge is returned for frames longer than maxFrameSize
+var errFrameTooLarge = errors.New("frame exceeds the maximum size")
+
+// writeFrame sends payload as one frame
+func writeFrame(w io.Writer, payload []byte) error {
+	if len(payload) > maxFrameSize {
+		return errFrameTooLarge
+	}
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(payload)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// readFrame reads one frame, reusing buf if it is large enough
+func readFrame(r io.Reader, buf []byte) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxFrameSize {
+		return nil, errFrameTooLarge
+	}
+	if cap(buf) < int(size) {
+		buf = make([]byte, size)
+	}
+	buf = buf[:size]
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// frameReader reads the input of a request from its data frames. It
+// reports io.EOF at the empty frame ending the input, and any other error,
+// such as the client going away mid-input, through failed.
+type frameReader struct {
+	r      io.Reader
+	buf    []byte
+	rest   []byte
+	done   bool
+	failed func(error)
+}
+
+func (f *frameReader) Read(p []byte) (int, error) {
+	for len(f.rest) == 0 {
+		if f.done {
+			return 0, io.EOF
+		}
+		frame, err := readFrame(f.r, f.buf)
+		if err != nil {
+			f.done = true
+			err = fmt.Errorf("client input ended early: %v", err)
+			if f.failed != nil {
+				f.failed(err)
+			}
+			return 0, err
+		}
+		f.buf = frame
+		if len(frame) == 0 {
+			f.done = true
+			return 0, io.EOF
+		}
+		f.rest = frame
+	}
+	n := copy(p, f.rest)
+	f.rest = f.rest[n:]
+	return n, nil
+}
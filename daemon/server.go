@@ -0,0 +1,153 @@
+package daemon
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"ferri/config"
+	"ferri/ingest"
+	"ferri/notify"
+	"ferri/processors"
+	"ferri/utils"
+)
+
+// Server ingests what clients send over a Unix socket into its database.
+// Ingests run one at a time; a client waiting its turn is simply not read
+// from, which blocks the pipeline feeding it rather than the database.
+type Server struct {
+	db *sql.DB
+	// Notifier and Warnf apply to every ingest, like the options of the
+	// same name of ingest.Options
+	Notifier *notify.Notifier
+	Warnf    func(format string, args ...any)
+
+	mu    sync.Mutex
+	conns sync.WaitGroup
+}
+
+// New returns a server writing into db
+func New(db *sql.DB) *Server {
+	return &Server{db: db}
+}
+
+// Serve accepts clients on l until ctx is canceled, then waits for the
+// ingests in progress. Those are canceled too, keeping what they committed.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	stop := context.AfterFunc(ctx, func() { l.Close() })
+	defer stop()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.conns.Wait()
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept client: %v", err)
+		}
+		s.conns.Add(1)
+		go func() {
+			defer s.conns.Done()
+			defer conn.Close()
+			s.handle(ctx, conn)
+		}()
+	}
+}
+
+// handle runs the ingest a client asks for and sends back its outcome
+func (s *Server) handle(ctx context.Context, conn net.Conn) {
+	header, err := readFrame(conn, nil)
+	if err == io.EOF {
+		return // A probe, such as a daemon checking for a running one
+	} else if err != nil {
+		s.warnf("⚠️  Dropping client: %v\n", err)
+		return
+	}
+	var req Request
+	if err := json.Unmarshal(header, &req); err != nil {
+		s.reply(conn, Response{Error: fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+	if req.Version != ProtocolVersion {
+		s.reply(conn, Response{Error: fmt.Sprintf("client speaks protocol v%d, this daemon v%d; upgrade the older ferri", req.Version, ProtocolVersion)})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// A client that goes away mid-input cancels its ingest like Ctrl-C
+	// would: committed batches are kept
+	runCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	input := &frameReader{r: conn, failed: cancel}
+
+	utils.Statusf("📡 Ingesting %s from a client\n", req.Name)
+	opts := ingest.Options{
+		Tool:           req.Tool,
+		ProgramName:    req.ProgramName,
+		ProgramScope:   req.ProgramScope,
+		DefaultProgram: req.DefaultProgram,
+		Ignore:         &config.IgnoreList{Patterns: req.Ignore},
+		CommentPrefix:  req.CommentPrefix,
+		AllowBinary:    req.AllowBinary,
+		DryRun:         req.DryRun,
+		Workers:        max(req.Workers, 1),
+		MaxLines:       req.MaxLines,
+		Warnf:          s.Warnf,
+	}
+	if !req.NoNotify && !req.DryRun {
+		opts.Notifier = s.Notifier
+	}
+	result, err := ingest.Run(runCtx, s.db, []ingest.Input{{Name: req.Name, Reader: input, Tool: req.InputTool}}, opts)
+
+	// Drain what is left of the input so the client is not stuck writing
+	// it before it reads the response, unless the daemon is stopping
+	for !input.done && ctx.Err() == nil {
+		if _, err := input.Read(make([]byte, chunkSize)); err != nil {
+			break
+		}
+	}
+
+	resp := Response{Result: result}
+	if err != nil {
+		resp = Response{Error: err.Error()}
+		switch {
+		case errors.Is(err, processors.ErrInvalidProgramDomain):
+			resp.Kind = kindInvalidProgramDomain
+		case errors.Is(err, processors.ErrProgramNotFound):
+			resp.Kind = kindProgramNotFound
+		case errors.Is(err, ingest.ErrBinaryInput):
+			resp.Kind = kindBinaryInput
+		}
+		s.warnf("⚠️  Ingest of %s failed: %v\n", req.Name, err)
+	} else {
+		utils.Statusf("✅ %s: processed %d/%d targets for program %s\n",
+			req.Name, result.Processed, result.Total, result.ProgramName)
+	}
+	s.reply(conn, resp)
+}
+
+// reply sends resp to the client
+func (s *Server) reply(conn net.Conn, resp Response) {
+	payload, err := json.Marshal(resp)
+	if err == nil {
+		err = writeFrame(conn, payload)
+	}
+	if err != nil {
+		s.warnf("⚠️  Failed to answer client: %v\n", err)
+	}
+}
+
+// warnf reports through Warnf, if set
+func (s *Server) warnf(format string, args ...any) {
+	if s.Warnf != nil {
+		s.Warnf(format, args...)
+	}
+}
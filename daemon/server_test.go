@@ -0,0 +1,122 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ferri/database"
+	"ferri/ingest"
+	"ferri/processors"
+	"ferri/utils"
+)
+
+// startServer runs a server on a fresh database and returns its socket
+func startServer(t *testing.T) string {
+	t.Helper()
+	status := utils.Status
+	utils.Status = io.Discard
+	t.Cleanup(func() { utils.Status = status })
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bounty.db")
+	if err := database.EnsureDBExists(path); err != nil {
+		t.Fatal(err)
+	}
+	db, err := database.InitDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "ferri.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- New(db).Serve(ctx, l) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+		db.Close()
+	})
+	return socket
+}
+
+func TestIngest(t *testing.T) {
+	tests := []struct {
+		name           string
+		req            Request
+		input          string
+		createPrograms bool
+		wantProcessed  int
+		wantIgnored    int
+		wantErr        error
+	}{
+		{
+			name:           "targets are stored",
+			input:          "a.example.com\nb.example.com\n",
+			createPrograms: true,
+			wantProcessed:  2,
+		},
+		{
+			name:           "client's ignore patterns apply",
+			req:            Request{Ignore: []string{"*.cdn.example.com", "example.com/admin*"}},
+			input:          "a.example.com\nx.cdn.example.com\nexample.com/admin\n",
+			createPrograms: true,
+			wantProcessed:  1,
+			wantIgnored:    2,
+		},
+		{
+			name:           "unnamable target",
+			input:          "localhost\n",
+			createPrograms: true,
+			wantErr:        processors.ErrInvalidProgramDomain,
+		},
+		{
+			name:    "missing program",
+			req:     Request{ProgramName: "acme"},
+			input:   "a.example.com\n",
+			wantErr: processors.ErrProgramNotFound,
+		},
+		{
+			name:           "binary input",
+			input:          "\x00\x01\x02\x03pcap\x00\x00\x00",
+			createPrograms: true,
+			wantErr:        ingest.ErrBinaryInput,
+		},
+	}
+	defer func(create bool) { processors.CreatePrograms = create }(processors.CreatePrograms)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processors.CreatePrograms = tt.createPrograms
+			socket := startServer(t)
+			conn, err := Dial(socket)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := tt.req
+			req.Name = "test"
+			result, err := Ingest(context.Background(), conn, req, strings.NewReader(tt.input))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Ingest error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Ingest: %v", err)
+			}
+			if result.Processed != tt.wantProcessed || result.Ignored != tt.wantIgnored {
+				t.Errorf("processed %d and ignored %d targets, want %d and %d",
+					result.Processed, result.Ignored, tt.wantProcessed, tt.wantIgnored)
+			}
+		})
+	}
+}
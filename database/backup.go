@@ -0,0 +1,82 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"ferri/utils"
+)
+
+// ConfirmMigration is asked before InitDB migrates an existing database to
+// a newer schema; answering false leaves the database untouched. When nil,
+// databases are migrated without asking.
+var ConfirmMigration func(from, to int) bool
+
+// ErrMigrationDeclined is returned by InitDB when ConfirmMigration declined
+// a pending migration
+var ErrMigrationDeclined = errors.New("schema migration declined; the database was left unchanged")
+
+// BackupPath returns where the copy of a database taken before migrating it
+// from schema version is kept, or "" for in-memory databases
+func BackupPath(dbPath string, version int) string {
+	file := dbFile(expandPath(dbPath))
+	if file == "" || file == ":memory:" || strings.Contains(dbPath, "mode=memory") {
+		return ""
+	}
+	return fmt.Sprintf("%s.v%d.bak", file, version)
+}
+
+// Backup writes a consistent copy of the database to path with VACUUM INTO,
+// which also captures changes still in a WAL file
+func Backup(db *sql.DB, path string) error {
+	if _, err := db.Exec("VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("failed to back up database to %s: %v", path, err)
+	}
+	return nil
+}
+
+// prepareMigration asks ConfirmMigration about a pending migration of an
+// existing database and backs the database up before it is changed. A
+// backup already taken at the same version, as a failed migration leaves
+// behind, is kept rather than replaced, since it predates the attempt.
+// New databases are migrated by EnsureDBExists, so a version 0 one with a
+// targets table predates the migrations and is treated like any other;
+// only a file with no schema at all has nothing to confirm.
+func prepareMigration(db *sql.DB, dbPath string) error {
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	latest := LatestSchemaVersion()
+	if version >= latest {
+		return nil // Current databases have nothing to confirm
+	}
+	if version == 0 {
+		exists, err := tableExists(db, "targets")
+		if err != nil {
+			return err
+		} else if !exists {
+			return nil // An empty file, given its schema by VerifySchema
+		}
+	}
+	if ConfirmMigration != nil && !ConfirmMigration(version, latest) {
+		return fmt.Errorf("%w (still at schema v%d, this ferri needs v%d)", ErrMigrationDeclined, version, latest)
+	}
+
+	path := BackupPath(dbPath, version)
+	if path == "" {
+		return nil
+	}
+	if _, err := os.Stat(path); err == nil {
+		utils.Statusf("💾 Keeping existing backup %s\n", path)
+		return nil
+	}
+	if err := Backup(db, path); err != nil {
+		return err
+	}
+	utils.Statusf("💾 Backed up schema v%d database to %s before migrating to v%d\n", version, path, latest)
+	return nil
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// baselineDB creates a database with the schema ferri had before
+// migrations existed, at user_version 0, holding one target
+func baselineDB(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bounty.db")
+	db, err := open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := InitSchema(db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO programs (name) VALUES ('example')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO targets (program_id, target, type) VALUES (1, 'a.example.com', 'subdomain')"); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// emptyDB creates a database file with no schema at all
+func emptyDB(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bounty.db")
+	db, err := open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("VACUUM"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	return path
+}
+
+func TestInitDBConfirmsAndBacksUp(t *testing.T) {
+	tests := []struct {
+		name        string
+		create      func(t *testing.T) string
+		wantConfirm bool
+	}{
+		{"baseline database at version 0", baselineDB, true},
+		{"empty file", emptyDB, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.create(t)
+			confirmed := false
+			ConfirmMigration = func(from, to int) bool {
+				confirmed = true
+				if from != 0 || to != LatestSchemaVersion() {
+					t.Errorf("ConfirmMigration(%d, %d), want (0, %d)", from, to, LatestSchemaVersion())
+				}
+				return true
+			}
+			defer func() { ConfirmMigration = nil }()
+
+			db, err := InitDB(path)
+			if err != nil {
+				t.Fatalf("InitDB: %v", err)
+			}
+			db.Close()
+
+			if confirmed != tt.wantConfirm {
+				t.Errorf("confirmed = %v, want %v", confirmed, tt.wantConfirm)
+			}
+			_, err = os.Stat(BackupPath(path, 0))
+			if backedUp := err == nil; backedUp != tt.wantConfirm {
+				t.Errorf("backed up = %v, want %v", backedUp, tt.wantConfirm)
+			}
+		})
+	}
+}
+
+func TestInitDBDeclinedLeavesBaselineUnchanged(t *testing.T) {
+	path := baselineDB(t)
+	ConfirmMigration = func(from, to int) bool { return false }
+	defer func() { ConfirmMigration = nil }()
+
+	if _, err := InitDB(path); err == nil {
+		t.Fatal("InitDB migrated a database whose migration was declined")
+	}
+	db, err := open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if version, err := SchemaVersion(db); err != nil || version != 0 {
+		t.Errorf("schema version = %d, %v; want 0", version, err)
+	}
+	if _, err := os.Stat(BackupPath(path, 0)); err == nil {
+		t.Error("a declined migration left a backup")
+	}
+}
@@ -2,12 +2,13 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings" // Add this import
 
-	_ "github.com/mattn/go-sqlite3"
+	"ferri/utils"
 )
 
 // DB is the global database connection
@@ -16,50 +17,134 @@ var DB *sql.DB
 // Default database path
 const DefaultDBPath = "~/bugbounty/db/bounty.db"
 
-// EnsureDBExists creates the database file and schema if it doesn't exist
+// IsDSN reports whether a database location is a go-sqlite3 DSN such as
+// file:bounty.db?_journal=WAL rather than a plain path
+func IsDSN(dbPath string) bool {
+	return strings.HasPrefix(dbPath, "file:") || strings.Contains(dbPath, "?")
+}
+
+// dataSource returns what sql.Open is given for a database location. DSNs
+// are passed through unchanged, so they must bring their own options;
+// plain paths get connParams.
+func dataSource(dbPath string) string {
+	if IsDSN(dbPath) {
+		return dbPath
+	}
+	return dbPath + connParams
+}
+
+// dbFile returns the file a database location refers to
+func dbFile(dbPath string) string {
+	if !IsDSN(dbPath) {
+		return dbPath
+	}
+	file := strings.TrimPrefix(dbPath, "file:")
+	if i := strings.Index(file, "?"); i >= 0 {
+		file = file[:i]
+	}
+	return file
+}
+
+// SocketPath returns the Unix socket a ferri daemon owning the database
+// listens on by default, next to the database file, or "" for in-memory
+// databases
+func SocketPath(dbPath string) string {
+	file := dbFile(expandPath(dbPath))
+	if file == "" || file == ":memory:" || strings.Contains(dbPath, "mode=memory") {
+		return ""
+	}
+	return file + ".sock"
+}
+
+// EnsureDBExists creates the database file and schema if it doesn't exist.
+// The schema is built in a temporary file that is moved into place only
+// once it is complete, so a run killed halfway never leaves behind a file
+// that looks like a database but has no tables. A zero-byte file, as such a
+// run of an older version may have left, is initialized the same way.
 func EnsureDBExists(dbPath string) error {
 	dbPath = expandPath(dbPath)
+	file := dbFile(dbPath)
 	
 	// Create directory if it doesn't exist
-	dir := filepath.Dir(dbPath)
+	dir := filepath.Dir(file)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("failed to create directory %s: %v", dir, err)
 	}
 
 	// Check if database already exists
-	if _, err := os.Stat(dbPath); err == nil {
+	info, err := os.Stat(file)
+	if err == nil && info.Size() > 0 {
 		return nil // Database already exists
 	}
+	if file == "" || file == ":memory:" || strings.Contains(dbPath, "mode=memory") {
+		return nil // In-memory databases have no file to create
+	}
+	empty := err == nil
+	if empty {
+		utils.Statusf("📁 Database file is empty, initializing: %s\n", file)
+	} else {
+		utils.Statusf("📁 Database not found, creating: %s\n", file)
+	}
 
-	fmt.Printf("📁 Database not found, creating: %s\n", dbPath)
-	
-	// Create an empty file
-	file, err := os.Create(dbPath)
+	tmp, err := os.CreateTemp(dir, filepath.Base(file)+".*.tmp")
 	if err != nil {
 		return fmt.Errorf("failed to create database file: %v", err)
 	}
-	file.Close()
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	// Match the permissions os.Create would have given the file
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to create database file: %v", err)
+	}
+
+	utils.Statusf("📊 Initializing database schema...\n")
+	if err := initFile(withFile(dbPath, tmp.Name())); err != nil {
+		return err
+	}
 
-	// Open database
-	db, err := sql.Open("sqlite3", dbPath)
+	// Link rather than rename a new file into place, so a database another
+	// process created in the meantime is never replaced
+	if empty {
+		err = os.Rename(tmp.Name(), file)
+	} else if err = os.Link(tmp.Name(), file); os.IsExist(err) {
+		err = nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to open database: %v", err)
+		return fmt.Errorf("failed to move database into place: %v", err)
 	}
-	defer db.Close()
+	utils.Statusf("✅ Database created and schema initialized successfully\n")
 
-	// Test connection
-	if err := db.Ping(); err != nil {
-		return fmt.Errorf("database ping failed: %v", err)
+	return nil
+}
+
+// initFile creates the schema in the database at dbPath and brings it to
+// the latest version
+func initFile(dbPath string) error {
+	db, err := open(dbPath)
+	if err != nil {
+		return err
 	}
+	defer db.Close()
 
-	// Initialize schema
-	fmt.Printf("📊 Initializing database schema...\n")
 	if err := InitSchema(db); err != nil {
 		return fmt.Errorf("failed to initialize schema: %v", err)
 	}
-	fmt.Printf("✅ Database created and schema initialized successfully\n")
+	if err := Migrate(db); err != nil {
+		return fmt.Errorf("failed to migrate database: %v", err)
+	}
+	return db.Close()
+}
 
-	return nil
+// withFile returns dbPath pointing at another file, keeping a DSN's options
+func withFile(dbPath, file string) string {
+	if !IsDSN(dbPath) {
+		return file
+	}
+	query := ""
+	if i := strings.Index(dbPath, "?"); i >= 0 {
+		query = dbPath[i:]
+	}
+	return "file:" + file + query
 }
 
 // InitDB initializes the database connection
@@ -67,26 +152,67 @@ func InitDB(dbPath string) (*sql.DB, error) {
 	dbPath = expandPath(dbPath)
 	
 	var err error
-	DB, err = sql.Open("sqlite3", dbPath)
+	DB, err = open(dbPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %v", err)
+		return nil, err
 	}
 
-	// Test connection
-	if err := DB.Ping(); err != nil {
-		return nil, fmt.Errorf("database ping failed: %v", err)
+	// Bring older databases up to the current schema, once confirmed and
+	// backed up. This looks at the schema as found, before VerifySchema
+	// fills in an empty file.
+	if err := prepareMigration(DB, dbPath); err != nil {
+		DB.Close()
+		return nil, err
+	}
+
+	// A foreign or partially created file may lack the core tables
+	if err := VerifySchema(DB); err != nil {
+		DB.Close()
+		return nil, err
+	}
+	if err := Migrate(DB); err != nil {
+		DB.Close()
+		return nil, fmt.Errorf("failed to migrate database: %v", err)
 	}
 
 	return DB, nil
 }
 
+// errNoCGO replaces the cryptic stub error go-sqlite3 returns when ferri
+// was compiled with CGO_ENABLED=0
+var errNoCGO = errors.New("this ferri binary was built without cgo, which the SQLite driver needs; " +
+	"rebuild it with CGO_ENABLED=1 and a C compiler installed, or with -tags puresqlite for a pure-Go driver")
+
+// open opens the database at dbPath and checks the connection
+func open(dbPath string) (*sql.DB, error) {
+	db, err := sql.Open(DriverName, dataSource(dbPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", driverError(err))
+	}
+
+	// Test connection
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("database ping failed: %v", driverError(err))
+	}
+	return db, nil
+}
+
+// driverError turns the errors of a driver that cannot work in this binary
+// into errNoCGO
+func driverError(err error) error {
+	msg := err.Error()
+	if strings.Contains(msg, "CGO_ENABLED=0") || strings.Contains(msg, "unknown driver") {
+		return errNoCGO
+	}
+	return err
+}
+
+// expandPath expands a leading ~ like utils.ExpandPath, also right after
+// the file: of a DSN
 func expandPath(path string) string {
-	if strings.HasPrefix(path, "~/") {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return path // fallback to original if error
-		}
-		return filepath.Join(home, path[2:])
-	}
-	return path
+	if strings.HasPrefix(path, "file:~") {
+		return "file:" + utils.ExpandPath(strings.TrimPrefix(path, "file:"))
+	}
+	return utils.ExpandPath(path)
 }
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnsureDBExists(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, path string)
+	}{
+		{"missing file", func(t *testing.T, path string) {}},
+		{"zero-byte file", func(t *testing.T, path string) {
+			if err := os.WriteFile(path, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "bounty.db")
+			tt.prepare(t, path)
+
+			if err := EnsureDBExists(path); err != nil {
+				t.Fatalf("EnsureDBExists: %v", err)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Name() != "bounty.db" {
+				var names []string
+				for _, e := range entries {
+					names = append(names, e.Name())
+				}
+				t.Errorf("directory holds %v, want only bounty.db", names)
+			}
+
+			db, err := open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			for _, table := range coreTables {
+				if exists, err := tableExists(db, table); err != nil || !exists {
+					t.Errorf("table %s missing: %v", table, err)
+				}
+			}
+			if version, err := SchemaVersion(db); err != nil || version != LatestSchemaVersion() {
+				t.Errorf("schema version = %d, %v; want %d", version, err, LatestSchemaVersion())
+			}
+		})
+	}
+}
+
+func TestEnsureDBExistsKeepsExistingDatabase(t *testing.T) {
+	path := baselineDB(t)
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := EnsureDBExists(path); err != nil {
+		t.Fatalf("EnsureDBExists: %v", err)
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Error("EnsureDBExists changed a database that already existed")
+	}
+}
+
+func TestInitDBClosesOnFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		create  func(t *testing.T) string
+		confirm bool
+	}{
+		{"migrated database missing a core table", func(t *testing.T) string {
+			path := filepath.Join(t.TempDir(), "bounty.db")
+			if err := EnsureDBExists(path); err != nil {
+				t.Fatal(err)
+			}
+			db, err := open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if _, err := db.Exec("DROP TABLE recon_data"); err != nil {
+				t.Fatal(err)
+			}
+			return path
+		}, false},
+		{"migration failing", func(t *testing.T) string {
+			path := baselineDB(t)
+			db, err := open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			// The first migration creates this index on a column the
+			// table no longer has
+			if _, err := db.Exec("CREATE TABLE idx_targets_parent (id INTEGER)"); err != nil {
+				t.Fatal(err)
+			}
+			return path
+		}, true},
+		{"migration declined", baselineDB, false},
+	}
+	defer func() { ConfirmMigration = nil }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.create(t)
+			ConfirmMigration = func(from, to int) bool { return tt.confirm }
+			if _, err := InitDB(path); err == nil {
+				t.Fatal("InitDB succeeded")
+			}
+			if err := DB.Ping(); err == nil || err.Error() != "sql: database is closed" {
+				t.Errorf("connection left open after InitDB failed (Ping: %v)", err)
+			}
+		})
+	}
+}
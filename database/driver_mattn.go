@@ -0,0 +1,15 @@
+//go:build !puresqlite
+
+package database
+
+import _ "github.com/mattn/go-sqlite3"
+
+// DriverName is the database/sql driver ferri opens databases with
+const DriverName = "sqlite3"
+
+// connParams are appended to the database path when opening it. The busy
+// timeout makes SQLite wait for a competing writer instead of failing
+// immediately with SQLITE_BUSY, and immediate transactions take the write
+// lock up front so two batches can never deadlock upgrading read locks.
+// Stored times are read back as UTC, matching CURRENT_TIMESTAMP.
+const connParams = "?_busy_timeout=5000&_txlock=immediate&_loc=UTC"
@@ -0,0 +1,140 @@
+//go:build puresqlite
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// DriverName is the database/sql driver ferri opens databases with. Built
+// with -tags puresqlite, that is modernc.org/sqlite, which needs no cgo,
+// wrapped so times read back in UTC.
+const DriverName = "ferri-sqlite"
+
+// connParams are modernc.org/sqlite's spelling of the mattn/go-sqlite3
+// options: a busy timeout, immediate transactions, and times written in
+// SQLite's own format so both drivers read each other's databases.
+// modernc.org/sqlite has no _loc; utcRows stands in for it.
+const connParams = "?_pragma=busy_timeout(5000)&_txlock=immediate&_time_format=sqlite"
+
+func init() {
+	sql.Register(DriverName, utcDriver{&sqlite.Driver{}})
+}
+
+// IsTransient reports whether err is a lock error worth retrying
+func IsTransient(err error) bool {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		// Extended codes such as SQLITE_BUSY_SNAPSHOT keep the primary
+		// code in the low byte
+		code := sqliteErr.Code() & 0xff
+		return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+	}
+	return false
+}
+
+// modernConn, modernStmt and modernRows are the driver interfaces
+// modernc.org/sqlite's connections, statements and rows implement
+type modernConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+type modernStmt interface {
+	driver.Stmt
+	driver.StmtExecContext
+	driver.StmtQueryContext
+}
+
+type modernRows interface {
+	driver.Rows
+	driver.RowsColumnTypeDatabaseTypeName
+	driver.RowsColumnTypeLength
+	driver.RowsColumnTypeNullable
+	driver.RowsColumnTypePrecisionScale
+	driver.RowsColumnTypeScanType
+}
+
+// utcDriver is modernc.org/sqlite reading times back in UTC. It parses a
+// stored "+00:00" offset into a nameless fixed zone, which compares equal
+// but is not time.UTC, unlike go-sqlite3 with _loc=UTC.
+type utcDriver struct {
+	*sqlite.Driver
+}
+
+func (d utcDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return utcConn{c.(modernConn)}, nil
+}
+
+type utcConn struct {
+	modernConn
+}
+
+func (c utcConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c utcConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	s, err := c.modernConn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return utcStmt{s.(modernStmt)}, nil
+}
+
+func (c utcConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return utcRowsOf(c.modernConn.QueryContext(ctx, query, args))
+}
+
+type utcStmt struct {
+	modernStmt
+}
+
+func (s utcStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return utcRowsOf(s.modernStmt.Query(args))
+}
+
+func (s utcStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return utcRowsOf(s.modernStmt.QueryContext(ctx, args))
+}
+
+// utcRows converts every time it reads to UTC
+type utcRows struct {
+	modernRows
+}
+
+func utcRowsOf(rows driver.Rows, err error) (driver.Rows, error) {
+	if err != nil {
+		return nil, err
+	}
+	return utcRows{rows.(modernRows)}, nil
+}
+
+func (r utcRows) Next(dest []driver.Value) error {
+	if err := r.modernRows.Next(dest); err != nil {
+		return err
+	}
+	for i, v := range dest {
+		if t, ok := v.(time.Time); ok {
+			dest[i] = t.UTC()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,435 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migration is a single schema change applied on top of the base schema
+type migration struct {
+	description string
+	statements  []string
+}
+
+// migrations lists every schema change in order. The database's
+// user_version pragma records how many of them have been applied, so
+// entries must only ever be appended, never reordered or edited.
+var migrations = []migration{
+	{
+		description: "link subdomains to their root domain",
+		statements: []string{
+			`ALTER TABLE targets ADD COLUMN parent_id INTEGER REFERENCES targets (id)`,
+			`CREATE INDEX IF NOT EXISTS idx_targets_parent ON targets(parent_id)`,
+		},
+	},
+	{
+		description: "add target tags",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS tags (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL UNIQUE
+			)`,
+			`CREATE TABLE IF NOT EXISTS target_tags (
+				target_id INTEGER NOT NULL,
+				tag_id INTEGER NOT NULL,
+				PRIMARY KEY (target_id, tag_id),
+				FOREIGN KEY (target_id) REFERENCES targets (id),
+				FOREIGN KEY (tag_id) REFERENCES tags (id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_target_tags_tag ON target_tags(tag_id)`,
+		},
+	},
+	{
+		// SQLite cannot change a UNIQUE constraint in place, so the table is
+		// rebuilt with the port as part of the key. Ids are kept so recon
+		// data, findings and tags stay attached.
+		description: "split ports out of host:port targets",
+		statements: []string{
+			`CREATE TABLE targets_new (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				program_id INTEGER NOT NULL,
+				target TEXT NOT NULL,
+				type TEXT,
+				source TEXT,
+				alive BOOLEAN DEFAULT 0,
+				last_checked DATETIME,
+				tested BOOLEAN DEFAULT 0,
+				tested_date DATETIME,
+				test_notes TEXT,
+				notes TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				parent_id INTEGER REFERENCES targets (id),
+				port INTEGER NOT NULL DEFAULT 0,
+				FOREIGN KEY (program_id) REFERENCES programs (id),
+				UNIQUE(program_id, target, port)
+			)`,
+			`INSERT INTO targets_new (id, program_id, target, type, source, alive, last_checked,
+				tested, tested_date, test_notes, notes, created_at, parent_id)
+			 SELECT id, program_id, target, type, source, alive, last_checked,
+				tested, tested_date, test_notes, notes, created_at, parent_id FROM targets`,
+			`DROP TABLE targets`,
+			`ALTER TABLE targets_new RENAME TO targets`,
+			`CREATE INDEX IF NOT EXISTS idx_targets_program ON targets(program_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_targets_alive ON targets(alive)`,
+			`CREATE INDEX IF NOT EXISTS idx_targets_parent ON targets(parent_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_targets_port ON targets(port)`,
+			// host:port values have exactly one colon followed by a valid port
+			`UPDATE targets SET
+				target = substr(target, 1, instr(target, ':') - 1),
+				port = CAST(substr(target, instr(target, ':') + 1) AS INTEGER)
+			 WHERE type = 'ip_port'
+				AND length(target) - length(replace(target, ':', '')) = 1
+				AND substr(target, instr(target, ':') + 1) GLOB '[0-9]*'
+				AND NOT substr(target, instr(target, ':') + 1) GLOB '*[^0-9]*'
+				AND CAST(substr(target, instr(target, ':') + 1) AS INTEGER) BETWEEN 1 AND 65535`,
+			// Reclassify the split hosts, and bare IPv4 addresses, which used
+			// to be classified by their dots as subdomains
+			`UPDATE targets SET
+				type = CASE
+					WHEN target GLOB '[0-9]*.[0-9]*.[0-9]*.[0-9]*' AND NOT target GLOB '*[^0-9.]*' THEN 'ip'
+					WHEN length(target) - length(replace(target, '.', '')) = 1 THEN 'domain'
+					WHEN length(target) - length(replace(target, '.', '')) > 1 THEN 'subdomain'
+					ELSE 'unknown'
+				END
+			 WHERE port > 0
+				OR (type = 'subdomain' AND target GLOB '[0-9]*.[0-9]*.[0-9]*.[0-9]*' AND NOT target GLOB '*[^0-9.]*')`,
+			`UPDATE targets SET parent_id = NULL WHERE type = 'ip'`,
+		},
+	},
+	{
+		description: "store DNS records of resolved targets",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS dns_records (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				target_id INTEGER NOT NULL,
+				type TEXT NOT NULL,
+				value TEXT NOT NULL,
+				resolved_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (target_id) REFERENCES targets (id),
+				UNIQUE(target_id, type, value)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_dns_records_value ON dns_records(value)`,
+		},
+	},
+	{
+		description: "store times in UTC",
+		statements: []string{
+			utcStatement("programs", "created_at"),
+			utcStatement("targets", "last_checked"),
+			utcStatement("targets", "tested_date"),
+			utcStatement("targets", "created_at"),
+			utcStatement("recon_data", "timestamp"),
+			utcStatement("findings", "reported_date"),
+			utcStatement("findings", "created_at"),
+			utcStatement("dns_records", "resolved_at"),
+		},
+	},
+	{
+		description: "map alternate root domains to programs",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS program_aliases (
+				domain TEXT PRIMARY KEY,
+				program_id INTEGER NOT NULL,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (program_id) REFERENCES programs (id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_program_aliases_program ON program_aliases(program_id)`,
+		},
+	},
+	{
+		description: "store technologies detected on targets",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS technologies (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				target_id INTEGER NOT NULL,
+				name TEXT NOT NULL COLLATE NOCASE,
+				version TEXT,
+				FOREIGN KEY (target_id) REFERENCES targets (id),
+				UNIQUE(target_id, name)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_technologies_name ON technologies(name)`,
+		},
+	},
+	{
+		description: "track response body hashes to detect changed pages",
+		statements: []string{
+			`ALTER TABLE targets ADD COLUMN body_hash TEXT`,
+			`ALTER TABLE targets ADD COLUMN changed BOOLEAN DEFAULT 0`,
+		},
+	},
+	{
+		description: "index findings by severity, status and target",
+		statements: []string{
+			`CREATE INDEX IF NOT EXISTS idx_findings_severity ON findings(severity)`,
+			`CREATE INDEX IF NOT EXISTS idx_findings_status ON findings(status)`,
+			`CREATE INDEX IF NOT EXISTS idx_findings_target ON findings(target_id)`,
+		},
+	},
+	{
+		description: "record alive/dead transitions of targets",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS target_status_history (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				target_id INTEGER NOT NULL,
+				alive BOOLEAN NOT NULL,
+				checked_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (target_id) REFERENCES targets (id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_target_status_history_target ON target_status_history(target_id)`,
+		},
+	},
+	{
+		description: "record which ingest run stored each target and recon row",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS runs (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				finished_at DATETIME,
+				tool TEXT,
+				source TEXT,
+				program_id INTEGER,
+				target_count INTEGER NOT NULL DEFAULT 0,
+				FOREIGN KEY (program_id) REFERENCES programs (id)
+			)`,
+			`ALTER TABLE targets ADD COLUMN run_id INTEGER REFERENCES runs (id)`,
+			`ALTER TABLE recon_data ADD COLUMN run_id INTEGER REFERENCES runs (id)`,
+			`CREATE INDEX IF NOT EXISTS idx_targets_run ON targets(run_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_recon_data_run ON recon_data(run_id)`,
+		},
+	},
+	{
+		description: "allow each platform report id on one finding only",
+		statements: []string{
+			`UPDATE findings SET report_id = NULL WHERE report_id = ''`,
+			// A report id recorded on several findings stays on the first;
+			// the others note where it went
+			`UPDATE findings SET
+				notes = CASE WHEN notes IS NULL OR notes = '' THEN '' ELSE notes || char(10) END
+					|| 'Report ID ' || report_id || ' is recorded on finding #' || (SELECT MIN(k.id) FROM findings k WHERE k.report_id = findings.report_id),
+				report_id = NULL
+				WHERE report_id IS NOT NULL AND id != (SELECT MIN(k.id) FROM findings k WHERE k.report_id = findings.report_id)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_findings_report_id ON findings(report_id) WHERE report_id IS NOT NULL`,
+		},
+	},
+	{
+		description: "key findings by target, title and type",
+		statements: []string{
+			// Earlier duplicates are kept apart by their id rather than
+			// deleted, as they may carry notes
+			`UPDATE findings SET title = title || ' (#' || id || ')'
+				WHERE id NOT IN (SELECT MIN(id) FROM findings GROUP BY target_id, title, COALESCE(type, ''))`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_findings_key ON findings(target_id, title, COALESCE(type, ''))`,
+		},
+	},
+	{
+		description: "merge programs whose names differ only in case",
+		statements: []string{
+			// Every program folds into the oldest one sharing its name
+			// regardless of case
+			`CREATE TEMP TABLE merge_programs AS
+				SELECT id AS old_id, (SELECT MIN(k.id) FROM programs k WHERE lower(k.name) = lower(p.name)) AS new_id
+				FROM programs p`,
+			`DELETE FROM merge_programs WHERE old_id = new_id`,
+			// A target stored under several of those programs folds into
+			// its oldest copy
+			`CREATE TEMP TABLE merge_targets AS
+				SELECT t.id AS old_id, (SELECT MIN(d.id) FROM targets d
+					WHERE d.target = t.target AND d.port = t.port
+					AND d.program_id IN (SELECT old_id FROM merge_programs WHERE new_id = m.new_id UNION SELECT m.new_id)) AS new_id
+				FROM targets t
+				JOIN (SELECT old_id AS program_id, new_id FROM merge_programs
+					UNION SELECT new_id, new_id FROM merge_programs) m ON m.program_id = t.program_id`,
+			`DELETE FROM merge_targets WHERE old_id = new_id`,
+			// Findings that would collide on the kept copy are kept apart
+			// by their id, as the findings key migration did
+			`UPDATE findings SET title = title || ' (#' || id || ')'
+				WHERE target_id IN (SELECT old_id FROM merge_targets)
+				AND EXISTS (SELECT 1 FROM findings k WHERE k.id != findings.id
+					AND k.title = findings.title AND COALESCE(k.type, '') = COALESCE(findings.type, '')
+					AND COALESCE((SELECT new_id FROM merge_targets WHERE old_id = k.target_id), k.target_id) =
+						(SELECT new_id FROM merge_targets WHERE old_id = findings.target_id))`,
+			`UPDATE findings SET target_id = (SELECT new_id FROM merge_targets WHERE old_id = findings.target_id)
+				WHERE target_id IN (SELECT old_id FROM merge_targets)`,
+			`UPDATE recon_data SET target_id = (SELECT new_id FROM merge_targets WHERE old_id = recon_data.target_id)
+				WHERE target_id IN (SELECT old_id FROM merge_targets)`,
+			`UPDATE target_status_history SET target_id = (SELECT new_id FROM merge_targets WHERE old_id = target_status_history.target_id)
+				WHERE target_id IN (SELECT old_id FROM merge_targets)`,
+			`INSERT OR IGNORE INTO target_tags (target_id, tag_id)
+				SELECT m.new_id, t.tag_id FROM target_tags t JOIN merge_targets m ON m.old_id = t.target_id`,
+			`DELETE FROM target_tags WHERE target_id IN (SELECT old_id FROM merge_targets)`,
+			`INSERT OR IGNORE INTO technologies (target_id, name, version)
+				SELECT m.new_id, t.name, t.version FROM technologies t JOIN merge_targets m ON m.old_id = t.target_id`,
+			`DELETE FROM technologies WHERE target_id IN (SELECT old_id FROM merge_targets)`,
+			`INSERT OR IGNORE INTO dns_records (target_id, type, value, resolved_at)
+				SELECT m.new_id, r.type, r.value, r.resolved_at FROM dns_records r JOIN merge_targets m ON m.old_id = r.target_id`,
+			`DELETE FROM dns_records WHERE target_id IN (SELECT old_id FROM merge_targets)`,
+			`UPDATE targets SET parent_id = (SELECT new_id FROM merge_targets WHERE old_id = targets.parent_id)
+				WHERE parent_id IN (SELECT old_id FROM merge_targets)`,
+			`UPDATE targets SET
+				alive = alive OR EXISTS (SELECT 1 FROM merge_targets m JOIN targets o ON o.id = m.old_id
+					WHERE m.new_id = targets.id AND o.alive),
+				tested = tested OR EXISTS (SELECT 1 FROM merge_targets m JOIN targets o ON o.id = m.old_id
+					WHERE m.new_id = targets.id AND o.tested),
+				notes = CASE
+					WHEN (SELECT group_concat(o.notes, char(10)) FROM merge_targets m JOIN targets o ON o.id = m.old_id
+						WHERE m.new_id = targets.id AND o.notes != '') IS NULL THEN notes
+					WHEN notes IS NULL OR notes = '' THEN (SELECT group_concat(o.notes, char(10)) FROM merge_targets m
+						JOIN targets o ON o.id = m.old_id WHERE m.new_id = targets.id AND o.notes != '')
+					ELSE notes || char(10) || (SELECT group_concat(o.notes, char(10)) FROM merge_targets m
+						JOIN targets o ON o.id = m.old_id WHERE m.new_id = targets.id AND o.notes != '')
+				END
+				WHERE id IN (SELECT new_id FROM merge_targets)`,
+			`DELETE FROM targets WHERE id IN (SELECT old_id FROM merge_targets)`,
+			`UPDATE targets SET program_id = (SELECT new_id FROM merge_programs WHERE old_id = targets.program_id)
+				WHERE program_id IN (SELECT old_id FROM merge_programs)`,
+			`UPDATE program_aliases SET program_id = (SELECT new_id FROM merge_programs WHERE old_id = program_aliases.program_id)
+				WHERE program_id IN (SELECT old_id FROM merge_programs)`,
+			`UPDATE runs SET program_id = (SELECT new_id FROM merge_programs WHERE old_id = runs.program_id)
+				WHERE program_id IN (SELECT old_id FROM merge_programs)`,
+			// The kept program fills in what it lacks from the others
+			`UPDATE programs SET
+				url = COALESCE(url, (SELECT o.url FROM merge_programs m JOIN programs o ON o.id = m.old_id
+					WHERE m.new_id = programs.id AND o.url IS NOT NULL ORDER BY o.id LIMIT 1)),
+				scope = COALESCE(scope, (SELECT o.scope FROM merge_programs m JOIN programs o ON o.id = m.old_id
+					WHERE m.new_id = programs.id AND o.scope IS NOT NULL ORDER BY o.id LIMIT 1)),
+				out_of_scope = COALESCE(out_of_scope, (SELECT o.out_of_scope FROM merge_programs m JOIN programs o ON o.id = m.old_id
+					WHERE m.new_id = programs.id AND o.out_of_scope IS NOT NULL ORDER BY o.id LIMIT 1)),
+				bounty_notes = COALESCE(bounty_notes, (SELECT o.bounty_notes FROM merge_programs m JOIN programs o ON o.id = m.old_id
+					WHERE m.new_id = programs.id AND o.bounty_notes IS NOT NULL ORDER BY o.id LIMIT 1))
+				WHERE id IN (SELECT new_id FROM merge_programs)`,
+			`DELETE FROM programs WHERE id IN (SELECT old_id FROM merge_programs)`,
+			`DROP TABLE merge_targets`,
+			`DROP TABLE merge_programs`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_programs_name_nocase ON programs(name COLLATE NOCASE)`,
+		},
+	},
+	{
+		description: "cache per-program counts for ferri stats",
+		statements:  statsCacheStatements(),
+	},
+	{
+		description: "link targets to screenshots",
+		statements: []string{
+			`ALTER TABLE targets ADD COLUMN screenshot_path TEXT`,
+		},
+	},
+	{
+		description: "keep the order of DNS records such as CNAME chains",
+		statements: []string{
+			`ALTER TABLE dns_records ADD COLUMN position INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		description: "store the HTTP status targets last answered with",
+		statements: []string{
+			`ALTER TABLE targets ADD COLUMN status_code INTEGER`,
+		},
+	},
+	{
+		description: "index recon data by target and tool",
+		statements: []string{
+			`CREATE INDEX IF NOT EXISTS idx_recon_data_target_tool ON recon_data(target_id, tool)`,
+		},
+	},
+	{
+		description: "record every run that saw a target or recon row, not only the first",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS run_targets (
+				run_id INTEGER NOT NULL REFERENCES runs (id),
+				target_id INTEGER NOT NULL REFERENCES targets (id),
+				PRIMARY KEY (run_id, target_id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_run_targets_target ON run_targets(target_id)`,
+			`INSERT OR IGNORE INTO run_targets (run_id, target_id) SELECT run_id, id FROM targets WHERE run_id IS NOT NULL`,
+			`CREATE TABLE IF NOT EXISTS run_recon_data (
+				run_id INTEGER NOT NULL REFERENCES runs (id),
+				recon_id INTEGER NOT NULL REFERENCES recon_data (id),
+				PRIMARY KEY (run_id, recon_id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_run_recon_data_recon ON run_recon_data(recon_id)`,
+			`INSERT OR IGNORE INTO run_recon_data (run_id, recon_id) SELECT run_id, id FROM recon_data WHERE run_id IS NOT NULL`,
+		},
+	},
+	{
+		description: "record which ingest runs reported each finding",
+		statements: []string{
+			`ALTER TABLE findings ADD COLUMN run_id INTEGER REFERENCES runs (id)`,
+			`CREATE INDEX IF NOT EXISTS idx_findings_run ON findings(run_id)`,
+			`CREATE TABLE IF NOT EXISTS run_findings (
+				run_id INTEGER NOT NULL REFERENCES runs (id),
+				finding_id INTEGER NOT NULL REFERENCES findings (id),
+				PRIMARY KEY (run_id, finding_id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_run_findings_finding ON run_findings(finding_id)`,
+		},
+	},
+	{
+		description: "uncount the recon data and findings of deleted targets in the stats cache",
+		statements: append([]string{
+			`DROP TRIGGER IF EXISTS stats_targets_delete`,
+			statsTargetsDeleteTrigger,
+		}, statsCacheRebuild...),
+	},
+	{
+		description: "record when ferri resolve last looked each target up",
+		statements: []string{
+			`ALTER TABLE targets ADD COLUMN resolved_at DATETIME`,
+		},
+	},
+}
+
+// utcStatement rewrites the times in a column that were stored with a zone
+// offset, as the driver writes local times, to UTC like CURRENT_TIMESTAMP
+func utcStatement(table, column string) string {
+	return fmt.Sprintf(`UPDATE %[1]s SET %[2]s = strftime('%%Y-%%m-%%d %%H:%%M:%%f', %[2]s)
+		WHERE typeof(%[2]s) = 'text' AND substr(%[2]s, -6, 1) IN ('+', '-') AND substr(%[2]s, -3, 1) = ':'`, table, column)
+}
+
+// SchemaVersion returns the number of migrations applied to the database
+func SchemaVersion(db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %v", err)
+	}
+	return version, nil
+}
+
+// LatestSchemaVersion returns the schema version this build migrates to
+func LatestSchemaVersion() int {
+	return len(migrations)
+}
+
+// Migrate applies any pending migrations, each in its own transaction
+func Migrate(db *sql.DB) error {
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		m := migrations[i]
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %v", i+1, err)
+		}
+
+		for _, stmt := range m.statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %d (%s) failed: %v", i+1, m.description, err)
+			}
+		}
+
+		// PRAGMA does not accept bound parameters
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record schema version %d: %v", i+1, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %v", i+1, err)
+		}
+	}
+
+	return nil
+}
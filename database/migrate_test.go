@@ -0,0 +1,203 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// migrateUntil returns a baseline database with the migrations before the
+// one described as description applied
+func migrateUntil(t *testing.T, description string) *sql.DB {
+	t.Helper()
+	n := -1
+	for i, m := range migrations {
+		if m.description == description {
+			n = i
+		}
+	}
+	if n < 0 {
+		t.Fatalf("no migration %q", description)
+	}
+	db, err := open(baselineDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	all := migrations
+	migrations = all[:n]
+	defer func() { migrations = all }()
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name   string
+		create func(t *testing.T) string
+	}{
+		{"new database", func(t *testing.T) string {
+			path := filepath.Join(t.TempDir(), "bounty.db")
+			if err := EnsureDBExists(path); err != nil {
+				t.Fatal(err)
+			}
+			return path
+		}},
+		{"baseline database at version 0", baselineDB},
+		{"empty file", emptyDB},
+	}
+	// Objects later migrations add, which only exist once every migration ran
+	objects := []string{
+		"tags", "target_tags", "dns_records", "program_aliases", "technologies", "target_status_history",
+		"runs", "run_targets", "run_recon_data", "run_findings",
+		"idx_targets_parent", "idx_targets_port", "idx_findings_severity", "idx_findings_key",
+		"idx_programs_name_nocase", "idx_recon_data_target_tool", "idx_run_targets_target", "idx_findings_run",
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.create(t)
+			ConfirmMigration = func(from, to int) bool { return true }
+			defer func() { ConfirmMigration = nil }()
+			db, err := InitDB(path)
+			if err != nil {
+				t.Fatalf("InitDB: %v", err)
+			}
+			defer db.Close()
+
+			if version, err := SchemaVersion(db); err != nil || version != LatestSchemaVersion() {
+				t.Errorf("schema version = %d, %v; want %d", version, err, LatestSchemaVersion())
+			}
+			for _, name := range objects {
+				var n int
+				if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = ?", name).Scan(&n); err != nil {
+					t.Fatal(err)
+				} else if n != 1 {
+					t.Errorf("%s missing after migrating", name)
+				}
+			}
+
+			// A second run has nothing left to apply
+			if err := Migrate(db); err != nil {
+				t.Errorf("Migrate on a current database: %v", err)
+			}
+			if version, _ := SchemaVersion(db); version != LatestSchemaVersion() {
+				t.Errorf("schema version = %d after migrating twice, want %d", version, LatestSchemaVersion())
+			}
+		})
+	}
+}
+
+func TestMigrateKeepsBaselineData(t *testing.T) {
+	db, err := open(baselineDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	var target, program string
+	var port int
+	err = db.QueryRow(`SELECT t.target, t.port, p.name FROM targets t JOIN programs p ON p.id = t.program_id`).
+		Scan(&target, &port, &program)
+	if err != nil {
+		t.Fatalf("baseline target lost: %v", err)
+	}
+	if target != "a.example.com" || port != 0 || program != "example" {
+		t.Errorf("target = %s:%d in %s, want a.example.com:0 in example", target, port, program)
+	}
+}
+
+func TestMigrateMergesCaseVariantPrograms(t *testing.T) {
+	db := migrateUntil(t, "merge programs whose names differ only in case")
+	// The baseline holds program 1 "example" with a.example.com
+	for _, stmt := range []string{
+		"INSERT INTO programs (id, name, url) VALUES (2, 'Example', 'https://example.com')",
+		"INSERT INTO programs (id, name) VALUES (3, 'other')",
+		"INSERT INTO targets (program_id, target, type) VALUES (2, 'a.example.com', 'subdomain')",
+		"INSERT INTO targets (program_id, target, type) VALUES (2, 'b.example.com', 'subdomain')",
+		"INSERT INTO targets (program_id, target, type) VALUES (3, 'other.com', 'domain')",
+		"INSERT INTO findings (target_id, title, severity) VALUES (1, 'XSS', 'low')",
+		"INSERT INTO findings (target_id, title, severity) VALUES (2, 'XSS', 'high')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"SELECT COUNT(*) FROM programs", 2},
+		{"SELECT COUNT(*) FROM programs WHERE id = 1 AND name = 'example' AND url = 'https://example.com'", 1},
+		{"SELECT COUNT(*) FROM targets WHERE program_id = 1", 2},
+		{"SELECT COUNT(*) FROM targets WHERE target = 'a.example.com'", 1},
+		{"SELECT COUNT(*) FROM targets WHERE program_id = 3", 1},
+		// Both XSS findings are kept, told apart by the merged one's id
+		{"SELECT COUNT(*) FROM findings WHERE target_id = 1", 2},
+	}
+	for _, tt := range tests {
+		var got int
+		if err := db.QueryRow(tt.query).Scan(&got); err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.query, got, tt.want)
+		}
+	}
+	if _, err := db.Exec("INSERT INTO programs (name) VALUES ('EXAMPLE')"); err == nil {
+		t.Error("a program differing only in case could still be created")
+	}
+}
+
+func TestMigrateClearsDuplicateReportIDs(t *testing.T) {
+	db := migrateUntil(t, "allow each platform report id on one finding only")
+	// The baseline holds target 1
+	for _, stmt := range []string{
+		"INSERT INTO findings (id, target_id, title, report_id) VALUES (1, 1, 'XSS', '2045871')",
+		"INSERT INTO findings (id, target_id, title, report_id, notes) VALUES (2, 1, 'XSS again', '2045871', 'retested')",
+		"INSERT INTO findings (id, target_id, title, report_id) VALUES (3, 1, 'XSS once more', '2045871')",
+		"INSERT INTO findings (id, target_id, title, report_id) VALUES (4, 1, 'SQLi', '2045872')",
+		"INSERT INTO findings (id, target_id, title, report_id) VALUES (5, 1, 'IDOR', '')",
+		"INSERT INTO findings (id, target_id, title, report_id) VALUES (6, 1, 'CSRF', '')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	tests := []struct {
+		id       int
+		reportID string
+		notes    string
+	}{
+		{1, "2045871", ""},
+		{2, "", "retested\nReport ID 2045871 is recorded on finding #1"},
+		{3, "", "Report ID 2045871 is recorded on finding #1"},
+		{4, "2045872", ""},
+		{5, "", ""},
+		{6, "", ""},
+	}
+	for _, tt := range tests {
+		var reportID, notes sql.NullString
+		if err := db.QueryRow("SELECT report_id, notes FROM findings WHERE id = ?", tt.id).Scan(&reportID, &notes); err != nil {
+			t.Fatal(err)
+		}
+		if reportID.String != tt.reportID || notes.String != tt.notes {
+			t.Errorf("finding %d: report id %q, notes %q; want %q, %q", tt.id, reportID.String, notes.String, tt.reportID, tt.notes)
+		}
+	}
+	if _, err := db.Exec("UPDATE findings SET report_id = '2045871' WHERE id = 3"); err == nil {
+		t.Error("a report id could still be recorded twice")
+	}
+}
@@ -0,0 +1,25 @@
+package database
+
+import "time"
+
+const (
+	// retryAttempts is how many times WithRetry runs fn before giving up
+	retryAttempts = 5
+	// retryBaseDelay is the first backoff; it doubles after each attempt
+	retryBaseDelay = 50 * time.Millisecond
+)
+
+// WithRetry runs fn, retrying with exponential backoff while it fails with
+// a transient SQLite error (SQLITE_BUSY or SQLITE_LOCKED). Any other error,
+// or the last transient one, is returned as-is.
+func WithRetry(fn func() error) error {
+	delay := retryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !IsTransient(err) || attempt == retryAttempts {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !cgo && !puresqlite
+
+package database
+
+// IsTransient reports whether err is a lock error worth retrying. Without
+// cgo go-sqlite3 is only a stub that never opens a database, so there is
+// nothing to retry.
+func IsTransient(err error) bool {
+	return false
+}
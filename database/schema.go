@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+
+	"ferri/utils"
 )
 
 // InitSchema creates the database tables
@@ -80,3 +82,52 @@ func InitSchema(db *sql.DB) error {
 	}
 	return nil
 }
+
+// coreTables are the tables of the base schema every database must have
+var coreTables = []string{"programs", "targets", "recon_data", "findings"}
+
+// tableExists reports whether the database has a table of that name
+func tableExists(db *sql.DB, table string) (bool, error) {
+	var name string
+	err := db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&name)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to inspect schema: %v", err)
+	}
+	return true, nil
+}
+
+// VerifySchema checks that the core tables exist and creates any that are
+// missing, so an empty or foreign SQLite file becomes a usable database
+// instead of failing on the first insert. Tables can only be recreated
+// before any migration ran, as migrations alter them; a migrated database
+// missing one is reported as damaged.
+func VerifySchema(db *sql.DB) error {
+	var missing []string
+	for _, table := range coreTables {
+		exists, err := tableExists(db, table)
+		if err != nil {
+			return err
+		} else if !exists {
+			missing = append(missing, table)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if version > 0 {
+		return fmt.Errorf("database at schema version %d is missing tables %s; restore it from a backup",
+			version, strings.Join(missing, ", "))
+	}
+	utils.Statusf("🩹 Creating missing tables: %s\n", strings.Join(missing, ", "))
+	if err := InitSchema(db); err != nil {
+		return fmt.Errorf("failed to initialize schema: %v", err)
+	}
+	return nil
+}
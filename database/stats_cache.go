@@ -0,0 +1,158 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// The stats cache holds per-program counts so ferri stats need not scan
+// recon_data. stats_cache has a row per program, stats_cache_tools one per
+// program and tool. Triggers keep both current as rows are written. The
+// cache migration runs statsCacheStatements as they were when it was added,
+// so changing them later needs a new migration for existing databases.
+
+// statsCacheTables create the cache
+var statsCacheTables = []string{
+	`CREATE TABLE IF NOT EXISTS stats_cache (
+		program_id INTEGER PRIMARY KEY,
+		targets INTEGER NOT NULL DEFAULT 0,
+		alive INTEGER NOT NULL DEFAULT 0,
+		findings INTEGER NOT NULL DEFAULT 0,
+		recon_rows INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS stats_cache_tools (
+		program_id INTEGER NOT NULL,
+		tool TEXT NOT NULL,
+		recon_rows INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (program_id, tool)
+	)`,
+}
+
+// statsCacheRebuild recount the cache from scratch
+var statsCacheRebuild = []string{
+	`DELETE FROM stats_cache`,
+	`DELETE FROM stats_cache_tools`,
+	`INSERT INTO stats_cache (program_id, targets, alive)
+		SELECT program_id, COUNT(*), SUM(IFNULL(alive, 0) != 0) FROM targets GROUP BY program_id`,
+	`INSERT INTO stats_cache (program_id, findings)
+		SELECT t.program_id, COUNT(*) FROM findings f JOIN targets t ON t.id = f.target_id GROUP BY t.program_id
+		ON CONFLICT(program_id) DO UPDATE SET findings = excluded.findings`,
+	`INSERT INTO stats_cache_tools (program_id, tool, recon_rows)
+		SELECT t.program_id, r.tool, COUNT(*) FROM recon_data r JOIN targets t ON t.id = r.target_id GROUP BY t.program_id, r.tool`,
+	`INSERT INTO stats_cache (program_id, recon_rows)
+		SELECT program_id, SUM(recon_rows) FROM stats_cache_tools GROUP BY program_id
+		ON CONFLICT(program_id) DO UPDATE SET recon_rows = excluded.recon_rows`,
+}
+
+// statsCacheTriggers keep the cache current. Recon rows and findings are
+// counted under the program of their target, so moving a target to another
+// program moves their counts along.
+var statsCacheTriggers = []string{
+	`CREATE TRIGGER IF NOT EXISTS stats_targets_insert AFTER INSERT ON targets BEGIN
+		INSERT INTO stats_cache (program_id, targets, alive) VALUES (NEW.program_id, 1, IFNULL(NEW.alive, 0) != 0)
+			ON CONFLICT(program_id) DO UPDATE SET targets = targets + 1, alive = alive + excluded.alive;
+	END`,
+	statsTargetsDeleteTrigger,
+	`CREATE TRIGGER IF NOT EXISTS stats_targets_update AFTER UPDATE OF alive, program_id ON targets
+		WHEN OLD.program_id != NEW.program_id OR (IFNULL(OLD.alive, 0) != 0) != (IFNULL(NEW.alive, 0) != 0) BEGIN
+		UPDATE stats_cache SET targets = targets - 1, alive = alive - (IFNULL(OLD.alive, 0) != 0)
+			WHERE program_id = OLD.program_id;
+		INSERT INTO stats_cache (program_id, targets, alive) VALUES (NEW.program_id, 1, IFNULL(NEW.alive, 0) != 0)
+			ON CONFLICT(program_id) DO UPDATE SET targets = targets + 1, alive = alive + excluded.alive;
+		UPDATE stats_cache SET
+			recon_rows = recon_rows - (SELECT COUNT(*) FROM recon_data WHERE target_id = NEW.id),
+			findings = findings - (SELECT COUNT(*) FROM findings WHERE target_id = NEW.id)
+			WHERE program_id = OLD.program_id AND OLD.program_id != NEW.program_id;
+		UPDATE stats_cache SET
+			recon_rows = recon_rows + (SELECT COUNT(*) FROM recon_data WHERE target_id = NEW.id),
+			findings = findings + (SELECT COUNT(*) FROM findings WHERE target_id = NEW.id)
+			WHERE program_id = NEW.program_id AND OLD.program_id != NEW.program_id;
+		UPDATE stats_cache_tools SET
+			recon_rows = recon_rows - (SELECT COUNT(*) FROM recon_data WHERE target_id = NEW.id AND tool = stats_cache_tools.tool)
+			WHERE program_id = OLD.program_id AND OLD.program_id != NEW.program_id;
+		INSERT INTO stats_cache_tools (program_id, tool, recon_rows)
+			SELECT NEW.program_id, tool, COUNT(*) FROM recon_data
+			WHERE target_id = NEW.id AND OLD.program_id != NEW.program_id GROUP BY tool
+			ON CONFLICT(program_id, tool) DO UPDATE SET recon_rows = recon_rows + excluded.recon_rows;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS stats_recon_insert AFTER INSERT ON recon_data BEGIN
+		INSERT INTO stats_cache (program_id, recon_rows) SELECT program_id, 1 FROM targets WHERE id = NEW.target_id
+			ON CONFLICT(program_id) DO UPDATE SET recon_rows = recon_rows + 1;
+		INSERT INTO stats_cache_tools (program_id, tool, recon_rows) SELECT program_id, NEW.tool, 1 FROM targets WHERE id = NEW.target_id
+			ON CONFLICT(program_id, tool) DO UPDATE SET recon_rows = recon_rows + 1;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS stats_recon_delete AFTER DELETE ON recon_data BEGIN
+		UPDATE stats_cache SET recon_rows = recon_rows - 1
+			WHERE program_id = (SELECT program_id FROM targets WHERE id = OLD.target_id);
+		UPDATE stats_cache_tools SET recon_rows = recon_rows - 1
+			WHERE program_id = (SELECT program_id FROM targets WHERE id = OLD.target_id) AND tool = OLD.tool;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS stats_recon_update AFTER UPDATE OF target_id, tool ON recon_data
+		WHEN OLD.target_id != NEW.target_id OR OLD.tool != NEW.tool BEGIN
+		UPDATE stats_cache SET recon_rows = recon_rows - 1
+			WHERE program_id = (SELECT program_id FROM targets WHERE id = OLD.target_id);
+		UPDATE stats_cache_tools SET recon_rows = recon_rows - 1
+			WHERE program_id = (SELECT program_id FROM targets WHERE id = OLD.target_id) AND tool = OLD.tool;
+		INSERT INTO stats_cache (program_id, recon_rows) SELECT program_id, 1 FROM targets WHERE id = NEW.target_id
+			ON CONFLICT(program_id) DO UPDATE SET recon_rows = recon_rows + 1;
+		INSERT INTO stats_cache_tools (program_id, tool, recon_rows) SELECT program_id, NEW.tool, 1 FROM targets WHERE id = NEW.target_id
+			ON CONFLICT(program_id, tool) DO UPDATE SET recon_rows = recon_rows + 1;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS stats_findings_insert AFTER INSERT ON findings BEGIN
+		INSERT INTO stats_cache (program_id, findings) SELECT program_id, 1 FROM targets WHERE id = NEW.target_id
+			ON CONFLICT(program_id) DO UPDATE SET findings = findings + 1;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS stats_findings_delete AFTER DELETE ON findings BEGIN
+		UPDATE stats_cache SET findings = findings - 1
+			WHERE program_id = (SELECT program_id FROM targets WHERE id = OLD.target_id);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS stats_findings_update AFTER UPDATE OF target_id ON findings
+		WHEN OLD.target_id != NEW.target_id BEGIN
+		UPDATE stats_cache SET findings = findings - 1
+			WHERE program_id = (SELECT program_id FROM targets WHERE id = OLD.target_id);
+		INSERT INTO stats_cache (program_id, findings) SELECT program_id, 1 FROM targets WHERE id = NEW.target_id
+			ON CONFLICT(program_id) DO UPDATE SET findings = findings + 1;
+	END`,
+}
+
+// statsTargetsDeleteTrigger uncounts a deleted target. Recon rows and
+// findings left on it no longer count under its program either, as nothing
+// joins them to one anymore.
+const statsTargetsDeleteTrigger = `CREATE TRIGGER IF NOT EXISTS stats_targets_delete AFTER DELETE ON targets BEGIN
+		UPDATE stats_cache SET targets = targets - 1, alive = alive - (IFNULL(OLD.alive, 0) != 0),
+			recon_rows = recon_rows - (SELECT COUNT(*) FROM recon_data WHERE target_id = OLD.id),
+			findings = findings - (SELECT COUNT(*) FROM findings WHERE target_id = OLD.id)
+			WHERE program_id = OLD.program_id;
+		UPDATE stats_cache_tools SET
+			recon_rows = recon_rows - (SELECT COUNT(*) FROM recon_data WHERE target_id = OLD.id AND tool = stats_cache_tools.tool)
+			WHERE program_id = OLD.program_id;
+	END`
+
+// statsCacheStatements create, fill and maintain the cache
+func statsCacheStatements() []string {
+	var statements []string
+	statements = append(statements, statsCacheTables...)
+	statements = append(statements, statsCacheRebuild...)
+	return append(statements, statsCacheTriggers...)
+}
+
+// RefreshStatsCache recounts the stats cache from the tables it summarizes,
+// in case it drifted, e.g. after rows were changed by hand with the
+// triggers dropped
+func RefreshStatsCache(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin stats refresh: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range statsCacheRebuild {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to refresh stats cache: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit stats refresh: %v", err)
+	}
+	return nil
+}
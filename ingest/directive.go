@@ -0,0 +1,58 @@
+package ingest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DirectivePrefix starts a first input line that describes the rest of
+// the input, such as "#ferri:tool=nuclei program=acme", so scripts can
+// label their output without extra flags
+const DirectivePrefix = "#ferri:"
+
+// Directive is what the first line of an input declares about it
+type Directive struct {
+	Tool    string
+	Program string
+}
+
+// ParseDirective reads the key=value pairs of a directive line. Pairs it
+// does not understand are reported in the error; the rest still apply.
+func ParseDirective(line string) (Directive, error) {
+	var d Directive
+	var unknown []string
+	for _, pair := range strings.Fields(strings.TrimPrefix(line, DirectivePrefix)) {
+		key, value, ok := strings.Cut(pair, "=")
+		switch {
+		case ok && strings.EqualFold(key, "tool") && value != "":
+			d.Tool = strings.ToLower(value)
+		case ok && strings.EqualFold(key, "program") && value != "":
+			d.Program = value
+		default:
+			unknown = append(unknown, pair)
+		}
+	}
+	if len(unknown) > 0 {
+		return d, fmt.Errorf("ignoring %s in %q (expected tool=name or program=name)", strings.Join(unknown, " "), line)
+	}
+	return d, nil
+}
+
+// readDirective takes a directive off the start of r, returning the reader
+// for the rest of the input and the directive line, or "" if the input
+// does not start with one. Nothing is consumed from other inputs.
+func readDirective(r io.Reader) (io.Reader, string, error) {
+	br := bufio.NewReader(r)
+	prefix, err := br.Peek(len(DirectivePrefix))
+	if err != nil || string(prefix) != DirectivePrefix {
+		// Read errors surface again when the lines are read
+		return br, "", nil
+	}
+	line, err := br.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, "", err
+	}
+	return br, strings.TrimSpace(line), nil
+}
@@ -0,0 +1,591 @@
+// Package ingest runs ferri's ingest pipeline: lines of tool output are
+// parsed, matched to a program and stored as targets, recon data and
+// findings. The ferri command is a thin wrapper around Run, so other Go
+// tools can embed the same behavior.
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"ferri/config"
+	"ferri/models"
+	"ferri/notify"
+	"ferri/processors"
+	"ferri/utils"
+)
+
+const (
+	// DefaultBatchSize is how many targets are written per transaction
+	DefaultBatchSize = 500
+	// progressThreshold is the target count above which a progress line
+	// replaces the per-target output
+	progressThreshold = 1000
+	// maxLineSize bounds a single input line, leaving room for JSON output
+	maxLineSize = 1024 * 1024
+	// DefaultCommentPrefix starts the comment lines of target lists
+	DefaultCommentPrefix = "#"
+)
+
+// ErrBinaryInput is returned when an input looks like binary data, such as
+// a pcap piped in by mistake, which would only produce garbage targets
+var ErrBinaryInput = errors.New("input looks like binary data, not tool output")
+
+// Input is one source of lines and the tool that produced them
+type Input struct {
+	Name   string
+	Reader io.Reader
+	// Tool is the producing tool; empty falls back to detection
+	Tool string
+}
+
+// Options configures Run. The zero value ingests into programs derived
+// from the targets, one goroutine parsing.
+type Options struct {
+	// Tool overrides the tool of every input
+	Tool string
+	// ProgramName puts every target into this program, creating it with
+	// ProgramScope if needed, instead of deriving it from the first target
+	ProgramName  string
+	ProgramScope string
+	// DefaultProgram collects targets no program name can be derived
+	// from, such as localhost or bare IPs
+	DefaultProgram string
+	// Ignore lists targets that are skipped rather than stored
+	Ignore *config.IgnoreList
+	// CommentPrefix starts lines that are skipped as comments, such as
+	// DefaultCommentPrefix; empty treats every line as input
+	CommentPrefix string
+	// AllowBinary ingests inputs that look like binary data instead of
+	// failing with ErrBinaryInput
+	AllowBinary bool
+	// DryRun does everything in one transaction that is rolled back
+	DryRun bool
+	// Workers is how many goroutines parse lines; writes stay serialized
+	Workers int
+	// BatchSize is how many targets are committed at a time
+	BatchSize int
+	// MaxLines, if positive, stops the run once that many lines were
+	// read, leaving the rest of the input unread. Every line counts,
+	// including repeated, comment and blank ones.
+	MaxLines int
+	// Passthrough, if set, receives every processed target, one per line
+	Passthrough io.Writer
+	// Changed, if set, receives every target whose body hash differs from
+	// the one stored by an earlier scan, one per line
+	Changed io.Writer
+	// Notifier, if set, is told about every finding once it is committed
+	Notifier *notify.Notifier
+	// Warnf, if set, reports lines and targets that failed
+	Warnf func(format string, args ...any)
+	// Clock, if set, stamps the stored rows and the run instead of the
+	// system clock
+	Clock utils.Clock
+}
+
+// Result describes what an ingest did
+type Result struct {
+	RunID          int          `json:"run_id,omitempty"`
+	ProgramID      int          `json:"program_id"`
+	ProgramName    string       `json:"program_name"`
+	ProgramCreated bool         `json:"program_created"`
+	Tool           string       `json:"tool"`
+	Total          int          `json:"total"`
+	Processed      int          `json:"processed"`
+	Created        int          `json:"targets_created"`
+	Existing       int          `json:"targets_existing"`
+	ReconRows      int          `json:"recon_rows_added"`
+	ReconMerged    int          `json:"recon_rows_merged"`
+	Findings       int          `json:"findings_created"`
+	DNSRecords     int          `json:"dns_records"`
+	Changed        int          `json:"changed"`
+	Duplicates     int          `json:"duplicates"`
+	Ignored        int          `json:"ignored"`
+	Comments       int          `json:"comments"`
+	Files          []FileResult `json:"files"`
+	// Interrupted runs keep the batches committed before the context was
+	// canceled; Processed then only counts those, and RolledBack the
+	// targets of the batch that was discarded
+	Interrupted bool `json:"interrupted,omitempty"`
+	RolledBack  int  `json:"rolled_back,omitempty"`
+	DryRun      bool `json:"dry_run,omitempty"`
+	// Truncated runs stopped at Options.MaxLines
+	Truncated bool          `json:"truncated,omitempty"`
+	Errors    []TargetError `json:"errors"`
+}
+
+// FileResult counts the lines read and targets processed from one input
+type FileResult struct {
+	Name      string `json:"name"`
+	Tool      string `json:"tool"`
+	Total     int    `json:"total"`
+	Processed int    `json:"processed"`
+}
+
+// TargetError records why a single line or target failed to ingest
+type TargetError struct {
+	Target string `json:"target"`
+	Error  string `json:"error"`
+}
+
+func (r *Result) addError(target string, err error) {
+	r.Errors = append(r.Errors, TargetError{Target: target, Error: err.Error()})
+}
+
+// Run streams each input in turn into the same program, committing every
+// BatchSize targets. Inputs are checked for binary data before anything is
+// written. Lines that fail are recorded in the result and
+// skipped; the error is only set when the run as a whole cannot go on.
+// Canceling ctx stops the run, keeping what was committed.
+func Run(ctx context.Context, db *sql.DB, inputs []Input, opts Options) (*Result, error) {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.BatchSize < 1 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	warnf := opts.Warnf
+	if warnf == nil {
+		warnf = func(string, ...any) {}
+	}
+
+	inputs = append([]Input(nil), inputs...)
+	result := &Result{Errors: []TargetError{}, DryRun: opts.DryRun}
+	for i := range inputs {
+		// Archived dumps are often gzipped; decompress them transparently
+		r, err := utils.MaybeGzipReader(inputs[i].Reader)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", inputs[i].Name, err)
+		}
+		r, binary := utils.LooksBinary(r)
+		if binary && !opts.AllowBinary {
+			return nil, fmt.Errorf("%s: %w", inputs[i].Name, ErrBinaryInput)
+		}
+
+		// A directive line takes the place of detection, not of the
+		// options: Tool and ProgramName still win over it
+		r, line, err := readDirective(r)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", inputs[i].Name, err)
+		}
+		if line != "" {
+			d, err := ParseDirective(line)
+			if err != nil {
+				warnf("⚠️ %s: %v\n", inputs[i].Name, err)
+			}
+			if d.Tool != "" {
+				inputs[i].Tool = d.Tool
+			}
+			if d.Program != "" {
+				switch {
+				case opts.ProgramName == "":
+					opts.ProgramName = d.Program
+				case !strings.EqualFold(opts.ProgramName, d.Program):
+					warnf("⚠️ %s: ignoring program=%s, this run goes into %s\n", inputs[i].Name, d.Program, opts.ProgramName)
+				}
+			}
+		}
+		inputs[i].Reader = r
+
+		if opts.Tool != "" {
+			inputs[i].Tool = opts.Tool
+		} else if inputs[i].Tool == "" {
+			inputs[i].Tool = utils.DetectTool()
+		}
+		result.Files = append(result.Files, FileResult{Name: inputs[i].Name, Tool: inputs[i].Tool})
+
+		if i == 0 {
+			result.Tool = inputs[i].Tool
+		} else if inputs[i].Tool != result.Tool {
+			result.Tool = "mixed"
+		}
+	}
+
+	// Every real run is recorded so its rows can be audited later. The run
+	// is finished after the ingester is closed, as an open transaction
+	// would block the update.
+	clock := opts.Clock
+	if clock == nil {
+		clock = utils.RealClock{}
+	}
+	if !opts.DryRun {
+		names := make([]string, len(inputs))
+		for i, in := range inputs {
+			names[i] = in.Name
+		}
+		runID, err := processors.StartRunContext(ctx, db, result.Tool, strings.Join(names, ", "), clock.Now())
+		if err != nil {
+			return nil, err
+		}
+		result.RunID = runID
+		defer func() {
+			err := processors.FinishRunContext(context.Background(), db, runID, result.Tool, result.ProgramID, result.Processed, clock.Now())
+			if err != nil {
+				warnf("⚠️ %v\n", err)
+			}
+		}()
+	}
+
+	// Every target goes through the same few statements; prepare them once
+	ingester, err := processors.NewIngester(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing statements: %v", err)
+	}
+	defer ingester.Close()
+	ingester.SetClock(clock)
+	if result.RunID > 0 {
+		ingester.SetRun(result.RunID)
+	}
+
+	// A dry run does all its work, program creation included, in a single
+	// transaction that is rolled back at the end
+	var programQ processors.Querier = db
+	if opts.DryRun {
+		if err := ingester.Begin(ctx); err != nil {
+			return nil, fmt.Errorf("error starting transaction: %v", err)
+		}
+		programQ = ingester
+		utils.Statusf("🧪 Dry run: nothing below is written to the database\n")
+	}
+
+	// Notifications wait for the batch holding their finding to commit,
+	// so a rolled-back finding is never announced
+	var pendingEvents []notify.Event
+	flushEvents := func() {
+		for _, e := range pendingEvents {
+			opts.Notifier.Send(e)
+		}
+		pendingEvents = nil
+	}
+	// queueFinding announces a finding the run created once it commits
+	queueFinding := func(targetID int, target string, findingID int, title, findingType string, severity models.FindingSeverity) {
+		if opts.Notifier == nil || opts.DryRun {
+			return
+		}
+		pendingEvents = append(pendingEvents, notify.Event{
+			Event:   "finding.created",
+			Finding: notify.Finding{ID: findingID, Title: title, Type: findingType, Severity: string(severity), Status: string(models.StatusOpen)},
+			Program: notify.Program{ID: result.ProgramID, Name: result.ProgramName},
+			Target:  notify.Target{ID: targetID, Target: target},
+		})
+	}
+	if opts.Notifier != nil {
+		defer opts.Notifier.Wait()
+	}
+
+	progress := utils.NewProgress(utils.Status, 0)
+	committed := 0
+	// Each unmapped severity label is only warned about once
+	unknownSeverities := map[string]bool{}
+
+	// Each line is ingested as it is read so memory stays flat regardless
+	// of input size. Lines are parsed on the worker pool but arrive here in
+	// input order and are written one at a time, since SQLite serializes
+	// writes anyway. The program is chosen from the first usable line.
+	// MaxLines stops the readers without canceling the run itself.
+	readCtx, stopReading := context.WithCancel(ctx)
+	defer stopReading()
+	lines := parseLines(readCtx, opts.Workers, inputs, readLines(readCtx, inputs, opts.CommentPrefix, opts.MaxLines))
+ingest:
+	for l := range lines {
+		if ctx.Err() != nil {
+			break ingest
+		}
+		in := inputs[l.input]
+		fileStats := &result.Files[l.input]
+		switch {
+		case l.start:
+			utils.Statusf("📥 Reading from %s (tool: %s)...\n", in.Name, in.Tool)
+			continue
+		case l.readErr != nil:
+			result.addError(in.Name, l.readErr)
+			warnf("⚠️ Error reading %s: %v\n", in.Name, l.readErr)
+			continue
+		case l.duplicate:
+			result.Duplicates++
+			continue
+		case l.comment:
+			result.Comments++
+			continue
+		case l.truncated:
+			result.Truncated = true
+			stopReading()
+			break ingest
+		}
+		line := l.line
+		result.Total++
+		fileStats.Total++
+
+		// A registered tool parser pulled the target out of the line
+		record, err := l.record, l.parseErr
+		if err != nil {
+			result.addError(line, err)
+			warnf("⚠️ Skipping unparseable line %q: %v\n", line, err)
+			continue
+		}
+		target := processors.CanonicalizeTarget(record.Target)
+		if opts.Ignore.Match(target) {
+			result.Ignored++
+			continue
+		}
+		reconContext := processors.ReconContext(record.Tool, target, record.Context, record.Fields)
+
+		if result.ProgramID == 0 {
+			err := chooseProgram(ctx, programQ, result, target, opts)
+			if errors.Is(err, processors.ErrProgramNotFound) && opts.ProgramName == "" {
+				// Another target may belong to an existing program
+				result.addError(target, err)
+				warnf("⚠️ Skipping %s: %v\n", target, err)
+				continue
+			} else if err != nil {
+				return result, err
+			}
+			if !ingester.InTx() {
+				if err := ingester.Begin(ctx); err != nil {
+					return result, fmt.Errorf("error starting transaction: %v", err)
+				}
+			}
+		}
+
+		// Large ingests switch from per-target lines to a progress line
+		showProgress := result.Total > progressThreshold
+		if showProgress {
+			progress.Update(result.Total)
+		}
+
+		targetID, created, err := ingester.GetOrCreateTarget(ctx, target, record.Tool, result.ProgramID)
+		if err != nil {
+			if ctx.Err() != nil {
+				break ingest
+			}
+			result.addError(target, err)
+			warnf("⚠️ Error with target %s: %v\n", target, err)
+			continue
+		}
+		if created {
+			result.Created++
+		} else {
+			result.Existing++
+		}
+
+		// Keep the line exactly as the tool emitted it so misparses can be
+		// audited against the stored target
+		added, err := ingester.AddReconData(ctx, targetID, record.Tool, line, reconContext)
+		if err != nil {
+			if ctx.Err() != nil {
+				break ingest
+			}
+			result.addError(target, err)
+			warnf("⚠️ Error adding recon data for %s: %v\n", target, err)
+			continue
+		}
+		if added {
+			result.ReconRows++
+		} else {
+			result.ReconMerged++
+		}
+
+		if record.Alive != nil {
+			if _, err := ingester.MarkAlive(ctx, targetID, *record.Alive); err != nil {
+				if ctx.Err() != nil {
+					break ingest
+				}
+				result.addError(target, err)
+				warnf("⚠️ Error storing status of %s: %v\n", target, err)
+			}
+		}
+
+		if record.StatusCode > 0 {
+			if err := ingester.UpdateStatusCode(ctx, targetID, record.StatusCode); err != nil {
+				if ctx.Err() != nil {
+					break ingest
+				}
+				result.addError(target, err)
+				warnf("⚠️ Error storing status code for %s: %v\n", target, err)
+			}
+		}
+
+		if record.BodyHash != "" {
+			changed, err := ingester.UpdateBodyHash(ctx, targetID, record.BodyHash)
+			if err != nil {
+				if ctx.Err() != nil {
+					break ingest
+				}
+				result.addError(target, err)
+				warnf("⚠️ Error storing body hash for %s: %v\n", target, err)
+			} else if changed {
+				result.Changed++
+				if opts.Changed != nil {
+					fmt.Fprintln(opts.Changed, target)
+				}
+			}
+		}
+
+		for _, tech := range record.Technologies {
+			if err := ingester.AddTechnology(ctx, targetID, tech.Name, tech.Version); err != nil {
+				if ctx.Err() != nil {
+					break ingest
+				}
+				result.addError(target, err)
+				warnf("⚠️ Error adding technology for %s: %v\n", target, err)
+			}
+		}
+
+		if len(record.DNSRecords) > 0 {
+			records := make([]models.DNSRecord, len(record.DNSRecords))
+			for i, r := range record.DNSRecords {
+				records[i] = models.DNSRecord{Type: models.DNSRecordType(r.Type), Value: r.Value}
+			}
+			if err := ingester.ProcessDnsxLine(ctx, targetID, records); err != nil {
+				if ctx.Err() != nil {
+					break ingest
+				}
+				result.addError(target, err)
+				warnf("⚠️ Error storing DNS records for %s: %v\n", target, err)
+			} else {
+				result.DNSRecords += len(records)
+			}
+
+			// A CNAME left dangling on a hosting service is a finding
+			if service, ok := processors.CheckTakeover(target, records, record.Rcode); ok {
+				findingType := "takeover-" + service
+				findingID, created, err := ingester.RecordFinding(ctx, targetID, processors.TakeoverTitle, findingType, models.SeverityHigh)
+				if err != nil {
+					if ctx.Err() != nil {
+						break ingest
+					}
+					result.addError(target, err)
+					warnf("⚠️ Error recording finding for %s: %v\n", target, err)
+				} else if created {
+					result.Findings++
+					queueFinding(targetID, target, findingID, processors.TakeoverTitle, findingType, models.SeverityHigh)
+				}
+			}
+		}
+
+		// Scanner results are findings too
+		if issue := record.Issue; issue != nil {
+			title := issue.Name
+			if title == "" {
+				title = issue.Template
+			}
+			severity, known := processors.ScannerSeverity(issue.Severity)
+			if !known && !unknownSeverities[issue.Severity] {
+				unknownSeverities[issue.Severity] = true
+				warnf("⚠️ Unknown severity %q (first seen on %s), recording as info; map it with severity_map in the config file\n",
+					issue.Severity, target)
+			}
+			findingID, created, err := ingester.RecordFinding(ctx, targetID, title, issue.Template, severity)
+			if err != nil {
+				if ctx.Err() != nil {
+					break ingest
+				}
+				result.addError(target, err)
+				warnf("⚠️ Error recording finding for %s: %v\n", target, err)
+				continue
+			}
+			if created {
+				result.Findings++
+				queueFinding(targetID, target, findingID, title, issue.Template, severity)
+			}
+		}
+
+		result.Processed++
+		fileStats.Processed++
+		if opts.DryRun && !showProgress {
+			value, targetType, port := processors.ClassifyTarget(target)
+			action := "exists"
+			if created {
+				action = "create"
+			}
+			utils.Statusf("🧪 %s %s %s\n", action, targetType, models.JoinHostPort(value, port))
+		} else if !showProgress {
+			utils.Statusf("✅ %s\n", target)
+		}
+		if opts.Passthrough != nil {
+			fmt.Fprintln(opts.Passthrough, target)
+		}
+
+		// Commit every BatchSize targets
+		if !opts.DryRun && result.Processed-committed >= opts.BatchSize {
+			if err := ingester.Commit(); err != nil {
+				return result, fmt.Errorf("error committing batch: %v", err)
+			}
+			committed = result.Processed
+			flushEvents()
+			if err := ingester.Begin(ctx); err != nil {
+				if ctx.Err() != nil {
+					break ingest
+				}
+				return result, fmt.Errorf("error starting transaction: %v", err)
+			}
+		}
+	}
+
+	if result.Total > progressThreshold {
+		progress.Finish()
+	}
+
+	if ctx.Err() != nil {
+		ingester.Rollback()
+		result.Interrupted = true
+		result.RolledBack = result.Processed - committed
+		result.Processed = committed
+		return result, nil
+	}
+
+	if opts.DryRun || result.Total == 0 {
+		ingester.Rollback()
+		return result, nil
+	}
+	if err := ingester.Commit(); err != nil {
+		return result, fmt.Errorf("error committing batch: %v", err)
+	}
+	flushEvents()
+	return result, nil
+}
+
+// chooseProgram picks the program of the run from its first usable target,
+// unless ProgramName forces one
+func chooseProgram(ctx context.Context, q processors.Querier, result *Result, target string, opts Options) error {
+	var err error
+	if opts.ProgramName != "" {
+		var scope sql.NullString
+		if opts.ProgramScope != "" {
+			scope = sql.NullString{String: opts.ProgramScope, Valid: true}
+		}
+		result.ProgramName = opts.ProgramName
+		result.ProgramID, result.ProgramCreated, err = processors.GetOrCreateProgramByNameContext(
+			ctx, q, opts.ProgramName, scope)
+		if errors.Is(err, processors.ErrProgramNotFound) {
+			return err
+		} else if err != nil {
+			return fmt.Errorf("error getting/creating program: %v", err)
+		}
+		return nil
+	}
+
+	domain := processors.ProgramDomain(target)
+	utils.Statusf("🌐 Extracted domain: %s\n", domain)
+
+	result.ProgramName, err = processors.ProgramNameContext(ctx, q, domain)
+	if err == nil {
+		result.ProgramID, result.ProgramCreated, err = processors.GetOrCreateNamedProgramContext(ctx, q, target, result.ProgramName)
+	}
+	if errors.Is(err, processors.ErrInvalidProgramDomain) && opts.DefaultProgram != "" {
+		utils.Statusf("📦 %v, using default program %s\n", err, opts.DefaultProgram)
+		result.ProgramName = opts.DefaultProgram
+		result.ProgramID, result.ProgramCreated, err = processors.GetOrCreateProgramByNameContext(
+			ctx, q, opts.DefaultProgram, sql.NullString{})
+	}
+	if errors.Is(err, processors.ErrInvalidProgramDomain) || errors.Is(err, processors.ErrProgramNotFound) {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("error getting/creating program: %v", err)
+	}
+	return nil
+}
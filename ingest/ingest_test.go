@@ -0,0 +1,379 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ferri/database"
+	"ferri/processors"
+	"ferri/utils"
+)
+
+// newTestDB returns a migrated database in a temporary directory, with
+// progress messages silenced
+func newTestDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+	status := utils.Status
+	utils.Status = io.Discard
+	tb.Cleanup(func() { utils.Status = status })
+
+	path := filepath.Join(tb.TempDir(), "bounty.db")
+	if err := database.EnsureDBExists(path); err != nil {
+		tb.Fatal(err)
+	}
+	db, err := database.InitDB(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	return db
+}
+
+// hostLines returns n subfinder-style host lines under example.com
+func hostLines(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "host%d.example.com\n", i)
+	}
+	return b.String()
+}
+
+// ingest runs lines through Run as one input of tool
+func ingest(tb testing.TB, db *sql.DB, tool, lines string, opts Options) *Result {
+	tb.Helper()
+	inputs := []Input{{Name: "test", Reader: strings.NewReader(lines), Tool: tool}}
+	result, err := Run(context.Background(), db, inputs, opts)
+	if err != nil {
+		tb.Fatalf("Run: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		tb.Fatalf("Run failed on %d lines, first %s: %s", len(result.Errors), result.Errors[0].Target, result.Errors[0].Error)
+	}
+	return result
+}
+
+func BenchmarkIngest(b *testing.B) {
+	for _, n := range []int{1000, 10000, 100000} {
+		lines := hostLines(n)
+		b.Run(fmt.Sprintf("%d-targets", n), func(b *testing.B) {
+			if n > 10000 && testing.Short() {
+				b.Skip("skipping the largest ingest in short mode")
+			}
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				db := newTestDB(b)
+				b.StartTimer()
+				if result := ingest(b, db, "subfinder", lines, Options{}); result.Processed != n {
+					b.Fatalf("processed %d targets, want %d", result.Processed, n)
+				}
+			}
+			b.ReportMetric(float64(n*b.N)/b.Elapsed().Seconds(), "targets/s")
+		})
+	}
+}
+
+// mixedLines returns n JSON lines of httpx, nuclei, dnsx and subfinder
+// output, one in seven repeating an earlier target
+func mixedLines(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		host := fmt.Sprintf("host%d.example.com", i)
+		if i%7 == 6 {
+			host = fmt.Sprintf("host%d.example.com", i/2)
+		}
+		switch i % 4 {
+		case 0:
+			fmt.Fprintf(&b, `{"url":"https://%s","status_code":%d,"title":"Page %d","tech":["Nginx:1.%d","PHP"],"hash":{"body_sha256":"%x"}}`+"\n",
+				host, 200+i%3, i, i%5, i)
+		case 1:
+			fmt.Fprintf(&b, `{"template-id":"tech-%d","info":{"name":"Issue %d","severity":"%s"},"matched-at":"https://%s/x"}`+"\n",
+				i%3, i%3, []string{"low", "high", "medium"}[i%3], host)
+		case 2:
+			fmt.Fprintf(&b, `{"host":"%s","resolver":["1.1.1.1:53"],"a":["192.0.2.%d","192.0.2.%d"],"cname":["%s.github.io"]}`+"\n",
+				host, i%250, (i+1)%250, host)
+		default:
+			fmt.Fprintf(&b, `{"host":"%s","source":"crtsh"}`+"\n", host)
+		}
+	}
+	return b.String()
+}
+
+// dumpRows renders what an ingest stored without database ids or times,
+// so two databases holding the same data dump the same
+func dumpRows(tb testing.TB, db *sql.DB) string {
+	tb.Helper()
+	queries := []string{
+		`SELECT t.target, t.port, t.type, t.alive, COALESCE(t.status_code, 0), COALESCE(t.body_hash, ''),
+			COALESCE(p.target, '') FROM targets t LEFT JOIN targets p ON p.id = t.parent_id ORDER BY 1, 2`,
+		`SELECT t.target, r.tool, r.data, COALESCE(r.context, '') FROM recon_data r JOIN targets t ON t.id = r.target_id ORDER BY 1, 2, 3, 4`,
+		`SELECT t.target, f.title, COALESCE(f.type, ''), f.severity, f.status FROM findings f JOIN targets t ON t.id = f.target_id ORDER BY 1, 2, 3`,
+		`SELECT t.target, d.type, d.value, d.position FROM dns_records d JOIN targets t ON t.id = d.target_id ORDER BY 1, 2, 3`,
+		`SELECT t.target, x.name, COALESCE(x.version, '') FROM technologies x JOIN targets t ON t.id = x.target_id ORDER BY 1, 2, 3`,
+	}
+	var b strings.Builder
+	for _, query := range queries {
+		rows, err := db.Query(query)
+		if err != nil {
+			tb.Fatalf("%s: %v", query, err)
+		}
+		cols, _ := rows.Columns()
+		values := make([]any, len(cols))
+		for i := range values {
+			values[i] = new(any)
+		}
+		for rows.Next() {
+			if err := rows.Scan(values...); err != nil {
+				tb.Fatal(err)
+			}
+			for _, v := range values {
+				fmt.Fprintf(&b, "%v\t", *v.(*any))
+			}
+			b.WriteString("\n")
+		}
+		rows.Close()
+		b.WriteString("--\n")
+	}
+	return b.String()
+}
+
+func TestRunStoresTheSameRowsWithAnyNumberOfWorkers(t *testing.T) {
+	lines := mixedLines(500)
+	wantDB := newTestDB(t)
+	want := ingest(t, wantDB, "", lines, Options{Workers: 1})
+	wantRows := dumpRows(t, wantDB)
+	if want.Findings == 0 || want.DNSRecords == 0 || want.Existing == 0 {
+		t.Fatalf("input stored %d findings, %d DNS records and %d repeated targets; want some of each",
+			want.Findings, want.DNSRecords, want.Existing)
+	}
+
+	tests := []struct {
+		workers   int
+		batchSize int
+	}{
+		{2, 0},
+		{4, 64},
+		{8, 64},
+		{16, 7},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d-workers", tt.workers), func(t *testing.T) {
+			db := newTestDB(t)
+			got := ingest(t, db, "", lines, Options{Workers: tt.workers, BatchSize: tt.batchSize})
+
+			counts := []struct {
+				name      string
+				got, want int
+			}{
+				{"processed", got.Processed, want.Processed},
+				{"created", got.Created, want.Created},
+				{"existing", got.Existing, want.Existing},
+				{"recon rows", got.ReconRows, want.ReconRows},
+				{"recon merged", got.ReconMerged, want.ReconMerged},
+				{"findings", got.Findings, want.Findings},
+				{"dns records", got.DNSRecords, want.DNSRecords},
+			}
+			for _, c := range counts {
+				if c.got != c.want {
+					t.Errorf("%s = %d, want %d as with one worker", c.name, c.got, c.want)
+				}
+			}
+			if rows := dumpRows(t, db); rows != wantRows {
+				t.Errorf("stored rows differ from a one-worker ingest:\n%s\nwant:\n%s", rows, wantRows)
+			}
+		})
+	}
+}
+
+func BenchmarkIngestWorkers(b *testing.B) {
+	const n = 5000
+	lines := mixedLines(n)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("%d-workers", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				db := newTestDB(b)
+				b.StartTimer()
+				ingest(b, db, "", lines, Options{Workers: workers})
+			}
+			b.ReportMetric(float64(n*b.N)/b.Elapsed().Seconds(), "lines/s")
+		})
+	}
+}
+
+// endlessReader repeats its lines forever, like a runaway tool
+type endlessReader struct {
+	lines   []string
+	next    int
+	pending []byte
+	// served is how many lines were handed out
+	served int
+}
+
+func (r *endlessReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.pending) == 0 {
+			r.pending = []byte(r.lines[r.next%len(r.lines)] + "\n")
+			r.next++
+			r.served++
+		}
+		c := copy(p[n:], r.pending)
+		r.pending = r.pending[c:]
+		n += c
+	}
+	return n, nil
+}
+
+func TestMaxLinesStopsTheReader(t *testing.T) {
+	tests := []struct {
+		name      string
+		lines     []string
+		maxLines  int
+		wantTotal int
+		wantDups  int
+	}{
+		{"distinct hosts", []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com"}, 10, 4, 6},
+		{"one repeated line", []string{"a.example.com"}, 50, 1, 49},
+		{"comments after a host", []string{"a.example.com", "# still working"}, 20, 1, 9},
+		{"blank lines after a host", []string{"a.example.com", "", "----"}, 30, 1, 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			r := &endlessReader{lines: tt.lines}
+			inputs := []Input{{Name: "stdin", Reader: r, Tool: "subfinder"}}
+			done := make(chan struct{})
+			var result *Result
+			var err error
+			go func() {
+				defer close(done)
+				result, err = Run(context.Background(), db, inputs, Options{MaxLines: tt.maxLines, CommentPrefix: "#", BatchSize: 100, Workers: 2})
+			}()
+			select {
+			case <-done:
+			case <-time.After(10 * time.Second):
+				t.Fatalf("Run kept reading past --max-lines; %d lines served", r.served)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Truncated {
+				t.Error("run not marked as truncated")
+			}
+			if result.Total != tt.wantTotal || result.Duplicates != tt.wantDups {
+				t.Errorf("total %d and %d duplicates, want %d and %d", result.Total, result.Duplicates, tt.wantTotal, tt.wantDups)
+			}
+			// The scanner reads ahead by at most its buffer
+			if limit := tt.maxLines + 64*1024; r.served > limit {
+				t.Errorf("%d lines served, want at most %d", r.served, limit)
+			}
+		})
+	}
+}
+
+func TestMaxLinesAboveTheInputIsNotTruncated(t *testing.T) {
+	db := newTestDB(t)
+	result := ingest(t, db, "subfinder", "a.example.com\na.example.com\n# done\nb.example.com\n", Options{MaxLines: 4, CommentPrefix: "#", BatchSize: 100})
+	if result.Truncated || result.Total != 2 || result.Duplicates != 1 || result.Comments != 1 {
+		t.Errorf("truncated %v, total %d, %d duplicates, %d comments; want the whole input",
+			result.Truncated, result.Total, result.Duplicates, result.Comments)
+	}
+}
+
+func TestRunStampsRowsWithItsClock(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Date(2024, 3, 1, 12, 34, 56, 0, time.UTC)
+	lines := `{"url":"https://a.example.com","status_code":200,"title":"Home"}
+{"host":"a.example.com","resolver":["1.1.1.1:53"],"a":["192.0.2.1"]}
+`
+	result := ingest(t, db, "", lines, Options{Clock: utils.NewFakeClock(now)})
+
+	// Every row a query returns must carry the clock's time
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"target last_checked", "SELECT last_checked FROM targets WHERE target = 'a.example.com'"},
+		{"recon timestamp", "SELECT timestamp FROM recon_data"},
+		{"DNS record resolved_at", "SELECT resolved_at FROM dns_records"},
+		{"status history checked_at", "SELECT checked_at FROM target_status_history"},
+		{"run started_at", fmt.Sprintf("SELECT started_at FROM runs WHERE id = %d", result.RunID)},
+		{"run finished_at", fmt.Sprintf("SELECT finished_at FROM runs WHERE id = %d", result.RunID)},
+	}
+	for _, tt := range tests {
+		rows, err := db.Query(tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		n := 0
+		for ; rows.Next(); n++ {
+			var got time.Time
+			if err := rows.Scan(&got); err != nil {
+				t.Fatalf("%s: %v", tt.query, err)
+			}
+			if !got.Equal(now) {
+				t.Errorf("%s = %v, want %v", tt.name, got, now)
+			}
+		}
+		rows.Close()
+		if n == 0 {
+			t.Errorf("no %s stored", tt.name)
+		}
+	}
+}
+
+// aliasCounter counts the program alias lookups run through it
+type aliasCounter struct {
+	processors.Querier
+	lookups int
+}
+
+func (q *aliasCounter) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if strings.Contains(query, "program_aliases") {
+		q.lookups++
+	}
+	return q.Querier.QueryRowContext(ctx, query, args...)
+}
+
+func TestChooseProgramLooksUpTheAliasOnce(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		alias  bool
+		want   string
+	}{
+		{"derived name", "api.example.com", false, "example"},
+		{"aliased domain", "api.example.net", true, "example"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			if tt.alias {
+				id, _, err := processors.GetOrCreateProgramByNameContext(context.Background(), db, "example", sql.NullString{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := db.Exec("INSERT INTO program_aliases (domain, program_id) VALUES ('example.net', ?)", id); err != nil {
+					t.Fatal(err)
+				}
+			}
+			q := &aliasCounter{Querier: db}
+			var result Result
+			if err := chooseProgram(context.Background(), q, &result, tt.target, Options{}); err != nil {
+				t.Fatal(err)
+			}
+			if result.ProgramName != tt.want || result.ProgramID == 0 {
+				t.Errorf("program %q (%d), want %q", result.ProgramName, result.ProgramID, tt.want)
+			}
+			if q.lookups != 1 {
+				t.Errorf("alias looked up %d times, want once", q.lookups)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"strings"
+	"unicode"
+
+	"ferri/parsers"
+)
+
+// ingestLine is one step of an ingest as it moves from the reader through
+// the parse workers to the writer
+type ingestLine struct {
+	input int // index into the inputs of the run
+	// start marks the beginning of an input and carries no line
+	start bool
+	// readErr reports that the input failed to read; it carries no line
+	readErr error
+	line    string
+	// duplicate lines were already seen from the same tool and are not parsed
+	duplicate bool
+	// comment lines start with the comment prefix and are not parsed
+	comment bool
+	// truncated marks that the reader stopped at its line limit with input
+	// left unread; it carries no line
+	truncated bool
+	record    parsers.ParsedRecord
+	parseErr  error
+}
+
+// readLines streams the non-blank lines of each input in turn, marking
+// lines starting with commentPrefix as comments and lines already seen from
+// the same tool as duplicates. An empty commentPrefix marks no comments.
+// A positive maxLines stops it once that many lines were read across the
+// inputs, whatever they held, ending the stream with a truncated line if
+// there was more.
+func readLines(ctx context.Context, inputs []Input, commentPrefix string, maxLines int) <-chan ingestLine {
+	out := make(chan ingestLine)
+	send := func(l ingestLine) bool {
+		select {
+		case out <- l:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	go func() {
+		defer close(out)
+		// Tools often repeat themselves; only the first occurrence of a
+		// line from a tool in this run costs a database round-trip
+		seen := make(map[string]struct{})
+		read := 0
+		for i, in := range inputs {
+			if !send(ingestLine{input: i, start: true}) {
+				return
+			}
+			scanner := bufio.NewScanner(in.Reader)
+			scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+			for scanner.Scan() {
+				// Repeated, comment and blank lines count too, so a tool
+				// stuck emitting them is stopped as well
+				if maxLines > 0 && read >= maxLines {
+					send(ingestLine{input: i, truncated: true})
+					return
+				}
+				read++
+				line := strings.TrimSpace(scanner.Text())
+				if commentPrefix != "" && strings.HasPrefix(line, commentPrefix) {
+					if !send(ingestLine{input: i, line: line, comment: true}) {
+						return
+					}
+					continue
+				}
+				if isBlank(line) {
+					continue
+				}
+				key := in.Tool + "\x00" + line
+				_, dup := seen[key]
+				seen[key] = struct{}{}
+				if !send(ingestLine{input: i, line: line, duplicate: dup}) {
+					return
+				}
+			}
+			if err := scanner.Err(); err != nil {
+				if !send(ingestLine{input: i, readErr: err}) {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// parseLines parses lines on a pool of workers and delivers them in the
+// order they were read, so an ingest behaves the same whatever the pool
+// size. Only parsing is parallel; the caller does the writes.
+func parseLines(ctx context.Context, workers int, inputs []Input, lines <-chan ingestLine) <-chan ingestLine {
+	type job struct {
+		line ingestLine
+		done chan ingestLine
+	}
+	jobs := make(chan job)
+	// order holds each line's result slot in read order; its buffer bounds
+	// how far the workers may run ahead of the writer
+	order := make(chan chan ingestLine, 4*workers)
+	out := make(chan ingestLine)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for j := range jobs {
+				l := j.line
+				if !l.start && !l.truncated && l.readErr == nil && !l.duplicate && !l.comment {
+					l.record, l.parseErr = parsers.Parse(inputs[l.input].Tool, l.line)
+				}
+				j.done <- l
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		defer close(order)
+		for l := range lines {
+			done := make(chan ingestLine, 1)
+			select {
+			case order <- done:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- job{line: l, done: done}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer close(out)
+		for done := range order {
+			var l ingestLine
+			select {
+			case l = <-done:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case out <- l:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// isBlank reports whether a line holds nothing but whitespace and
+// punctuation, such as the ---- or ==== rules separating sections of a
+// target list
+func isBlank(line string) bool {
+	for _, r := range line {
+		if !unicode.IsSpace(r) && !unicode.IsPunct(r) && !unicode.IsSymbol(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package ingest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ferri/notify"
+)
+
+func TestIngestFlagsOnlyDanglingCNAMEs(t *testing.T) {
+	lines := strings.Join([]string{
+		// Dangling: the chain ends in NXDOMAIN, or without addresses
+		`{"host":"docs.example.com","resolver":["1.1.1.1:53"],"cname":["example-docs.github.io"],"status_code":"NXDOMAIN"}`,
+		`{"host":"cdn.example.com","resolver":["1.1.1.1:53"],"cname":["example.azureedge.net"]}`,
+		// Healthy customers of the same kind of services
+		`{"host":"www.example.com","resolver":["1.1.1.1:53"],"cname":["example.map.fastly.net"],"a":["151.101.1.1"],"status_code":"NOERROR"}`,
+		`{"host":"help.example.com","resolver":["1.1.1.1:53"],"cname":["example.zendesk.com"],"a":["104.16.51.111"],"status_code":"NOERROR"}`,
+		`{"host":"blog.example.com","resolver":["1.1.1.1:53"],"cname":["example.wordpress.com"],"aaaa":["2a00:1a00::1"],"status_code":"NOERROR"}`,
+	}, "\n")
+
+	var mu sync.Mutex
+	var events []notify.Event
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e notify.Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Errorf("webhook payload: %v", err)
+		}
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}))
+	defer webhook.Close()
+	notifier, err := notify.New(webhook.URL, notify.FormatJSON, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := newTestDB(t)
+	result := ingest(t, db, "dnsx", lines, Options{Notifier: notifier, BatchSize: 100})
+	if result.Findings != 2 {
+		t.Errorf("%d findings recorded, want 2", result.Findings)
+	}
+
+	rows, err := db.Query(`SELECT t.target, f.type, f.severity FROM findings f JOIN targets t ON t.id = f.target_id ORDER BY t.target`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var target, findingType, severity string
+		if err := rows.Scan(&target, &findingType, &severity); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, target+" "+findingType+" "+severity)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"cdn.example.com takeover-azure high", "docs.example.com takeover-github-pages high"}
+	if strings.Join(got, "; ") != strings.Join(want, "; ") {
+		t.Errorf("findings = %v, want %v", got, want)
+	}
+
+	// Run waits for the webhooks before returning
+	var notified []string
+	for _, e := range events {
+		notified = append(notified, e.Target.Target+" "+e.Finding.Type)
+	}
+	sort.Strings(notified)
+	if want := "cdn.example.com takeover-azure; docs.example.com takeover-github-pages"; strings.Join(notified, "; ") != want {
+		t.Errorf("notified %v, want %s", notified, want)
+	}
+}
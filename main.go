@@ -1,126 +1,380 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"regexp" // Add this import
+	"os/signal"
 	"strings"
+	"syscall"
 
+	"ferri/config"
+	"ferri/daemon"
 	"ferri/database"
+	"ferri/ingest"
+	"ferri/notify"
 	"ferri/processors"
 	"ferri/utils"
 )
 
+// Exit codes of an ingest, so pipelines can tell a clean run from a
+// partial one
+const (
+	exitOK          = 0
+	exitFailure     = 1
+	exitPartial     = 2
+	exitInterrupted = 130
+)
+
 func main() {
-	dbPath := utils.ExpandPath("~/bugbounty/db/bounty.db")
-	
-	// Check if there's any data on stdin
-	if !utils.HasStdinData() {
-		fmt.Printf("📭 No input provided via stdin\n")
-		fmt.Printf("💾 Ensuring database exists: %s\n", dbPath)
-		
-		// Ensure database exists before exiting
-		if err := database.EnsureDBExists(dbPath); err != nil {
-			log.Fatalf("❌ Error ensuring database exists: %v\n", err)
+	// Dispatch subcommands; plain invocations ingest from stdin or a file
+	var args []string
+	dbFlag, args = splitDBFlag(os.Args[1:])
+	database.ConfirmMigration = confirmMigration
+	if len(args) > 0 {
+		if cmd, ok := commands[args[0]]; ok {
+			if err := cmd.run(args[1:]); err != nil && err != flag.ErrHelp {
+				log.Fatalf("❌ %v\n", err)
+			}
+			return
 		}
-		
-		fmt.Printf("✅ Database is ready for use\n")
-		fmt.Printf("💡 Usage: echo 'example.com' | ferri\n")
-		fmt.Printf("💡 Usage: subfinder -d example.com | ferri\n")
-		os.Exit(0)
 	}
 
-	// There is stdin data, proceed with normal processing
-	toolName := utils.DetectTool()
+	passthrough := flag.Bool("passthrough", false, "echo each processed target to stdout")
+	quiet := flag.Bool("quiet", false, "suppress status and progress output")
+	jsonOutput := flag.Bool("json", false, "print a single JSON summary instead of status output")
+	programName := flag.String("program", "", "put every target into this program, creating it if needed")
+	programScope := flag.String("scope", "", "scope for a program created by --program")
+	defaultProgram := flag.String("default-program", "", "program for targets no program name can be derived from (e.g. localhost, IPs)")
+	programNaming := flag.String("program-naming", "", "name new programs by first-label (example), registrable-domain (example.com) or full-host (default "+processors.DefaultProgramNaming+")")
+	noScopeGuess := flag.Bool("no-scope-guess", false, "create new programs without a guessed *.domain scope")
+	noCreateProgram := flag.Bool("no-create-program", false, "only ingest into existing programs, skipping targets whose program does not exist")
+	noSchemeGuess := flag.Bool("no-scheme-guess", false, "store URLs without a scheme (example.com/admin) as given instead of as https")
+	stripPrefixes := flag.String("strip-prefixes", "", "comma-separated prefixes stripped from hosts without a registrable domain")
+	inputFile := flag.String("i", "", "read input from this file instead of stdin")
+	toolFlag := flag.String("tool", "", "tool that produced the input, instead of detecting it per file")
+	dryRun := flag.Bool("dry-run", false, "show what would be stored without writing anything")
+	workers := flag.Int("workers", 1, "parse input lines on this many goroutines; writes stay serialized")
+	maxLines := flag.Int("max-lines", 0, "stop after reading this many lines, repeated and comment lines included, leaving the rest of the input unread (0 for no limit)")
+	diff := flag.Bool("diff", false, "print only targets whose response body changed since the last scan")
+	noNotify := flag.Bool("no-notify", false, "do not call the configured webhook for new findings")
+	force := flag.Bool("force", false, "ingest input even if it looks like binary data")
+	commentPrefix := flag.String("comment-prefix", ingest.DefaultCommentPrefix, "skip input lines starting with this prefix as comments ('' to keep them)")
+	noHints := flag.Bool("no-hints", false, "do not suggest a next command after a successful run")
+	flag.BoolVar(&assumeYes, "yes", assumeYes, "migrate an older database without asking (it is still backed up first)")
+	showVersion := flag.Bool("version", false, "print build information and exit")
+	socketPath := flag.String("socket", "", "send the input to the ferri daemon on this socket (default: one next to the database, if running)")
+	noDaemon := flag.Bool("no-daemon", false, "ingest here even if a ferri daemon is running")
+	flag.StringVar(&dbFlag, "db", dbFlag, "database path or go-sqlite3 DSN (e.g. 'file:bounty.db?_journal=WAL'), instead of "+database.DefaultDBPath)
+	flag.Usage = usage
 
-	fmt.Printf("🛠️  Auto-detected tool: %s\n", toolName)
-	fmt.Printf("💾 Database: %s\n", dbPath)
-
-	// Ensure database exists
-	if err := database.EnsureDBExists(dbPath); err != nil {
-		log.Fatalf("❌ Error ensuring database exists: %v\n", err)
+	// "ferri ingest" is the explicit spelling of the default ingest
+	if len(args) > 0 && args[0] == "ingest" {
+		args = args[1:]
 	}
-
-	// Initialize database connection
-	db, err := database.InitDB(dbPath)
+	files, err := parseArgs(flag.CommandLine, args)
 	if err != nil {
-		log.Fatalf("❌ Error initializing database: %v\n", err)
+		log.Fatalf("❌ %v\n", err)
+	}
+	if *showVersion {
+		fmt.Println(versionString())
+		return
+	}
+	if *inputFile != "" {
+		files = append([]string{*inputFile}, files...)
 	}
-	defer db.Close()
-
-	// Read from stdin
-	scanner := bufio.NewScanner(os.Stdin)
-	var targets []string
-	var firstTarget string
 
-	fmt.Printf("📥 Reading from stdin...\n")
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
+	cfg, err := config.Load(config.Path())
+	if err != nil {
+		log.Fatalf("❌ %v\n", err)
+	}
+	if err := applyConfig(cfg); err != nil {
+		log.Fatalf("❌ %v\n", err)
+	}
+	if *defaultProgram == "" {
+		*defaultProgram = cfg.DefaultProgram
+	}
+	if *stripPrefixes != "" {
+		processors.StripPrefixes = strings.Split(*stripPrefixes, ",")
+	}
+	if *programNaming != "" {
+		if err := processors.SetProgramNaming(*programNaming); err != nil {
+			log.Fatalf("❌ %v\n", err)
 		}
-		targets = append(targets, line)
-		if firstTarget == "" {
-			firstTarget = line
+	}
+	if *noScopeGuess {
+		processors.GuessScope = false
+	}
+	if *noCreateProgram {
+		processors.CreatePrograms = false
+	}
+	// The config file's prefix applies unless one was given here
+	if cfg.CommentPrefix != "" && !flagSet(flag.CommandLine, "comment-prefix") {
+		*commentPrefix = cfg.CommentPrefix
+	}
+	if *noSchemeGuess {
+		processors.GuessScheme = false
+	}
+	ignore, err := config.LoadIgnore(config.IgnorePaths()...)
+	if err != nil {
+		log.Fatalf("❌ %v\n", err)
+	}
+
+	// New findings are announced on the configured webhook, except in dry
+	// runs where nothing is kept
+	var notifier *notify.Notifier
+	if cfg.WebhookURL != "" && !*noNotify && !*dryRun {
+		if notifier, err = notify.New(cfg.WebhookURL, cfg.WebhookFormat, notify.DefaultTimeout); err != nil {
+			log.Fatalf("❌ %v\n", err)
 		}
 	}
 
-	if len(targets) == 0 {
-		fmt.Println("❌ No valid targets found in stdin")
-		os.Exit(1)
+	if *workers < 1 {
+		log.Fatalf("❌ --workers must be at least 1\n")
+	}
+	if *maxLines < 0 {
+		log.Fatalf("❌ --max-lines cannot be negative\n")
+	}
+	if *jsonOutput && *passthrough {
+		log.Fatalf("❌ --json and --passthrough both write to stdout; pick one\n")
+	}
+	if *diff && (*jsonOutput || *passthrough) {
+		log.Fatalf("❌ --diff writes to stdout; it cannot be combined with --json or --passthrough\n")
+	}
+	if *quiet || *jsonOutput {
+		utils.Status = io.Discard
 	}
 
-	fmt.Printf("📋 Found %d targets to process\n", len(targets))
+	dbPath, err := resolveDBPath()
+	if err != nil {
+		log.Fatalf("❌ %v\n", err)
+	}
+	dbPath = utils.ExpandPath(dbPath)
 
-	// Extract domain from first target for program creation
-	domain := firstTarget
-	if strings.Contains(firstTarget, "://") {
-		// Extract domain from URL
-		re := regexp.MustCompile(`(?i)https?://([^/]+)`)
-		if matches := re.FindStringSubmatch(firstTarget); len(matches) > 1 {
-			domain = matches[1]
+	// Explicit files win over stdin; otherwise check if there's any data
+	// on stdin. Files are opened up front so a typo fails before anything
+	// is written.
+	var inputs []ingest.Input
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			log.Fatalf("❌ Error opening input: %v\n", err)
 		}
-	} else if strings.Contains(firstTarget, ".") {
-		// Assume it's a domain or subdomain
-		domain = firstTarget
+		defer f.Close()
+		inputs = append(inputs, ingest.Input{Name: name, Reader: f, Tool: utils.DetectToolFromName(name)})
+	}
+	if len(inputs) > 0 {
+		if utils.HasStdinData() {
+			utils.Statusf("⚠️  Reading from %s; ignoring data on stdin\n", strings.Join(files, ", "))
+		}
+	} else if !utils.HasStdinData() {
+		utils.Statusf("📭 No input provided via stdin\n")
+		utils.Statusf("💾 Ensuring database exists: %s\n", dbPath)
+
+		// Ensure database exists before exiting
+		if err := database.EnsureDBExists(dbPath); err != nil {
+			log.Fatalf("❌ Error ensuring database exists: %v\n", err)
+		}
+
+		utils.Statusf("✅ Database is ready for use\n")
+		utils.Statusf("💡 Usage: echo 'example.com' | ferri\n")
+		utils.Statusf("💡 Usage: subfinder -d example.com | ferri\n")
+		utils.Statusf("💡 Usage: ferri ingest subdomains.txt\n")
+		printCommands()
+		os.Exit(exitOK)
+	} else {
+		inputs = []ingest.Input{{Name: "stdin", Reader: os.Stdin}}
 	}
 
-	fmt.Printf("🌐 Extracted domain: %s\n", domain)
+	// Stop cleanly on Ctrl-C: the open batch is rolled back and everything
+	// committed so far is kept
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Get or create program
-	programID, err := processors.GetOrCreateProgram(db, domain)
+	// A running ferri daemon owns the database; hand it the input unless
+	// this run needs something only a local ingest does
+	conn, err := dialDaemon(dbPath, *socketPath, *noDaemon, localOnlyReason(len(inputs), *passthrough, *diff))
 	if err != nil {
-		log.Fatalf("❌ Error getting/creating program: %v\n", err)
+		log.Fatalf("❌ %v\n", err)
 	}
 
-	// Process all targets
-	processedCount := 0
-	for _, target := range targets {
-		targetID, err := processors.GetOrCreateTarget(db, target, toolName, programID)
-		if err != nil {
-			log.Printf("⚠️ Error with target %s: %v\n", target, err)
-			continue
+	var db *sql.DB
+	var summary *ingest.Result
+	if conn != nil {
+		// The input may still name its tool with a #ferri: line, so only
+		// a --tool given here overrides it on the daemon
+		detected := inputs[0].Tool
+		if detected == "" {
+			detected = utils.DetectTool()
+		}
+		utils.Statusf("📡 Sending %s to the ferri daemon on %s\n", inputs[0].Name, conn.RemoteAddr())
+		summary, err = daemon.Ingest(ctx, conn, daemon.Request{
+			Name:           inputs[0].Name,
+			Tool:           *toolFlag,
+			InputTool:      detected,
+			ProgramName:    *programName,
+			ProgramScope:   *programScope,
+			DefaultProgram: *defaultProgram,
+			CommentPrefix:  *commentPrefix,
+			AllowBinary:    *force,
+			DryRun:         *dryRun,
+			NoNotify:       *noNotify,
+			Workers:        *workers,
+			MaxLines:       *maxLines,
+			Ignore:         ignore.Patterns,
+		}, inputs[0].Reader)
+	} else {
+		// There is input, proceed with normal processing
+		utils.Statusf("💾 Database: %s\n", dbPath)
+
+		// Ensure database exists
+		if err := database.EnsureDBExists(dbPath); err != nil {
+			log.Fatalf("❌ Error ensuring database exists: %v\n", err)
 		}
 
-		err = processors.AddReconData(db, targetID, toolName, target, "Discovered via "+toolName)
+		// Initialize database connection
+		db, err = database.InitDB(dbPath)
 		if err != nil {
-			log.Printf("⚠️ Error adding recon data for %s: %v\n", target, err)
-			continue
+			log.Fatalf("❌ Error initializing database: %v\n", err)
+		}
+		defer db.Close()
+
+		// Failed lines are in the JSON summary; only report them otherwise
+		var warnf func(string, ...any)
+		if !*jsonOutput {
+			warnf = log.Printf
+		}
+		opts := ingest.Options{
+			Tool:           *toolFlag,
+			ProgramName:    *programName,
+			ProgramScope:   *programScope,
+			DefaultProgram: *defaultProgram,
+			Ignore:         ignore,
+			CommentPrefix:  *commentPrefix,
+			AllowBinary:    *force,
+			DryRun:         *dryRun,
+			Workers:        *workers,
+			MaxLines:       *maxLines,
+			Notifier:       notifier,
+			Warnf:          warnf,
+		}
+		if *passthrough {
+			opts.Passthrough = os.Stdout
 		}
+		if *diff {
+			opts.Changed = os.Stdout
+		}
+		summary, err = ingest.Run(ctx, db, inputs, opts)
+	}
+	if errors.Is(err, processors.ErrInvalidProgramDomain) {
+		log.Fatalf("❌ %v; pass --default-program to collect such targets\n", err)
+	} else if errors.Is(err, processors.ErrProgramNotFound) {
+		log.Fatalf("❌ %v; create it first or drop --no-create-program\n", err)
+	} else if errors.Is(err, ingest.ErrBinaryInput) {
+		log.Fatalf("❌ %v; nothing was written (pass --force to ingest it anyway)\n", err)
+	} else if err != nil {
+		log.Fatalf("❌ %v\n", err)
+	}
+
+	if summary.Interrupted {
+		utils.Statusf("\n🛑 Interrupted! Committed %d/%d targets for program ID: %d (%d uncommitted rolled back)\n",
+			summary.Processed, summary.Total, summary.ProgramID, summary.RolledBack)
+		if *jsonOutput {
+			printSummary(summary)
+		}
+		if db != nil {
+			db.Close()
+		}
+		os.Exit(exitInterrupted)
+	}
 
-		processedCount++
-		fmt.Printf("✅ %s\n", target)
+	if summary.Total == 0 {
+		utils.Statusf("❌ No valid targets found in input\n")
+		if *jsonOutput {
+			printSummary(summary)
+		}
+		os.Exit(exitFailure)
 	}
 
-	fmt.Printf("\n🎉 Completed! Processed %d/%d targets for program ID: %d\n", 
-		processedCount, len(targets), programID)
-	
-	if processedCount > 0 {
-		fmt.Printf("💡 Next: Use 'ferro' to analyze your data!\n")
-	} else {
-		fmt.Printf("❌ No targets were processed successfully\n")
-		os.Exit(1)
+	if *jsonOutput {
+		printSummary(summary)
 	}
+
+	utils.Statusf("\n🎉 Completed! Processed %d/%d targets for program ID: %d\n",
+		summary.Processed, summary.Total, summary.ProgramID)
+	if len(summary.Files) > 1 {
+		for _, f := range summary.Files {
+			utils.Statusf("📄 %s (%s): %d/%d processed\n", f.Name, f.Tool, f.Processed, f.Total)
+		}
+	}
+	if summary.Truncated {
+		utils.Statusf("✂️  Stopped after reading %d lines (--max-lines); the rest of the input was not read\n", *maxLines)
+	}
+	if summary.RunID > 0 {
+		utils.Statusf("🧾 Recorded as run %d (revert with 'ferri undo %d')\n", summary.RunID, summary.RunID)
+	}
+	if summary.Duplicates > 0 {
+		utils.Statusf("♻️  Collapsed %d duplicate lines\n", summary.Duplicates)
+	}
+	if summary.Ignored > 0 {
+		utils.Statusf("🙈 Skipped %d targets matching .ferriignore\n", summary.Ignored)
+	}
+	if summary.Comments > 0 {
+		utils.Statusf("💬 Skipped %d comment lines\n", summary.Comments)
+	}
+	if summary.Changed > 0 {
+		utils.Statusf("🔄 %d pages changed since the last scan\n", summary.Changed)
+	}
+	if summary.DNSRecords > 0 {
+		utils.Statusf("🧭 Stored %d DNS records\n", summary.DNSRecords)
+	}
+	if summary.Findings > 0 {
+		utils.Statusf("🚨 Recorded %d new findings\n", summary.Findings)
+	}
+	if *dryRun {
+		utils.Statusf("🧪 DRY RUN — nothing written (%d targets would be created, %d already exist)\n",
+			summary.Created, summary.Existing)
+	}
+
+	switch {
+	case summary.Processed == 0 && summary.Ignored == 0:
+		utils.Statusf("❌ No targets were processed successfully\n")
+		os.Exit(exitFailure)
+	case len(summary.Errors) > 0:
+		utils.Statusf("⚠️  %d lines or targets failed; exiting with status %d\n", len(summary.Errors), exitPartial)
+		os.Exit(exitPartial)
+	}
+	// The hint is for people at a terminal, not for scripts reading stdout
+	if !*noHints && !*jsonOutput && utils.IsTerminal(os.Stdout) {
+		utils.Statusf("💡 Next: 'ferri targets %s' or 'ferri stats %s' to explore the data\n",
+			summary.ProgramName, summary.ProgramName)
+	}
+}
+
+// printSummary writes the ingest result to stdout as a single JSON object
+func printSummary(summary *ingest.Result) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(summary); err != nil {
+		log.Printf("⚠️ Error writing JSON summary: %v\n", err)
+	}
+}
+
+// usage prints the ingest flags followed by the available subcommands
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: <tool> | ferri [flags]\n       ferri [ingest] [flags] <file>\n\nFlags:\n")
+	flag.PrintDefaults()
+	fmt.Fprintf(flag.CommandLine.Output(), "\nExit status:\n"+
+		"  %-3d every line was ingested (or no input: the database was just set up)\n"+
+		"  %-3d some lines or targets failed, the rest were ingested\n"+
+		"  %-3d nothing was ingested\n"+
+		"  %-3d interrupted; completed batches were kept\n\n",
+		exitOK, exitPartial, exitFailure, exitInterrupted)
+	printCommands()
 }
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// DNSRecordType is the kind of a stored DNS record
+type DNSRecordType string
+
+const (
+	DNSRecordA     DNSRecordType = "A"
+	DNSRecordAAAA  DNSRecordType = "AAAA"
+	DNSRecordCNAME DNSRecordType = "CNAME"
+	DNSRecordNS    DNSRecordType = "NS"
+	DNSRecordMX    DNSRecordType = "MX"
+)
+
+// DNSRecord is a record a domain target resolved to, such as an address
+// or a hop of its CNAME chain
+type DNSRecord struct {
+	ID       int           `json:"id"`
+	TargetID int           `json:"target_id"`
+	Type     DNSRecordType `json:"type"`
+	Value    string        `json:"value"`
+	// Position orders the records of a type as the resolver returned
+	// them, so a CNAME chain reads from the target to its final name
+	Position   int       `json:"position,omitempty"`
+	ResolvedAt time.Time `json:"resolved_at"`
+}
+
+// DNSRecordService defines the interface for DNS record operations
+type DNSRecordService interface {
+	GetByTargetID(targetID int) ([]*DNSRecord, error)
+	ListByValue(value string) ([]*DNSRecord, error)
+}
+
+// DNSRecordRepository implements DNSRecordService with database operations
+type DNSRecordRepository struct {
+	DB *sql.DB
+}
+
+// NewDNSRecordRepository creates a new DNS record repository
+func NewDNSRecordRepository(db *sql.DB) *DNSRecordRepository {
+	return &DNSRecordRepository{DB: db}
+}
+
+// GetByTargetID retrieves the records a target last resolved to
+func (r *DNSRecordRepository) GetByTargetID(targetID int) ([]*DNSRecord, error) {
+	query := `SELECT id, target_id, type, value, position, resolved_at
+	          FROM dns_records WHERE target_id = ? ORDER BY type, position, value`
+	return r.queryRecords(query, targetID)
+}
+
+// ListByValue retrieves every record pointing at an address, to pivot from
+// an IP to the hosts served from it
+func (r *DNSRecordRepository) ListByValue(value string) ([]*DNSRecord, error) {
+	query := `SELECT id, target_id, type, value, position, resolved_at
+	          FROM dns_records WHERE value = ? ORDER BY target_id`
+	return r.queryRecords(query, value)
+}
+
+func (r *DNSRecordRepository) queryRecords(query string, args ...any) ([]*DNSRecord, error) {
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*DNSRecord
+	for rows.Next() {
+		record := &DNSRecord{}
+		if err := rows.Scan(&record.ID, &record.TargetID, &record.Type, &record.Value, &record.Position, &record.ResolvedAt); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
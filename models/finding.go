@@ -1,7 +1,11 @@
 package models
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -16,6 +20,41 @@ const (
 	SeverityInfo     FindingSeverity = "info"
 )
 
+// severityLevels lists the severities from most to least severe
+var severityLevels = []FindingSeverity{SeverityCritical, SeverityHigh, SeverityMedium, SeverityLow, SeverityInfo}
+
+// Valid reports whether s is one of the defined severities
+func (s FindingSeverity) Valid() bool {
+	for _, level := range severityLevels {
+		if s == level {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSeverity returns the severity named by s, ignoring case
+func ParseSeverity(s string) (FindingSeverity, error) {
+	severity := FindingSeverity(strings.ToLower(strings.TrimSpace(s)))
+	if !severity.Valid() {
+		return "", fmt.Errorf("invalid severity %q (want one of %s)", s, joinValues(severityLevels))
+	}
+	return severity, nil
+}
+
+// SeverityRank returns an SQL expression ranking column by severity, lowest
+// first. Severity is stored as text, so sorting the column directly would
+// put low before medium.
+func SeverityRank(column string) string {
+	var b strings.Builder
+	b.WriteString("CASE LOWER(" + column + ")")
+	for i, s := range severityLevels {
+		fmt.Fprintf(&b, " WHEN '%s' THEN %d", s, i)
+	}
+	fmt.Fprintf(&b, " ELSE %d END", len(severityLevels))
+	return b.String()
+}
+
 // FindingStatus represents the status of a finding
 type FindingStatus string
 
@@ -28,29 +67,148 @@ const (
 	StatusWontFix   FindingStatus = "Won't Fix"
 )
 
+// findingStatuses lists every defined status in workflow order
+var findingStatuses = []FindingStatus{StatusOpen, StatusInReview, StatusTriaged, StatusResolved, StatusDuplicate, StatusWontFix}
+
+// StatusRank returns an SQL expression ranking column by status in
+// workflow order, Open first
+func StatusRank(column string) string {
+	var b strings.Builder
+	b.WriteString("CASE " + column)
+	for i, s := range findingStatuses {
+		fmt.Fprintf(&b, " WHEN '%s' THEN %d", strings.ReplaceAll(string(s), "'", "''"), i)
+	}
+	b.WriteString(" ELSE -1 END")
+	return b.String()
+}
+
+// Valid reports whether s is one of the defined statuses
+func (s FindingStatus) Valid() bool {
+	for _, status := range findingStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseStatus returns the status named by s, ignoring case, so "won't fix"
+// becomes StatusWontFix
+func ParseStatus(s string) (FindingStatus, error) {
+	trimmed := strings.TrimSpace(s)
+	for _, status := range findingStatuses {
+		if strings.EqualFold(trimmed, string(status)) {
+			return status, nil
+		}
+	}
+	return "", fmt.Errorf("invalid status %q (want one of %s)", s, joinValues(findingStatuses))
+}
+
+// joinValues lists the allowed values of a string enum for error messages
+func joinValues[T ~string](values []T) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = fmt.Sprintf("%q", v)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// DefaultSeverity is given to findings stored without a severity. The
+// config file's default_severity sets it through SetDefaultSeverity.
+var DefaultSeverity = SeverityInfo
+
+// SetDefaultSeverity makes the severity named by s the DefaultSeverity
+func SetDefaultSeverity(s string) error {
+	severity, err := ParseSeverity(s)
+	if err != nil {
+		return fmt.Errorf("default severity: %v", err)
+	}
+	DefaultSeverity = severity
+	return nil
+}
+
+// validate normalizes the finding's severity and status to their canonical
+// spelling, rejecting values outside the defined sets. A missing severity
+// becomes DefaultSeverity and a missing status StatusOpen, so no finding is
+// stored blank where filters and severity ordering would miss it.
+func (f *Finding) validate() error {
+	if strings.TrimSpace(string(f.Severity)) == "" {
+		f.Severity = DefaultSeverity
+	}
+	if strings.TrimSpace(string(f.Status)) == "" {
+		f.Status = StatusOpen
+	}
+	severity, err := ParseSeverity(string(f.Severity))
+	if err != nil {
+		return err
+	}
+	status, err := ParseStatus(string(f.Status))
+	if err != nil {
+		return err
+	}
+	f.Severity, f.Status = severity, status
+	return nil
+}
+
 // Finding represents a security finding/vulnerability
 type Finding struct {
 	ID              int              `json:"id"`
 	TargetID        int              `json:"target_id"`
 	Title           string           `json:"title"`
-	Type            sql.NullString   `json:"type,omitempty"`
+	Type            NullString       `json:"type,omitempty"`
 	Severity        FindingSeverity  `json:"severity"`
-	Description     sql.NullString   `json:"description,omitempty"`
-	ProofOfConcept  sql.NullString   `json:"proof_of_concept,omitempty"`
+	Description     NullString       `json:"description,omitempty"`
+	ProofOfConcept  NullString       `json:"proof_of_concept,omitempty"`
 	Status          FindingStatus    `json:"status"`
-	ReportedDate    sql.NullTime     `json:"reported_date,omitempty"`
-	ReportID        sql.NullString   `json:"report_id,omitempty"`
-	Notes           sql.NullString   `json:"notes,omitempty"`
+	ReportedDate    NullTime         `json:"reported_date,omitempty"`
+	ReportID        NullString       `json:"report_id,omitempty"`
+	Notes           NullString       `json:"notes,omitempty"`
 	CreatedAt       time.Time        `json:"created_at"`
 }
 
+// FindingFilter narrows FindingRepository.List; zero fields match everything
+type FindingFilter struct {
+	ProgramName string
+	Severity    FindingSeverity
+	Status      FindingStatus
+}
+
+// FindingDetail is a finding together with the target and program it
+// belongs to, as needed for reports
+type FindingDetail struct {
+	Finding
+	ProgramID   int    `json:"program_id"`
+	ProgramName string `json:"program_name"`
+	Target      string `json:"target"`
+}
+
+// FindingGroup is every finding sharing a title, such as one CVE reported on
+// many hosts
+type FindingGroup struct {
+	Title string `json:"title"`
+	// Severity is the highest severity among the findings
+	Severity FindingSeverity `json:"severity"`
+	Targets  int             `json:"targets"`
+	Findings int             `json:"findings"`
+}
+
+// ErrDuplicateFinding is returned by Create when the target already has a
+// finding with the same title and type; Upsert updates that one instead
+var ErrDuplicateFinding = errors.New("the target already has a finding with this title and type")
+
 // FindingService defines the interface for finding operations
 type FindingService interface {
 	Create(finding *Finding) error
+	Upsert(finding *Finding) error
 	GetByID(id int) (*Finding, error)
 	GetByTargetID(targetID int) ([]*Finding, error)
+	GetByProgramID(programID int) ([]*Finding, error)
+	GetByReportID(reportID string) (*Finding, error)
 	GetBySeverity(severity FindingSeverity) ([]*Finding, error)
 	GetByStatus(status FindingStatus) ([]*Finding, error)
+	List(filter FindingFilter) ([]*FindingDetail, error)
+	ListPage(filter FindingFilter, page Page) ([]*FindingDetail, int, error)
+	GroupByTitle(programID int) ([]*FindingGroup, error)
 	Update(finding *Finding) error
 	Delete(id int) error
 }
@@ -67,14 +225,30 @@ func NewFindingRepository(db *sql.DB) *FindingRepository {
 
 // Create inserts a new finding into the database
 func (r *FindingRepository) Create(finding *Finding) error {
+	return createFinding(r.DB.Exec, finding)
+}
+
+// CreateTx inserts a new finding as part of a transaction
+func (r *FindingRepository) CreateTx(tx *sql.Tx, finding *Finding) error {
+	return createFinding(tx.Exec, finding)
+}
+
+// createFinding inserts a finding through exec and sets its ID
+func createFinding(exec func(query string, args ...any) (sql.Result, error), finding *Finding) error {
+	if err := finding.validate(); err != nil {
+		return err
+	}
+
 	query := `INSERT INTO findings (target_id, title, type, severity, description, 
 	          proof_of_concept, status, reported_date, report_id, notes) 
 	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	
-	result, err := r.DB.Exec(query, finding.TargetID, finding.Title, finding.Type, 
+	result, err := exec(query, finding.TargetID, finding.Title, finding.Type, 
 		finding.Severity, finding.Description, finding.ProofOfConcept, finding.Status,
 		finding.ReportedDate, finding.ReportID, finding.Notes)
-	if err != nil {
+	if err != nil && strings.Contains(err.Error(), "idx_findings_key") {
+		return ErrDuplicateFinding
+	} else if err != nil {
 		return err
 	}
 	
@@ -87,6 +261,62 @@ func (r *FindingRepository) Create(finding *Finding) error {
 	return nil
 }
 
+// RowQuerier runs a query returning at most one row; *sql.DB, *sql.Tx and
+// the ingest's prepared statements all satisfy it
+type RowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Upsert inserts a finding unless its target already has one with the same
+// title and type, in which case that finding's severity, description and
+// status are updated instead, keeping its ID and created_at. Either way the
+// finding's ID and CreatedAt are set from the stored row.
+func (r *FindingRepository) Upsert(finding *Finding) error {
+	_, err := UpsertFinding(context.Background(), r.DB, finding)
+	return err
+}
+
+// UpsertFinding is FindingRepository.Upsert through q, such as an open
+// transaction. Only what the caller gave is updated: an empty severity or
+// status and a NULL description leave the stored ones alone, so a scanner
+// re-reporting a finding does not undo its triage. It reports whether the
+// finding was created.
+func UpsertFinding(ctx context.Context, q RowQuerier, finding *Finding) (bool, error) {
+	newSeverity := strings.TrimSpace(string(finding.Severity)) != ""
+	newStatus := strings.TrimSpace(string(finding.Status)) != ""
+	if err := finding.validate(); err != nil {
+		return false, err
+	}
+
+	// The unique key makes the insert a no-op for a known finding, which
+	// then returns no row
+	insert := `INSERT INTO findings (target_id, title, type, severity, description, 
+	          proof_of_concept, status, reported_date, report_id, notes) 
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	          ON CONFLICT(target_id, title, COALESCE(type, '')) DO NOTHING
+	          RETURNING id, created_at`
+	err := q.QueryRowContext(ctx, insert, finding.TargetID, finding.Title, finding.Type,
+		finding.Severity, finding.Description, finding.ProofOfConcept, finding.Status,
+		finding.ReportedDate, finding.ReportID, finding.Notes,
+	).Scan(&finding.ID, &finding.CreatedAt)
+	if err == nil {
+		return true, nil
+	} else if err != sql.ErrNoRows {
+		return false, err
+	}
+
+	update := `UPDATE findings SET
+	          severity = CASE WHEN ? THEN ? ELSE severity END,
+	          status = CASE WHEN ? THEN ? ELSE status END,
+	          description = COALESCE(?, description)
+	          WHERE target_id = ? AND title = ? AND COALESCE(type, '') = COALESCE(?, '')
+	          RETURNING id, created_at, severity, status`
+	err = q.QueryRowContext(ctx, update, newSeverity, finding.Severity, newStatus, finding.Status,
+		finding.Description, finding.TargetID, finding.Title, finding.Type,
+	).Scan(&finding.ID, &finding.CreatedAt, &finding.Severity, &finding.Status)
+	return false, err
+}
+
 // GetByID retrieves a finding by its ID
 func (r *FindingRepository) GetByID(id int) (*Finding, error) {
 	query := `SELECT id, target_id, title, type, severity, description, 
@@ -106,11 +336,31 @@ func (r *FindingRepository) GetByID(id int) (*Finding, error) {
 	return finding, nil
 }
 
+// GetByReportID retrieves the finding filed as a platform report, such as
+// a HackerOne report id. It returns sql.ErrNoRows when none was recorded.
+func (r *FindingRepository) GetByReportID(reportID string) (*Finding, error) {
+	query := `SELECT id, target_id, title, type, severity, description, 
+	          proof_of_concept, status, reported_date, report_id, notes, created_at 
+	          FROM findings WHERE report_id = ?`
+
+	finding := &Finding{}
+	err := r.DB.QueryRow(query, reportID).Scan(
+		&finding.ID, &finding.TargetID, &finding.Title, &finding.Type, &finding.Severity,
+		&finding.Description, &finding.ProofOfConcept, &finding.Status, &finding.ReportedDate,
+		&finding.ReportID, &finding.Notes, &finding.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return finding, nil
+}
+
 // GetByTargetID retrieves all findings for a specific target
 func (r *FindingRepository) GetByTargetID(targetID int) ([]*Finding, error) {
 	query := `SELECT id, target_id, title, type, severity, description, 
 	          proof_of_concept, status, reported_date, report_id, notes, created_at 
-	          FROM findings WHERE target_id = ? ORDER BY severity DESC, created_at DESC`
+	          FROM findings WHERE target_id = ? ORDER BY ` + SeverityRank("severity") + `, created_at DESC`
 	
 	rows, err := r.DB.Query(query, targetID)
 	if err != nil {
@@ -135,6 +385,38 @@ func (r *FindingRepository) GetByTargetID(targetID int) ([]*Finding, error) {
 	return findings, nil
 }
 
+// GetByProgramID retrieves all findings on the targets of a program, most
+// severe first
+func (r *FindingRepository) GetByProgramID(programID int) ([]*Finding, error) {
+	query := `SELECT f.id, f.target_id, f.title, f.type, f.severity, f.description, 
+	          f.proof_of_concept, f.status, f.reported_date, f.report_id, f.notes, f.created_at 
+	          FROM findings f
+	          JOIN targets t ON t.id = f.target_id
+	          WHERE t.program_id = ? ORDER BY ` + SeverityRank("f.severity") + `, f.created_at DESC`
+
+	rows, err := r.DB.Query(query, programID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var findings []*Finding
+	for rows.Next() {
+		finding := &Finding{}
+		err := rows.Scan(
+			&finding.ID, &finding.TargetID, &finding.Title, &finding.Type, &finding.Severity,
+			&finding.Description, &finding.ProofOfConcept, &finding.Status, &finding.ReportedDate,
+			&finding.ReportID, &finding.Notes, &finding.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, finding)
+	}
+
+	return findings, rows.Err()
+}
+
 // GetBySeverity retrieves all findings with a specific severity
 func (r *FindingRepository) GetBySeverity(severity FindingSeverity) ([]*Finding, error) {
 	query := `SELECT id, target_id, title, type, severity, description, 
@@ -167,7 +449,7 @@ func (r *FindingRepository) GetBySeverity(severity FindingSeverity) ([]*Finding,
 func (r *FindingRepository) GetByStatus(status FindingStatus) ([]*Finding, error) {
 	query := `SELECT id, target_id, title, type, severity, description, 
 	          proof_of_concept, status, reported_date, report_id, notes, created_at 
-	          FROM findings WHERE status = ? ORDER BY severity DESC, created_at DESC`
+	          FROM findings WHERE status = ? ORDER BY ` + SeverityRank("severity") + `, created_at DESC`
 	
 	rows, err := r.DB.Query(query, status)
 	if err != nil {
@@ -192,8 +474,91 @@ func (r *FindingRepository) GetByStatus(status FindingStatus) ([]*Finding, error
 	return findings, nil
 }
 
+// List retrieves findings matching filter along with their target and program
+func (r *FindingRepository) List(filter FindingFilter) ([]*FindingDetail, error) {
+	return r.list(filter, Page{})
+}
+
+// ListPage retrieves one page of the findings List returns, along with how
+// many it returns in all
+func (r *FindingRepository) ListPage(filter FindingFilter, page Page) ([]*FindingDetail, int, error) {
+	where, args := filter.where()
+	total, err := count(r.DB, "SELECT COUNT(*) "+findingDetailFrom+where, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	findings, err := r.list(filter, page)
+	return findings, total, err
+}
+
+// findingDetailFrom joins findings to the targets and programs that
+// FindingDetail describes them with
+const findingDetailFrom = `FROM findings f
+	          JOIN targets t ON t.id = f.target_id
+	          JOIN programs p ON p.id = t.program_id`
+
+// where returns the WHERE clause of the filter and its arguments
+func (filter FindingFilter) where() (string, []any) {
+	var where []string
+	var args []any
+	if filter.ProgramName != "" {
+		where = append(where, "p.name = ? COLLATE NOCASE")
+		args = append(args, filter.ProgramName)
+	}
+	if filter.Severity != "" {
+		where = append(where, "f.severity = ?")
+		args = append(args, filter.Severity)
+	}
+	if filter.Status != "" {
+		where = append(where, "f.status = ?")
+		args = append(args, filter.Status)
+	}
+	if len(where) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(where, " AND "), args
+}
+
+// list runs List, cut to page
+func (r *FindingRepository) list(filter FindingFilter, page Page) ([]*FindingDetail, error) {
+	where, args := filter.where()
+	query := `SELECT f.id, f.target_id, f.title, f.type, f.severity, f.description, 
+	          f.proof_of_concept, f.status, f.reported_date, f.report_id, f.notes, f.created_at,
+	          p.id, p.name, ` + addressSQL("t.") + `
+	          ` + findingDetailFrom + where
+	query += " ORDER BY " + SeverityRank("f.severity") + ", f.created_at DESC, f.id DESC"
+	query, args = page.apply(query, args)
+
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var findings []*FindingDetail
+	for rows.Next() {
+		d := &FindingDetail{}
+		err := rows.Scan(
+			&d.ID, &d.TargetID, &d.Title, &d.Type, &d.Severity,
+			&d.Description, &d.ProofOfConcept, &d.Status, &d.ReportedDate,
+			&d.ReportID, &d.Notes, &d.CreatedAt,
+			&d.ProgramID, &d.ProgramName, &d.Target,
+		)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, d)
+	}
+
+	return findings, rows.Err()
+}
+
 // Update modifies an existing finding
 func (r *FindingRepository) Update(finding *Finding) error {
+	if err := finding.validate(); err != nil {
+		return err
+	}
+
 	query := `UPDATE findings SET target_id = ?, title = ?, type = ?, severity = ?, 
 	          description = ?, proof_of_concept = ?, status = ?, reported_date = ?, 
 	          report_id = ?, notes = ? WHERE id = ?`
@@ -211,3 +576,38 @@ func (r *FindingRepository) Delete(id int) error {
 	_, err := r.DB.Exec(query, id)
 	return err
 }
+
+// GroupByTitle groups findings by title, counting the targets each title
+// was found on, most severe and widespread first. A programID of 0 groups
+// the findings of every program.
+func (r *FindingRepository) GroupByTitle(programID int) ([]*FindingGroup, error) {
+	query := `SELECT f.title, MIN(` + SeverityRank("f.severity") + `), COUNT(DISTINCT f.target_id), COUNT(*)
+	          FROM findings f
+	          JOIN targets t ON t.id = f.target_id`
+	var args []any
+	if programID != 0 {
+		query += " WHERE t.program_id = ?"
+		args = append(args, programID)
+	}
+	query += ` GROUP BY f.title ORDER BY 2, 3 DESC, f.title`
+
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []*FindingGroup
+	for rows.Next() {
+		g := &FindingGroup{}
+		var rank int
+		if err := rows.Scan(&g.Title, &rank, &g.Targets, &g.Findings); err != nil {
+			return nil, err
+		}
+		if rank < len(severityLevels) {
+			g.Severity = severityLevels[rank]
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
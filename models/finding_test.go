@@ -0,0 +1,282 @@
+package models
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ferri/database"
+)
+
+// newTestDB returns a migrated database holding one program with one target
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bounty.db")
+	if err := database.EnsureDBExists(path); err != nil {
+		t.Fatal(err)
+	}
+	db, err := database.InitDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("INSERT INTO programs (name) VALUES ('example')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO targets (program_id, target, type) VALUES (1, 'a.example.com', 'subdomain')"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestFindingUpsert(t *testing.T) {
+	tests := []struct {
+		name   string
+		first  Finding
+		second Finding
+		// want is the stored finding after both upserts
+		wantSeverity    FindingSeverity
+		wantStatus      FindingStatus
+		wantDescription string
+		wantRows        int
+	}{
+		{
+			name:         "rescan raises the severity",
+			first:        Finding{Title: "XSS", Type: NewNullString("xss"), Severity: SeverityLow},
+			second:       Finding{Title: "XSS", Type: NewNullString("xss"), Severity: SeverityHigh},
+			wantSeverity: SeverityHigh, wantStatus: StatusOpen, wantRows: 1,
+		},
+		{
+			name:         "rescan without a status keeps the triaged one",
+			first:        Finding{Title: "XSS", Severity: SeverityLow, Status: StatusTriaged},
+			second:       Finding{Title: "XSS", Severity: SeverityLow},
+			wantSeverity: SeverityLow, wantStatus: StatusTriaged, wantRows: 1,
+		},
+		{
+			name:         "given status is applied",
+			first:        Finding{Title: "XSS", Severity: SeverityLow},
+			second:       Finding{Title: "XSS", Severity: SeverityLow, Status: StatusResolved},
+			wantSeverity: SeverityLow, wantStatus: StatusResolved, wantRows: 1,
+		},
+		{
+			name:         "missing description keeps the stored one",
+			first:        Finding{Title: "XSS", Severity: SeverityLow, Description: NewNullString("reflected in q")},
+			second:       Finding{Title: "XSS", Severity: SeverityMedium},
+			wantSeverity: SeverityMedium, wantStatus: StatusOpen,
+			wantDescription: "reflected in q", wantRows: 1,
+		},
+		{
+			name:         "empty and NULL type are the same key",
+			first:        Finding{Title: "XSS", Type: NewNullString(""), Severity: SeverityLow},
+			second:       Finding{Title: "XSS", Severity: SeverityCritical},
+			wantSeverity: SeverityCritical, wantStatus: StatusOpen, wantRows: 1,
+		},
+		{
+			name:         "another type is another finding",
+			first:        Finding{Title: "XSS", Type: NewNullString("xss"), Severity: SeverityLow},
+			second:       Finding{Title: "XSS", Type: NewNullString("xss-dom"), Severity: SeverityHigh},
+			wantSeverity: SeverityHigh, wantStatus: StatusOpen, wantRows: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			repo := NewFindingRepository(db)
+
+			first, second := tt.first, tt.second
+			first.TargetID, second.TargetID = 1, 1
+			if err := repo.Upsert(&first); err != nil {
+				t.Fatalf("first Upsert: %v", err)
+			}
+			if err := repo.Upsert(&second); err != nil {
+				t.Fatalf("second Upsert: %v", err)
+			}
+
+			var rows int
+			if err := db.QueryRow("SELECT COUNT(*) FROM findings").Scan(&rows); err != nil {
+				t.Fatal(err)
+			}
+			if rows != tt.wantRows {
+				t.Errorf("%d findings stored, want %d", rows, tt.wantRows)
+			}
+			if tt.wantRows == 1 && second.ID != first.ID {
+				t.Errorf("second Upsert got ID %d, want the first one's %d", second.ID, first.ID)
+			}
+			if tt.wantRows == 1 && !second.CreatedAt.Equal(first.CreatedAt) {
+				t.Errorf("created_at changed from %v to %v", first.CreatedAt, second.CreatedAt)
+			}
+
+			stored, err := repo.GetByID(second.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Severity != tt.wantSeverity {
+				t.Errorf("severity = %s, want %s", stored.Severity, tt.wantSeverity)
+			}
+			if stored.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", stored.Status, tt.wantStatus)
+			}
+			if stored.Description.String != tt.wantDescription {
+				t.Errorf("description = %q, want %q", stored.Description.String, tt.wantDescription)
+			}
+		})
+	}
+}
+
+func TestUpsertFindingReportsCreation(t *testing.T) {
+	db := newTestDB(t)
+	f := &Finding{TargetID: 1, Title: "XSS", Severity: SeverityLow}
+	for i, want := range []bool{true, false, false} {
+		created, err := UpsertFinding(t.Context(), db, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created != want {
+			t.Errorf("upsert %d: created = %v, want %v", i+1, created, want)
+		}
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    FindingSeverity
+		wantErr bool
+	}{
+		{"critical", SeverityCritical, false},
+		{"HIGH", SeverityHigh, false},
+		{" Medium ", SeverityMedium, false},
+		{"info", SeverityInfo, false},
+		{"Crit", "", true},
+		{"hgih", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSeverity(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseSeverity(%q) = %q, %v; want %q, error %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+		// Valid accepts only the canonical spelling
+		if FindingSeverity(tt.input).Valid() != (tt.input == string(tt.want) && !tt.wantErr) {
+			t.Errorf("FindingSeverity(%q).Valid() = %v", tt.input, !tt.wantErr)
+		}
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    FindingStatus
+		wantErr bool
+	}{
+		{"Open", StatusOpen, false},
+		{"in review", StatusInReview, false},
+		{"won't fix", StatusWontFix, false},
+		{" RESOLVED ", StatusResolved, false},
+		{"closed", "", true},
+		{"Opne", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseStatus(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseStatus(%q) = %q, %v; want %q, error %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+		// Valid accepts only the canonical spelling
+		if FindingStatus(tt.input).Valid() != (tt.input == string(tt.want) && !tt.wantErr) {
+			t.Errorf("FindingStatus(%q).Valid() = %v", tt.input, !tt.wantErr)
+		}
+	}
+}
+
+func TestFindingWritesValidateSeverityAndStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		severity     FindingSeverity
+		status       FindingStatus
+		wantSeverity FindingSeverity
+		wantStatus   FindingStatus
+		wantErr      bool
+	}{
+		{"canonical values", SeverityHigh, StatusTriaged, SeverityHigh, StatusTriaged, false},
+		{"other case is normalized", "HIGH", "in review", SeverityHigh, StatusInReview, false},
+		{"blank gets the defaults", "", "", DefaultSeverity, StatusOpen, false},
+		{"severity typo", "Crit", StatusOpen, "", "", true},
+		{"status typo", SeverityLow, "Opne", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			repo := NewFindingRepository(db)
+
+			created := &Finding{TargetID: 1, Title: "XSS", Severity: tt.severity, Status: tt.status}
+			err := repo.Create(created)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Create error = %v, want error %v", err, tt.wantErr)
+			}
+
+			// Update validates the same way, on a finding stored with valid values
+			updated := &Finding{TargetID: 1, Title: "SQLi", Severity: SeverityLow}
+			if err := repo.Create(updated); err != nil {
+				t.Fatal(err)
+			}
+			updated.Severity, updated.Status = tt.severity, tt.status
+			if err := repo.Update(updated); (err != nil) != tt.wantErr {
+				t.Fatalf("Update error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if stored, _ := repo.GetByID(updated.ID); stored.Severity != SeverityLow || stored.Status != StatusOpen {
+					t.Errorf("rejected Update stored %s/%s", stored.Severity, stored.Status)
+				}
+				return
+			}
+			for _, f := range []*Finding{created, updated} {
+				stored, err := repo.GetByID(f.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if stored.Severity != tt.wantSeverity || stored.Status != tt.wantStatus {
+					t.Errorf("%s stored as %s/%s, want %s/%s", f.Title, stored.Severity, stored.Status, tt.wantSeverity, tt.wantStatus)
+				}
+			}
+		})
+	}
+}
+
+func TestFindingFiltersUseIndexes(t *testing.T) {
+	tests := []struct {
+		filter string
+		arg    any
+		index  string
+	}{
+		{"severity = ?", SeverityHigh, "idx_findings_severity"},
+		{"status = ?", StatusOpen, "idx_findings_status"},
+		{"target_id = ?", 1, "idx_findings_target"},
+	}
+	db := newTestDB(t)
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			rows, err := db.Query("EXPLAIN QUERY PLAN SELECT id FROM findings WHERE "+tt.filter, tt.arg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			var plan []string
+			for rows.Next() {
+				var id, parent, unused int
+				var detail string
+				if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+					t.Fatal(err)
+				}
+				plan = append(plan, detail)
+			}
+			if err := rows.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(plan, "; "); !strings.Contains(got, "INDEX "+tt.index) {
+				t.Errorf("plan for %s is %q, want it to use %s", tt.filter, got, tt.index)
+			}
+		})
+	}
+}
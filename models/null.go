@@ -0,0 +1,95 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// NullString is a sql.NullString that marshals to JSON as its string or
+// null, instead of as an object with String and Valid fields
+type NullString struct {
+	sql.NullString
+}
+
+// NewNullString returns s as a NullString, NULL when s is empty
+func NewNullString(s string) NullString {
+	return NullString{sql.NullString{String: s, Valid: s != ""}}
+}
+
+func (n NullString) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(n.String)
+}
+
+func (n *NullString) UnmarshalJSON(data []byte) error {
+	*n = NullString{}
+	if string(data) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(data, &n.String); err != nil {
+		return err
+	}
+	n.Valid = true
+	return nil
+}
+
+// NullTime is a sql.NullTime that marshals to JSON as its time or null
+type NullTime struct {
+	sql.NullTime
+}
+
+// NewNullTime returns t as a NullTime, NULL when t is the zero time
+func NewNullTime(t time.Time) NullTime {
+	return NullTime{sql.NullTime{Time: t, Valid: !t.IsZero()}}
+}
+
+func (n NullTime) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(n.Time)
+}
+
+func (n *NullTime) UnmarshalJSON(data []byte) error {
+	*n = NullTime{}
+	if string(data) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(data, &n.Time); err != nil {
+		return err
+	}
+	n.Valid = true
+	return nil
+}
+
+// NullInt64 is a sql.NullInt64 that marshals to JSON as its number or null
+type NullInt64 struct {
+	sql.NullInt64
+}
+
+// NewNullInt64 returns i as a valid NullInt64
+func NewNullInt64(i int64) NullInt64 {
+	return NullInt64{sql.NullInt64{Int64: i, Valid: true}}
+}
+
+func (n NullInt64) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(n.Int64)
+}
+
+func (n *NullInt64) UnmarshalJSON(data []byte) error {
+	*n = NullInt64{}
+	if string(data) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(data, &n.Int64); err != nil {
+		return err
+	}
+	n.Valid = true
+	return nil
+}
@@ -0,0 +1,29 @@
+package models
+
+import "database/sql"
+
+// Page selects part of a listing: at most Limit rows after skipping the
+// first Offset. A zero Limit selects every row.
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+// apply appends the LIMIT clause selecting p to a query and its arguments
+func (p Page) apply(query string, args []any) (string, []any) {
+	if p.Limit <= 0 && p.Offset <= 0 {
+		return query, args
+	}
+	limit := p.Limit
+	if limit <= 0 {
+		limit = -1 // SQLite's spelling of no limit
+	}
+	return query + " LIMIT ? OFFSET ?", append(args, limit, max(p.Offset, 0))
+}
+
+// count runs a COUNT(*) query
+func count(db *sql.DB, query string, args ...any) (int, error) {
+	var n int
+	err := db.QueryRow(query, args...).Scan(&n)
+	return n, err
+}
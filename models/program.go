@@ -2,6 +2,8 @@ package models
 
 import (
 	"database/sql"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -9,10 +11,10 @@ import (
 type Program struct {
 	ID           int            `json:"id"`
 	Name         string         `json:"name"`
-	URL          sql.NullString `json:"url,omitempty"`
-	Scope        sql.NullString `json:"scope,omitempty"`
-	OutOfScope   sql.NullString `json:"out_of_scope,omitempty"`
-	BountyNotes  sql.NullString `json:"bounty_notes,omitempty"`
+	URL          NullString     `json:"url,omitempty"`
+	Scope        NullString     `json:"scope,omitempty"`
+	OutOfScope   NullString     `json:"out_of_scope,omitempty"`
+	BountyNotes  NullString     `json:"bounty_notes,omitempty"`
 	CreatedAt    time.Time      `json:"created_at"`
 }
 
@@ -21,9 +23,33 @@ type ProgramService interface {
 	Create(program *Program) error
 	GetByID(id int) (*Program, error)
 	GetByName(name string) (*Program, error)
+	Resolve(name string) (*Program, error)
 	Update(program *Program) error
 	Delete(id int) error
 	List() ([]*Program, error)
+	ListPage(page Page) ([]*Program, int, error)
+	ListWithCounts() ([]*ProgramSummary, error)
+	AddAlias(programID int, domain string) error
+	RemoveAlias(domain string) error
+	ListAliases() ([]*ProgramAlias, error)
+}
+
+// ProgramSummary is a program with the sizes ListWithCounts computes; the
+// counts are not stored
+type ProgramSummary struct {
+	Program
+	TargetCount  int `json:"target_count"`
+	AliveCount   int `json:"alive_count"`
+	FindingCount int `json:"finding_count"`
+}
+
+// ProgramAlias maps an alternate root domain, such as an acquired
+// company's, to the program it belongs to
+type ProgramAlias struct {
+	Domain      string    `json:"domain"`
+	ProgramID   int       `json:"program_id"`
+	ProgramName string    `json:"program_name"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 // ProgramRepository implements ProgramService with database operations
@@ -76,7 +102,7 @@ func (r *ProgramRepository) GetByID(id int) (*Program, error) {
 // GetByName retrieves a program by its name
 func (r *ProgramRepository) GetByName(name string) (*Program, error) {
 	query := `SELECT id, name, url, scope, out_of_scope, bounty_notes, created_at 
-	          FROM programs WHERE name = ?`
+	          FROM programs WHERE name = ? COLLATE NOCASE`
 	
 	program := &Program{}
 	err := r.DB.QueryRow(query, name).Scan(
@@ -90,6 +116,63 @@ func (r *ProgramRepository) GetByName(name string) (*Program, error) {
 	return program, nil
 }
 
+// AmbiguousProgramError is returned by Resolve for a name that matches
+// several programs
+type AmbiguousProgramError struct {
+	Name       string
+	Candidates []string
+}
+
+func (e *AmbiguousProgramError) Error() string {
+	return fmt.Sprintf("program %q is ambiguous: %s", e.Name, strings.Join(e.Candidates, ", "))
+}
+
+// Resolve retrieves the program a possibly abbreviated name refers to: the
+// program of that name, or else the only one whose name starts with it, or
+// else the only one whose name contains it, all ignoring case. A name
+// matching several programs at the first step that finds any fails with an
+// *AmbiguousProgramError listing them, and one matching none with
+// sql.ErrNoRows.
+func (r *ProgramRepository) Resolve(name string) (*Program, error) {
+	program, err := r.GetByName(name)
+	if err != sql.ErrNoRows {
+		return program, err
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, sql.ErrNoRows
+	}
+
+	programs, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+	lower := strings.ToLower(name)
+	var prefixed, containing []*Program
+	for _, p := range programs {
+		switch programName := strings.ToLower(p.Name); {
+		case strings.HasPrefix(programName, lower):
+			prefixed = append(prefixed, p)
+		case strings.Contains(programName, lower):
+			containing = append(containing, p)
+		}
+	}
+	for _, matches := range [][]*Program{prefixed, containing} {
+		switch len(matches) {
+		case 0:
+			continue
+		case 1:
+			return matches[0], nil
+		}
+		ambiguous := &AmbiguousProgramError{Name: name}
+		for _, p := range matches {
+			ambiguous.Candidates = append(ambiguous.Candidates, p.Name)
+		}
+		return nil, ambiguous
+	}
+	return nil, sql.ErrNoRows
+}
+
 // Update modifies an existing program
 func (r *ProgramRepository) Update(program *Program) error {
 	query := `UPDATE programs SET name = ?, url = ?, scope = ?, 
@@ -112,8 +195,25 @@ func (r *ProgramRepository) Delete(id int) error {
 func (r *ProgramRepository) List() ([]*Program, error) {
 	query := `SELECT id, name, url, scope, out_of_scope, bounty_notes, created_at 
 	          FROM programs ORDER BY name`
-	
-	rows, err := r.DB.Query(query)
+	return r.queryPrograms(query)
+}
+
+// ListPage retrieves one page of the programs ordered by name, along with
+// how many programs there are in all
+func (r *ProgramRepository) ListPage(page Page) ([]*Program, int, error) {
+	total, err := count(r.DB, "SELECT COUNT(*) FROM programs")
+	if err != nil {
+		return nil, 0, err
+	}
+	query, args := page.apply(`SELECT id, name, url, scope, out_of_scope, bounty_notes, created_at 
+	          FROM programs ORDER BY name, id`, nil)
+	programs, err := r.queryPrograms(query, args...)
+	return programs, total, err
+}
+
+// queryPrograms runs a query selecting the columns List reads
+func (r *ProgramRepository) queryPrograms(query string, args ...any) ([]*Program, error) {
+	rows, err := r.DB.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -132,5 +232,87 @@ func (r *ProgramRepository) List() ([]*Program, error) {
 		programs = append(programs, program)
 	}
 	
-	return programs, nil
+	return programs, rows.Err()
+}
+
+// ListWithCounts retrieves all programs with how many targets they have,
+// how many of those are alive and how many findings were recorded on them
+func (r *ProgramRepository) ListWithCounts() ([]*ProgramSummary, error) {
+	query := `SELECT p.id, p.name, p.url, p.scope, p.out_of_scope, p.bounty_notes, p.created_at,
+	          COUNT(t.id), COALESCE(SUM(t.alive), 0),
+	          (SELECT COUNT(*) FROM findings f JOIN targets ft ON ft.id = f.target_id 
+	           WHERE ft.program_id = p.id)
+	          FROM programs p LEFT JOIN targets t ON t.program_id = p.id 
+	          GROUP BY p.id ORDER BY p.name`
+	
+	rows, err := r.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var programs []*ProgramSummary
+	for rows.Next() {
+		program := &ProgramSummary{}
+		err := rows.Scan(
+			&program.ID, &program.Name, &program.URL, &program.Scope,
+			&program.OutOfScope, &program.BountyNotes, &program.CreatedAt,
+			&program.TargetCount, &program.AliveCount, &program.FindingCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		programs = append(programs, program)
+	}
+	
+	return programs, rows.Err()
+}
+
+// AddAlias maps a root domain to a program, moving it over if it was
+// mapped to another one
+func (r *ProgramRepository) AddAlias(programID int, domain string) error {
+	query := `INSERT INTO program_aliases (domain, program_id) VALUES (?, ?) 
+	          ON CONFLICT(domain) DO UPDATE SET program_id = excluded.program_id`
+	_, err := r.DB.Exec(query, strings.ToLower(domain), programID)
+	return err
+}
+
+// RemoveAlias deletes the mapping of a root domain
+func (r *ProgramRepository) RemoveAlias(domain string) error {
+	result, err := r.DB.Exec("DELETE FROM program_aliases WHERE domain = ?", strings.ToLower(domain))
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListAliases retrieves every alias with the name of its program
+func (r *ProgramRepository) ListAliases() ([]*ProgramAlias, error) {
+	query := `SELECT a.domain, a.program_id, p.name, a.created_at 
+	          FROM program_aliases a JOIN programs p ON p.id = a.program_id 
+	          ORDER BY p.name, a.domain`
+	
+	rows, err := r.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var aliases []*ProgramAlias
+	for rows.Next() {
+		alias := &ProgramAlias{}
+		if err := rows.Scan(&alias.Domain, &alias.ProgramID, &alias.ProgramName, &alias.CreatedAt); err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, alias)
+	}
+	
+	return aliases, rows.Err()
 }
@@ -2,6 +2,7 @@ package models
 
 import (
 	"database/sql"
+	"fmt"
 	"time"
 )
 
@@ -11,17 +12,28 @@ type ReconData struct {
 	TargetID  int            `json:"target_id"`
 	Tool      string         `json:"tool"`
 	Data      string         `json:"data"`
-	Context   sql.NullString `json:"context,omitempty"`
+	Context   NullString     `json:"context,omitempty"`
 	Timestamp time.Time      `json:"timestamp"`
 }
 
+// PruneFilter narrows ReconDataRepository.PruneOlderThan; zero fields
+// match everything
+type PruneFilter struct {
+	Tool      string
+	ProgramID int
+}
+
 // ReconDataService defines the interface for reconnaissance data operations
 type ReconDataService interface {
 	Create(data *ReconData) error
 	GetByID(id int) (*ReconData, error)
 	GetByTargetID(targetID int) ([]*ReconData, error)
+	GetByProgramID(programID int) ([]*ReconData, error)
 	GetByTool(tool string) ([]*ReconData, error)
+	GetByTargetAndTool(targetID int, tool string) ([]*ReconData, error)
+	ListByTarget(targetID int, tool string, page Page) ([]*ReconData, int, error)
 	Delete(id int) error
+	PruneOlderThan(cutoff time.Time, filter PruneFilter) (int64, error)
 }
 
 // ReconDataRepository implements ReconDataService with database operations
@@ -98,6 +110,36 @@ func (r *ReconDataRepository) GetByTargetID(targetID int) ([]*ReconData, error)
 	return dataList, nil
 }
 
+// GetByProgramID retrieves the reconnaissance data of every target in a
+// program, oldest first
+func (r *ReconDataRepository) GetByProgramID(programID int) ([]*ReconData, error) {
+	query := `SELECT d.id, d.target_id, d.tool, d.data, d.context, d.timestamp 
+	          FROM recon_data d
+	          JOIN targets t ON t.id = d.target_id
+	          WHERE t.program_id = ? ORDER BY d.id`
+
+	rows, err := r.DB.Query(query, programID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dataList []*ReconData
+	for rows.Next() {
+		data := &ReconData{}
+		err := rows.Scan(
+			&data.ID, &data.TargetID, &data.Tool, &data.Data, 
+			&data.Context, &data.Timestamp,
+		)
+		if err != nil {
+			return nil, err
+		}
+		dataList = append(dataList, data)
+	}
+
+	return dataList, rows.Err()
+}
+
 // GetByTool retrieves all reconnaissance data collected by a specific tool
 func (r *ReconDataRepository) GetByTool(tool string) ([]*ReconData, error) {
 	query := `SELECT id, target_id, tool, data, context, timestamp 
@@ -125,9 +167,111 @@ func (r *ReconDataRepository) GetByTool(tool string) ([]*ReconData, error) {
 	return dataList, nil
 }
 
+// GetByTargetAndTool retrieves the reconnaissance data one tool collected
+// for a specific target, newest first
+func (r *ReconDataRepository) GetByTargetAndTool(targetID int, tool string) ([]*ReconData, error) {
+	query := `SELECT id, target_id, tool, data, context, timestamp 
+	          FROM recon_data WHERE target_id = ? AND tool = ? ORDER BY timestamp DESC`
+
+	rows, err := r.DB.Query(query, targetID, tool)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dataList []*ReconData
+	for rows.Next() {
+		data := &ReconData{}
+		err := rows.Scan(
+			&data.ID, &data.TargetID, &data.Tool, &data.Data, 
+			&data.Context, &data.Timestamp,
+		)
+		if err != nil {
+			return nil, err
+		}
+		dataList = append(dataList, data)
+	}
+
+	return dataList, rows.Err()
+}
+
+// ListByTarget retrieves one page of a target's reconnaissance data, newest
+// first, along with how many rows there are in all. A tool other than ""
+// narrows it to the data that tool collected.
+func (r *ReconDataRepository) ListByTarget(targetID int, tool string, page Page) ([]*ReconData, int, error) {
+	where, args := "target_id = ?", []any{targetID}
+	if tool != "" {
+		where += " AND tool = ?"
+		args = append(args, tool)
+	}
+	total, err := count(r.DB, "SELECT COUNT(*) FROM recon_data WHERE "+where, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query, args := page.apply(`SELECT id, target_id, tool, data, context, timestamp 
+	          FROM recon_data WHERE `+where+` ORDER BY timestamp DESC, id DESC`, args)
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var dataList []*ReconData
+	for rows.Next() {
+		data := &ReconData{}
+		err := rows.Scan(
+			&data.ID, &data.TargetID, &data.Tool, &data.Data, 
+			&data.Context, &data.Timestamp,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		dataList = append(dataList, data)
+	}
+
+	return dataList, total, rows.Err()
+}
+
 // Delete removes reconnaissance data from the database
 func (r *ReconDataRepository) Delete(id int) error {
 	query := "DELETE FROM recon_data WHERE id = ?"
 	_, err := r.DB.Exec(query, id)
 	return err
 }
+
+// PruneOlderThan deletes recon data recorded before cutoff in a single
+// transaction and returns how many rows were removed
+func (r *ReconDataRepository) PruneOlderThan(cutoff time.Time, filter PruneFilter) (int64, error) {
+	// Timestamps are stored both by the driver (with a zone offset) and by
+	// CURRENT_TIMESTAMP (UTC), so compare them as julian days
+	query := "DELETE FROM recon_data WHERE julianday(timestamp) < julianday(?)"
+	args := []any{cutoff.UTC().Format("2006-01-02 15:04:05")}
+	if filter.Tool != "" {
+		query += " AND tool = ?"
+		args = append(args, filter.Tool)
+	}
+	if filter.ProgramID != 0 {
+		query += " AND target_id IN (SELECT id FROM targets WHERE program_id = ?)"
+		args = append(args, filter.ProgramID)
+	}
+
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin prune: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune recon data: %v", err)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune recon data: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit prune: %v", err)
+	}
+	return removed, nil
+}
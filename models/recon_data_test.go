@@ -0,0 +1,81 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetByTargetAndTool(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.Exec("INSERT INTO targets (program_id, target, type) VALUES (1, 'b.example.com', 'subdomain')"); err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	rows := []struct {
+		targetID int
+		tool     string
+		data     string
+		age      time.Duration
+	}{
+		{1, "httpx", "https://a.example.com/old", 48 * time.Hour},
+		{1, "httpx", "https://a.example.com/new", 0},
+		{1, "httpx", "https://a.example.com/mid", 24 * time.Hour},
+		{1, "subfinder", "a.example.com", time.Hour},
+		{2, "httpx", "https://b.example.com", 0},
+	}
+	for _, r := range rows {
+		if _, err := db.Exec("INSERT INTO recon_data (target_id, tool, data, timestamp) VALUES (?, ?, ?, ?)",
+			r.targetID, r.tool, r.data, base.Add(-r.age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		targetID int
+		tool     string
+		want     []string
+	}{
+		{1, "httpx", []string{"https://a.example.com/new", "https://a.example.com/mid", "https://a.example.com/old"}},
+		{1, "subfinder", []string{"a.example.com"}},
+		{2, "httpx", []string{"https://b.example.com"}},
+		{2, "subfinder", nil},
+		{1, "nuclei", nil},
+	}
+	repo := NewReconDataRepository(db)
+	for _, tt := range tests {
+		got, err := repo.GetByTargetAndTool(tt.targetID, tt.tool)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var data []string
+		for _, r := range got {
+			if r.TargetID != tt.targetID || r.Tool != tt.tool {
+				t.Errorf("target %d, %s: got a row of target %d from %s", tt.targetID, tt.tool, r.TargetID, r.Tool)
+			}
+			data = append(data, r.Data)
+		}
+		if strings.Join(data, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("target %d, %s = %v, want %v", tt.targetID, tt.tool, data, tt.want)
+		}
+	}
+
+	// The lookup is served by the (target_id, tool) index
+	var plan strings.Builder
+	explain, err := db.Query("EXPLAIN QUERY PLAN SELECT id FROM recon_data WHERE target_id = ? AND tool = ? ORDER BY timestamp DESC", 1, "httpx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer explain.Close()
+	for explain.Next() {
+		var id, parent, unused int
+		var detail string
+		if err := explain.Scan(&id, &parent, &unused, &detail); err != nil {
+			t.Fatal(err)
+		}
+		plan.WriteString(detail + "\n")
+	}
+	if !strings.Contains(plan.String(), "idx_recon_data_target_tool") {
+		t.Errorf("query plan does not use idx_recon_data_target_tool:\n%s", plan.String())
+	}
+}
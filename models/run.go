@@ -0,0 +1,102 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Run is one ingest, recorded so the targets and recon data it stored can
+// be traced back to it
+type Run struct {
+	ID          int        `json:"id"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  NullTime   `json:"finished_at,omitempty"`
+	Tool        NullString `json:"tool,omitempty"`
+	Source      NullString `json:"source,omitempty"`
+	ProgramID   NullInt64  `json:"program_id,omitempty"`
+	TargetCount int        `json:"target_count"`
+}
+
+// RunSummary is a run with its program's name and the rows it stored
+type RunSummary struct {
+	Run
+	ProgramName    NullString `json:"program_name,omitempty"`
+	CreatedTargets int        `json:"created_targets"`
+	ReconRows      int        `json:"recon_rows"`
+}
+
+// RunFilter narrows RunRepository.List; zero fields match everything
+type RunFilter struct {
+	ProgramName string
+	// Limit caps the number of runs returned, newest first
+	Limit int
+}
+
+// RunService defines the interface for ingest run operations
+type RunService interface {
+	GetByID(id int) (*Run, error)
+	List(filter RunFilter) ([]*RunSummary, error)
+}
+
+// RunRepository implements RunService with database operations
+type RunRepository struct {
+	DB *sql.DB
+}
+
+// NewRunRepository creates a new run repository
+func NewRunRepository(db *sql.DB) *RunRepository {
+	return &RunRepository{DB: db}
+}
+
+// GetByID retrieves a run by its ID
+func (r *RunRepository) GetByID(id int) (*Run, error) {
+	query := `SELECT id, started_at, finished_at, tool, source, program_id, target_count
+	          FROM runs WHERE id = ?`
+
+	run := &Run{}
+	err := r.DB.QueryRow(query, id).Scan(&run.ID, &run.StartedAt, &run.FinishedAt,
+		&run.Tool, &run.Source, &run.ProgramID, &run.TargetCount)
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// List retrieves runs matching filter, newest first, with the number of
+// targets each created and recon rows each stored
+func (r *RunRepository) List(filter RunFilter) ([]*RunSummary, error) {
+	query := `SELECT r.id, r.started_at, r.finished_at, r.tool, r.source, r.program_id, r.target_count,
+	          p.name,
+	          (SELECT COUNT(*) FROM targets t WHERE t.run_id = r.id),
+	          (SELECT COUNT(*) FROM recon_data d WHERE d.run_id = r.id)
+	          FROM runs r
+	          LEFT JOIN programs p ON p.id = r.program_id`
+	var args []any
+	if filter.ProgramName != "" {
+		query += " WHERE p.name = ? COLLATE NOCASE"
+		args = append(args, filter.ProgramName)
+	}
+	query += " ORDER BY r.id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []*RunSummary
+	for rows.Next() {
+		s := &RunSummary{}
+		err := rows.Scan(&s.ID, &s.StartedAt, &s.FinishedAt, &s.Tool, &s.Source, &s.ProgramID,
+			&s.TargetCount, &s.ProgramName, &s.CreatedTargets, &s.ReconRows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, s)
+	}
+	return runs, rows.Err()
+}
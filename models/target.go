@@ -1,17 +1,29 @@
 package models
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
 	"time"
+
+	"ferri/database"
+	"ferri/utils"
 )
 
-// TargetType represents the type of target
+// TargetType represents the type of target: one of the constants below, or
+// any name a custom classification rule gives
 type TargetType string
 
 const (
 	TargetTypeDomain    TargetType = "domain"
 	TargetTypeSubdomain TargetType = "subdomain"
 	TargetTypeURL       TargetType = "url"
+	TargetTypeIP        TargetType = "ip"
+	// TargetTypeIPPort is only found in databases from before ports were
+	// stored separately
 	TargetTypeIPPort    TargetType = "ip_port"
 	TargetTypeUnknown   TargetType = "unknown"
 )
@@ -22,14 +34,81 @@ type Target struct {
 	ProgramID    int            `json:"program_id"`
 	Target       string         `json:"target"`
 	Type         TargetType     `json:"type"`
-	Source       sql.NullString `json:"source,omitempty"`
+	Source       NullString     `json:"source,omitempty"`
 	Alive        bool           `json:"alive"`
-	LastChecked  sql.NullTime   `json:"last_checked,omitempty"`
+	LastChecked  NullTime       `json:"last_checked,omitempty"`
 	Tested       bool           `json:"tested"`
-	TestedDate   sql.NullTime   `json:"tested_date,omitempty"`
-	TestNotes    sql.NullString `json:"test_notes,omitempty"`
-	Notes        sql.NullString `json:"notes,omitempty"`
+	TestedDate   NullTime       `json:"tested_date,omitempty"`
+	TestNotes    NullString     `json:"test_notes,omitempty"`
+	Notes        NullString     `json:"notes,omitempty"`
 	CreatedAt    time.Time      `json:"created_at"`
+	ParentID     NullInt64      `json:"parent_id,omitempty"`
+	Port         int            `json:"port,omitempty"`
+	BodyHash     NullString     `json:"body_hash,omitempty"`
+	// Changed is set when the last scan saw a different body hash than the
+	// one before it
+	Changed      bool           `json:"changed"`
+	// ScreenshotPath is where a screenshot of the target is kept on disk,
+	// e.g. by gowitness or aquatone
+	ScreenshotPath NullString   `json:"screenshot_path,omitempty"`
+	// StatusCode is the HTTP status the target answered with when last
+	// probed, e.g. by httpx
+	StatusCode   NullInt64      `json:"status_code,omitempty"`
+}
+
+// StatusChange is a point at which a target went up or down
+type StatusChange struct {
+	TargetID  int       `json:"target_id"`
+	Alive     bool      `json:"alive"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Address returns the target with its port, e.g. 10.0.0.1:8080
+func (t *Target) Address() string {
+	return JoinHostPort(t.Target, t.Port)
+}
+
+// JoinHostPort renders a stored target and port the way tools print them,
+// bracketing IPv6 hosts. URLs already carry their port and are returned as is.
+func JoinHostPort(target string, port int) string {
+	if port == 0 || strings.Contains(target, "://") {
+		return target
+	}
+	return net.JoinHostPort(target, strconv.Itoa(port))
+}
+
+// addressSQL is the SQL counterpart of JoinHostPort for the targets table
+// aliased as prefix (e.g. "t."), so targets can be looked up and searched by
+// the host:port form users type
+func addressSQL(prefix string) string {
+	return strings.NewReplacer("$", prefix).Replace(`CASE
+		WHEN $port = 0 OR instr($target, '://') > 0 THEN $target
+		WHEN instr($target, ':') > 0 THEN '[' || $target || ']:' || $port
+		ELSE $target || ':' || $port END`)
+}
+
+// SearchOptions narrows TargetRepository.Search; zero fields match everything
+type SearchOptions struct {
+	ProgramID int
+	AliveOnly bool
+	Type      TargetType
+}
+
+// filter appends the conditions of opts to a query that already has a
+// WHERE clause, and their arguments to args
+func (opts SearchOptions) filter(query string, args []any) (string, []any) {
+	if opts.ProgramID != 0 {
+		query += " AND program_id = ?"
+		args = append(args, opts.ProgramID)
+	}
+	if opts.AliveOnly {
+		query += " AND alive = 1"
+	}
+	if opts.Type != "" {
+		query += " AND type = ?"
+		args = append(args, opts.Type)
+	}
+	return query, args
 }
 
 // TargetService defines the interface for target operations
@@ -41,27 +120,84 @@ type TargetService interface {
 	Delete(id int) error
 	ListByProgram(programID int) ([]*Target, error)
 	ListAlive() ([]*Target, error)
+	ListChildren(parentID int) ([]*Target, error)
+	ListByPort(port int) ([]*Target, error)
+	AddTag(targetID int, tag string) error
+	RemoveTag(targetID int, tag string) error
+	ListByTag(tag string) ([]*Target, error)
+	ListTags(targetID int) ([]string, error)
+	FindByValue(target string) ([]*Target, error)
+	Search(pattern string, opts SearchOptions) ([]*Target, error)
+	SearchPage(pattern string, opts SearchOptions, page Page) ([]*Target, int, error)
+	ListByLastChecked(before time.Time, opts SearchOptions) ([]*Target, error)
+	AppendNote(id int, note string) error
 }
 
 // TargetRepository implements TargetService with database operations
 type TargetRepository struct {
 	DB *sql.DB
+	// Clock stamps note entries
+	Clock utils.Clock
 }
 
 // NewTargetRepository creates a new target repository
 func NewTargetRepository(db *sql.DB) *TargetRepository {
-	return &TargetRepository{DB: db}
+	return &TargetRepository{DB: db, Clock: utils.RealClock{}}
+}
+
+// targetColumns is the column list read by scanTarget
+const targetColumns = `id, program_id, target, type, source, alive, last_checked, 
+	          tested, tested_date, test_notes, notes, created_at, parent_id, port, body_hash, changed, screenshot_path, status_code`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanTarget reads a row selected with targetColumns into a Target
+func scanTarget(row rowScanner) (*Target, error) {
+	target := &Target{}
+	err := row.Scan(
+		&target.ID, &target.ProgramID, &target.Target, &target.Type, &target.Source,
+		&target.Alive, &target.LastChecked, &target.Tested, &target.TestedDate,
+		&target.TestNotes, &target.Notes, &target.CreatedAt, &target.ParentID, &target.Port,
+		&target.BodyHash, &target.Changed, &target.ScreenshotPath, &target.StatusCode,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// queryTargets runs a query selecting targetColumns and collects the rows
+func (r *TargetRepository) queryTargets(query string, args ...any) ([]*Target, error) {
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var targets []*Target
+	for rows.Next() {
+		target, err := scanTarget(rows)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	
+	return targets, rows.Err()
 }
 
 // Create inserts a new target into the database
 func (r *TargetRepository) Create(target *Target) error {
 	query := `INSERT INTO targets (program_id, target, type, source, alive, last_checked, 
-	          tested, tested_date, test_notes, notes) 
-	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	          tested, tested_date, test_notes, notes, parent_id, port) 
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	
 	result, err := r.DB.Exec(query, target.ProgramID, target.Target, target.Type, 
 		target.Source, target.Alive, target.LastChecked, target.Tested, 
-		target.TestedDate, target.TestNotes, target.Notes)
+		target.TestedDate, target.TestNotes, target.Notes, target.ParentID, target.Port)
 	if err != nil {
 		return err
 	}
@@ -77,53 +213,121 @@ func (r *TargetRepository) Create(target *Target) error {
 
 // GetByID retrieves a target by its ID
 func (r *TargetRepository) GetByID(id int) (*Target, error) {
-	query := `SELECT id, program_id, target, type, source, alive, last_checked, 
-	          tested, tested_date, test_notes, notes, created_at 
-	          FROM targets WHERE id = ?`
-	
-	target := &Target{}
-	err := r.DB.QueryRow(query, id).Scan(
-		&target.ID, &target.ProgramID, &target.Target, &target.Type, &target.Source,
-		&target.Alive, &target.LastChecked, &target.Tested, &target.TestedDate,
-		&target.TestNotes, &target.Notes, &target.CreatedAt,
-	)
+	query := `SELECT ` + targetColumns + ` FROM targets WHERE id = ?`
+	return scanTarget(r.DB.QueryRow(query, id))
+}
+
+// GetByProgramAndTarget retrieves a target by program ID and target value,
+// given with its port (as returned by Address) when it has one
+func (r *TargetRepository) GetByProgramAndTarget(programID int, target string) (*Target, error) {
+	query := `SELECT ` + targetColumns + ` FROM targets WHERE program_id = ? AND ` + addressSQL("") + ` = ?`
+	return scanTarget(r.DB.QueryRow(query, programID, target))
+}
+
+// Update modifies an existing target. A change to whether it is alive goes
+// through MarkAlive, in the same transaction, so it reaches the status
+// history too.
+func (r *TargetRepository) Update(target *Target) error {
+	ctx := context.Background()
+	tx, err := r.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer tx.Rollback()
 	
-	return target, nil
+	var alive bool
+	if err := tx.QueryRowContext(ctx, "SELECT alive FROM targets WHERE id = ?", target.ID).Scan(&alive); err != nil {
+		return err
+	}
+	if alive != target.Alive {
+		if _, err := MarkAlive(ctx, tx, target.ID, target.Alive, r.Clock.Now().UTC()); err != nil {
+			return err
+		}
+	}
+	
+	query := `UPDATE targets SET program_id = ?, target = ?, type = ?, source = ?, 
+	          last_checked = ?, tested = ?, tested_date = ?, 
+	          test_notes = ?, notes = ?, parent_id = ?, port = ? WHERE id = ?`
+	
+	_, err = tx.ExecContext(ctx, query, target.ProgramID, target.Target, target.Type, 
+		target.Source, target.LastChecked, target.Tested, 
+		target.TestedDate, target.TestNotes, target.Notes, target.ParentID, target.Port, target.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// GetByProgramAndTarget retrieves a target by program ID and target value
-func (r *TargetRepository) GetByProgramAndTarget(programID int, target string) (*Target, error) {
-	query := `SELECT id, program_id, target, type, source, alive, last_checked, 
-	          tested, tested_date, test_notes, notes, created_at 
-	          FROM targets WHERE program_id = ? AND target = ?`
-	
-	targetObj := &Target{}
-	err := r.DB.QueryRow(query, programID, target).Scan(
-		&targetObj.ID, &targetObj.ProgramID, &targetObj.Target, &targetObj.Type, &targetObj.Source,
-		&targetObj.Alive, &targetObj.LastChecked, &targetObj.Tested, &targetObj.TestedDate,
-		&targetObj.TestNotes, &targetObj.Notes, &targetObj.CreatedAt,
-	)
+// Statements behind MarkAlive
+const (
+	lastStatusSQL   = "SELECT alive FROM target_status_history WHERE target_id = ? ORDER BY id DESC LIMIT 1"
+	insertStatusSQL = "INSERT INTO target_status_history (target_id, alive, checked_at) VALUES (?, ?, ?)"
+	markAliveSQL    = "UPDATE targets SET alive = ?, last_checked = ? WHERE id = ?"
+)
+
+// MarkAliveQueries are the statements MarkAlive runs, for callers that
+// prepare them ahead
+var MarkAliveQueries = []string{lastStatusSQL, insertStatusSQL, markAliveSQL}
+
+// Querier runs statements and single-row queries; *sql.DB, *sql.Tx and the
+// ingest's prepared statements all satisfy it
+type Querier interface {
+	RowQuerier
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// MarkAlive stores through q whether a target responded when it was
+// checked at now. A row is added to its status history only when the
+// status differs from the last one recorded, so the history holds
+// transitions rather than every check. It reports whether the status
+// changed. Each write is retried on its own, so a retry never records a
+// transition twice; run it in a transaction to keep the history and the
+// target in step.
+func MarkAlive(ctx context.Context, q Querier, targetID int, alive bool, now time.Time) (bool, error) {
+	var last bool
+	err := q.QueryRowContext(ctx, lastStatusSQL, targetID).Scan(&last)
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("failed to read target status: %v", err)
+	}
+	changed := err == sql.ErrNoRows || last != alive
+
+	if changed {
+		err := database.WithRetry(func() error {
+			_, err := q.ExecContext(ctx, insertStatusSQL, targetID, alive, now)
+			return err
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed to record target status: %v", err)
+		}
+	}
+	err = database.WithRetry(func() error {
+		_, err := q.ExecContext(ctx, markAliveSQL, alive, now, targetID)
+		return err
+	})
 	if err != nil {
-		return nil, err
+		return false, fmt.Errorf("failed to store target status: %v", err)
 	}
-	
-	return targetObj, nil
+	return changed, nil
 }
 
-// Update modifies an existing target
-func (r *TargetRepository) Update(target *Target) error {
-	query := `UPDATE targets SET program_id = ?, target = ?, type = ?, source = ?, 
-	          alive = ?, last_checked = ?, tested = ?, tested_date = ?, 
-	          test_notes = ?, notes = ? WHERE id = ?`
-	
-	_, err := r.DB.Exec(query, target.ProgramID, target.Target, target.Type, 
-		target.Source, target.Alive, target.LastChecked, target.Tested, 
-		target.TestedDate, target.TestNotes, target.Notes, target.ID)
+// History retrieves the alive/dead transitions of a target, oldest first
+func (r *TargetRepository) History(targetID int) ([]*StatusChange, error) {
+	rows, err := r.DB.Query(`SELECT target_id, alive, checked_at FROM target_status_history 
+	          WHERE target_id = ? ORDER BY checked_at, id`, targetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 	
-	return err
+	var history []*StatusChange
+	for rows.Next() {
+		change := &StatusChange{}
+		if err := rows.Scan(&change.TargetID, &change.Alive, &change.CheckedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+	return history, rows.Err()
 }
 
 // Delete removes a target from the database
@@ -135,58 +339,245 @@ func (r *TargetRepository) Delete(id int) error {
 
 // ListByProgram retrieves all targets for a specific program
 func (r *TargetRepository) ListByProgram(programID int) ([]*Target, error) {
-	query := `SELECT id, program_id, target, type, source, alive, last_checked, 
-	          tested, tested_date, test_notes, notes, created_at 
-	          FROM targets WHERE program_id = ? ORDER BY target`
+	query := `SELECT ` + targetColumns + ` FROM targets WHERE program_id = ? ORDER BY target`
+	return r.queryTargets(query, programID)
+}
+
+// ListAlive retrieves all alive targets
+func (r *TargetRepository) ListAlive() ([]*Target, error) {
+	query := `SELECT ` + targetColumns + ` FROM targets WHERE alive = 1 ORDER BY target`
+	return r.queryTargets(query)
+}
+
+// ListChildren retrieves the subdomains linked to a root domain target
+func (r *TargetRepository) ListChildren(parentID int) ([]*Target, error) {
+	query := `SELECT ` + targetColumns + ` FROM targets WHERE parent_id = ? ORDER BY target`
+	return r.queryTargets(query, parentID)
+}
+
+// ListByLastChecked retrieves the targets last checked before a time,
+// including those never checked at all, least recently checked first
+func (r *TargetRepository) ListByLastChecked(before time.Time, opts SearchOptions) ([]*Target, error) {
+	// last_checked is stored both by the driver (with a zone offset) and
+	// as UTC, so compare as julian days
+	query := `SELECT ` + targetColumns + ` FROM targets 
+	          WHERE (last_checked IS NULL OR julianday(last_checked) < julianday(?))`
+	query, args := opts.filter(query, []any{before.UTC().Format("2006-01-02 15:04:05")})
+	query += " ORDER BY julianday(last_checked), target"
+	return r.queryTargets(query, args...)
+}
+
+// ListByPort retrieves every target on a port, both host:port targets and
+// URLs with that explicit port
+func (r *TargetRepository) ListByPort(port int) ([]*Target, error) {
+	query := `SELECT ` + targetColumns + ` FROM targets WHERE port = ? ORDER BY program_id, target`
+	return r.queryTargets(query, port)
+}
+
+// FindByValue retrieves every target with the given value across programs,
+// matching host:port values as returned by Address
+func (r *TargetRepository) FindByValue(target string) ([]*Target, error) {
+	query := `SELECT ` + targetColumns + ` FROM targets WHERE ` + addressSQL("") + ` = ? ORDER BY program_id`
+	return r.queryTargets(query, target)
+}
+
+// Search retrieves targets whose address matches a shell-style glob, where *
+// matches any run of characters and ? a single one, so '*:8443' finds
+// services on a port. Matching ignores ASCII case.
+func (r *TargetRepository) Search(pattern string, opts SearchOptions) ([]*Target, error) {
+	query, args := opts.filter(`SELECT `+targetColumns+` FROM targets WHERE `+addressSQL("")+` LIKE ? ESCAPE '\'`,
+		[]any{globToLike(pattern)})
+	query += " ORDER BY program_id, target"
+	return r.queryTargets(query, args...)
+}
+
+// SearchPage retrieves one page of the targets Search finds, along with how
+// many it finds in all. An empty pattern matches every target.
+func (r *TargetRepository) SearchPage(pattern string, opts SearchOptions, page Page) ([]*Target, int, error) {
+	where, args := "1 = 1", []any(nil)
+	if pattern != "" {
+		where, args = addressSQL("")+` LIKE ? ESCAPE '\'`, []any{globToLike(pattern)}
+	}
+	where, args = opts.filter(where, args)
+
+	total, err := count(r.DB, "SELECT COUNT(*) FROM targets WHERE "+where, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	query, args := page.apply(`SELECT `+targetColumns+` FROM targets WHERE `+where+` ORDER BY program_id, target, port, id`, args)
+	targets, err := r.queryTargets(query, args...)
+	return targets, total, err
+}
+
+// globToLike translates a glob into a LIKE pattern escaped with a backslash,
+// so literal % and _ in the glob are not treated as wildcards
+func globToLike(glob string) string {
+	var b strings.Builder
+	for _, c := range glob {
+		switch c {
+		case '*':
+			b.WriteByte('%')
+		case '?':
+			b.WriteByte('_')
+		case '%', '_', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// normalizeTag makes tags case-insensitive by storing them lowercased
+func normalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return "", fmt.Errorf("tag cannot be empty")
+	}
+	return tag, nil
+}
+
+// AddTag attaches a tag to a target, creating the tag if needed. Adding a
+// tag the target already has is a no-op.
+func (r *TargetRepository) AddTag(targetID int, tag string) error {
+	tag, err := normalizeTag(tag)
+	if err != nil {
+		return err
+	}
+	
+	if _, err := r.DB.Exec("INSERT INTO tags (name) VALUES (?) ON CONFLICT(name) DO NOTHING", tag); err != nil {
+		return err
+	}
+	
+	query := `INSERT INTO target_tags (target_id, tag_id) 
+	          SELECT ?, id FROM tags WHERE name = ? 
+	          ON CONFLICT(target_id, tag_id) DO NOTHING`
+	_, err = r.DB.Exec(query, targetID, tag)
+	return err
+}
+
+// RemoveTag detaches a tag from a target
+func (r *TargetRepository) RemoveTag(targetID int, tag string) error {
+	tag, err := normalizeTag(tag)
+	if err != nil {
+		return err
+	}
+	
+	query := `DELETE FROM target_tags 
+	          WHERE target_id = ? AND tag_id = (SELECT id FROM tags WHERE name = ?)`
+	_, err = r.DB.Exec(query, targetID, tag)
+	return err
+}
+
+// ListByTag retrieves all targets carrying a tag
+func (r *TargetRepository) ListByTag(tag string) ([]*Target, error) {
+	tag, err := normalizeTag(tag)
+	if err != nil {
+		return nil, err
+	}
 	
-	rows, err := r.DB.Query(query, programID)
+	query := `SELECT ` + targetColumns + ` FROM targets WHERE id IN (
+	          SELECT tt.target_id FROM target_tags tt JOIN tags g ON g.id = tt.tag_id 
+	          WHERE g.name = ?) ORDER BY target`
+	return r.queryTargets(query, tag)
+}
+
+// ListByTechnology retrieves targets a technology such as WordPress was
+// detected on, matching its name case-insensitively
+func (r *TargetRepository) ListByTechnology(name string) ([]*Target, error) {
+	query := `SELECT ` + targetColumns + ` FROM targets WHERE id IN (
+	          SELECT target_id FROM technologies WHERE name = ?) ORDER BY program_id, target`
+	return r.queryTargets(query, strings.TrimSpace(name))
+}
+
+// ListTechnologies retrieves the technologies detected on a target
+func (r *TargetRepository) ListTechnologies(targetID int) ([]*Technology, error) {
+	rows, err := r.DB.Query(`SELECT id, target_id, name, version FROM technologies 
+	          WHERE target_id = ? ORDER BY name`, targetID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	
-	var targets []*Target
+	var techs []*Technology
 	for rows.Next() {
-		target := &Target{}
-		err := rows.Scan(
-			&target.ID, &target.ProgramID, &target.Target, &target.Type, &target.Source,
-			&target.Alive, &target.LastChecked, &target.Tested, &target.TestedDate,
-			&target.TestNotes, &target.Notes, &target.CreatedAt,
-		)
-		if err != nil {
+		tech := &Technology{}
+		if err := rows.Scan(&tech.ID, &tech.TargetID, &tech.Name, &tech.Version); err != nil {
 			return nil, err
 		}
-		targets = append(targets, target)
+		techs = append(techs, tech)
 	}
-	
-	return targets, nil
+	return techs, rows.Err()
 }
 
-// ListAlive retrieves all alive targets
-func (r *TargetRepository) ListAlive() ([]*Target, error) {
-	query := `SELECT id, program_id, target, type, source, alive, last_checked, 
-	          tested, tested_date, test_notes, notes, created_at 
-	          FROM targets WHERE alive = 1 ORDER BY target`
+// ListTags retrieves the tags attached to a target
+func (r *TargetRepository) ListTags(targetID int) ([]string, error) {
+	query := `SELECT g.name FROM tags g JOIN target_tags tt ON tt.tag_id = g.id 
+	          WHERE tt.target_id = ? ORDER BY g.name`
 	
-	rows, err := r.DB.Query(query)
+	rows, err := r.DB.Query(query, targetID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	
-	var targets []*Target
+	var tags []string
 	for rows.Next() {
-		target := &Target{}
-		err := rows.Scan(
-			&target.ID, &target.ProgramID, &target.Target, &target.Type, &target.Source,
-			&target.Alive, &target.LastChecked, &target.Tested, &target.TestedDate,
-			&target.TestNotes, &target.Notes, &target.CreatedAt,
-		)
-		if err != nil {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
 			return nil, err
 		}
-		targets = append(targets, target)
+		tags = append(tags, tag)
+	}
+	
+	return tags, rows.Err()
+}
+
+// SetScreenshot links a target to the screenshot at path; an empty path
+// removes the link
+func (r *TargetRepository) SetScreenshot(id int, path string) error {
+	stored := sql.NullString{String: path, Valid: path != ""}
+	result, err := r.DB.Exec("UPDATE targets SET screenshot_path = ? WHERE id = ?", stored, id)
+	if err != nil {
+		return err
 	}
 	
-	return targets, nil
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AppendNote adds a timestamped entry to a target's notes, keeping any
+// notes already recorded
+func (r *TargetRepository) AppendNote(id int, note string) error {
+	note = strings.TrimSpace(note)
+	if note == "" {
+		return fmt.Errorf("note cannot be empty")
+	}
+	entry := fmt.Sprintf("[%s] %s", r.Clock.Now().Format("2006-01-02 15:04"), note)
+	
+	query := `UPDATE targets SET notes = CASE 
+	          WHEN notes IS NULL OR notes = '' THEN ? 
+	          ELSE notes || char(10) || ? END 
+	          WHERE id = ?`
+	
+	result, err := r.DB.Exec(query, entry, entry, id)
+	if err != nil {
+		return err
+	}
+	
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
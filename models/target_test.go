@@ -0,0 +1,167 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"ferri/database"
+	"ferri/utils"
+)
+
+// history returns the statuses recorded for target 1, oldest first
+func history(t *testing.T, db *sql.DB) []bool {
+	t.Helper()
+	changes, err := NewTargetRepository(db).History(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var alive []bool
+	for _, c := range changes {
+		alive = append(alive, c.Alive)
+	}
+	return alive
+}
+
+func equalStatuses(a, b []bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMarkAlive(t *testing.T) {
+	tests := []struct {
+		name        string
+		checks      []bool
+		wantChanged []bool
+		wantHistory []bool
+	}{
+		{"first check is a transition", []bool{true}, []bool{true}, []bool{true}},
+		{"repeated status adds nothing", []bool{true, true, true}, []bool{true, false, false}, []bool{true}},
+		{"transitions are kept", []bool{true, false, false, true}, []bool{true, true, false, true}, []bool{true, false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+			var changed []bool
+			for _, alive := range tt.checks {
+				c, err := MarkAlive(context.Background(), db, 1, alive, now)
+				if err != nil {
+					t.Fatal(err)
+				}
+				changed = append(changed, c)
+				now = now.Add(time.Hour)
+			}
+			if !equalStatuses(changed, tt.wantChanged) {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if got := history(t, db); !equalStatuses(got, tt.wantHistory) {
+				t.Errorf("history = %v, want %v", got, tt.wantHistory)
+			}
+			target, err := NewTargetRepository(db).GetByID(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if target.Alive != tt.checks[len(tt.checks)-1] || !target.LastChecked.Time.Equal(now.Add(-time.Hour)) {
+				t.Errorf("target alive %v checked %v, want the last check", target.Alive, target.LastChecked.Time)
+			}
+		})
+	}
+}
+
+// busyOnce fails the first target update with a lock error, as a competing
+// writer would
+type busyOnce struct {
+	*sql.DB
+	err error
+}
+
+func (q *busyOnce) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if query == markAliveSQL && q.err != nil {
+		err := q.err
+		q.err = nil
+		return nil, err
+	}
+	return q.DB.ExecContext(ctx, query, args...)
+}
+
+func TestMarkAliveRetryRecordsTransitionOnce(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	// Provoke a real lock error: one connection holds the write lock while
+	// another gives up on it at once
+	lock, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lock.ExecContext(ctx, "UPDATE programs SET name = name"); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ExecContext(ctx, "PRAGMA busy_timeout = 0"); err != nil {
+		t.Fatal(err)
+	}
+	_, busy := conn.ExecContext(ctx, markAliveSQL, true, time.Now(), 1)
+	conn.Close()
+	lock.Rollback()
+	if !database.IsTransient(busy) {
+		t.Skipf("no transient error to retry: %v", busy)
+	}
+
+	changed, err := MarkAlive(ctx, &busyOnce{DB: db, err: busy}, 1, true, time.Now())
+	if err != nil || !changed {
+		t.Fatalf("MarkAlive = %v, %v; want a change", changed, err)
+	}
+	if got := history(t, db); !equalStatuses(got, []bool{true}) {
+		t.Errorf("history = %v, want one transition", got)
+	}
+}
+
+func TestTargetUpdateRecordsStatusChanges(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewTargetRepository(db)
+	repo.Clock = utils.NewFakeClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+
+	steps := []struct {
+		name        string
+		edit        func(*Target)
+		wantHistory []bool
+	}{
+		{"other fields leave the history alone", func(t *Target) { t.Notes = NewNullString("login page") }, nil},
+		{"coming alive is recorded", func(t *Target) { t.Alive = true }, []bool{true}},
+		{"same status is not recorded again", func(t *Target) { t.Source = NewNullString("manual") }, []bool{true}},
+		{"going down is recorded", func(t *Target) { t.Alive = false }, []bool{true, false}},
+	}
+	for _, step := range steps {
+		target, err := repo.GetByID(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		step.edit(target)
+		if err := repo.Update(target); err != nil {
+			t.Fatalf("%s: Update: %v", step.name, err)
+		}
+		if got := history(t, db); !equalStatuses(got, step.wantHistory) {
+			t.Errorf("%s: history = %v, want %v", step.name, got, step.wantHistory)
+		}
+		stored, err := repo.GetByID(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Alive != target.Alive || stored.Notes != target.Notes || stored.Source != target.Source {
+			t.Errorf("%s: stored %+v, want %+v", step.name, stored, target)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+package models
+
+// Technology is a piece of software detected on a target
+type Technology struct {
+	ID       int        `json:"id"`
+	TargetID int        `json:"target_id"`
+	Name     string     `json:"name"`
+	Version  NullString `json:"version"`
+}
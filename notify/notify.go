@@ -0,0 +1,117 @@
+// Package notify posts webhook notifications about new findings.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds each webhook request
+const DefaultTimeout = 10 * time.Second
+
+// Payload formats accepted by New
+const (
+	FormatJSON  = "json"
+	FormatSlack = "slack"
+)
+
+// Event describes a finding that was just recorded
+type Event struct {
+	Event   string  `json:"event"`
+	Finding Finding `json:"finding"`
+	Program Program `json:"program"`
+	Target  Target  `json:"target"`
+}
+
+// Finding is the finding part of an Event
+type Finding struct {
+	ID       int    `json:"id"`
+	Title    string `json:"title"`
+	Type     string `json:"type"`
+	Severity string `json:"severity"`
+	Status   string `json:"status"`
+}
+
+// Program is the program part of an Event
+type Program struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// Target is the target part of an Event
+type Target struct {
+	ID     int    `json:"id"`
+	Target string `json:"target"`
+}
+
+// Notifier sends events to a webhook in the background
+type Notifier struct {
+	url     string
+	format  string
+	client  *http.Client
+	pending sync.WaitGroup
+}
+
+// New returns a notifier posting to url in the given format ("json" when
+// empty). Each request gives up after timeout.
+func New(url, format string, timeout time.Duration) (*Notifier, error) {
+	switch format {
+	case "":
+		format = FormatJSON
+	case FormatJSON, FormatSlack:
+	default:
+		return nil, fmt.Errorf("unknown webhook format %q (want %s or %s)", format, FormatJSON, FormatSlack)
+	}
+	return &Notifier{url: url, format: format, client: &http.Client{Timeout: timeout}}, nil
+}
+
+// Send posts an event without waiting for the webhook to answer. Failures
+// are logged, never returned, so a slow or broken webhook cannot hold up
+// the caller.
+func (n *Notifier) Send(e Event) {
+	body, err := n.payload(e)
+	if err != nil {
+		log.Printf("⚠️ Error encoding webhook payload: %v\n", err)
+		return
+	}
+
+	n.pending.Add(1)
+	go func() {
+		defer n.pending.Done()
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, n.url, bytes.NewReader(body))
+		if err != nil {
+			log.Printf("⚠️ Webhook for finding %d failed: %v\n", e.Finding.ID, err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := n.client.Do(req)
+		if err != nil {
+			log.Printf("⚠️ Webhook for finding %d failed: %v\n", e.Finding.ID, err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("⚠️ Webhook for finding %d failed: %s\n", e.Finding.ID, resp.Status)
+		}
+	}()
+}
+
+// Wait blocks until every sent event was delivered or timed out
+func (n *Notifier) Wait() {
+	n.pending.Wait()
+}
+
+// payload renders an event in the notifier's format
+func (n *Notifier) payload(e Event) ([]byte, error) {
+	if n.format == FormatSlack {
+		text := fmt.Sprintf("🚨 New %s finding in %s: *%s* on %s", e.Finding.Severity, e.Program.Name, e.Finding.Title, e.Target.Target)
+		return json.Marshal(map[string]string{"text": text})
+	}
+	return json.Marshal(e)
+}
@@ -0,0 +1,198 @@
+// Package output renders the rows printed by query commands in the format
+// chosen with the shared --format flag.
+package output
+
+import (
+	"database/sql/driver"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Formats lists the supported output formats, the first being the default
+var Formats = []string{"table", "json", "ndjson", "csv"}
+
+// Writer renders a slice of structs. Columns are the exported fields with a
+// json tag, in declaration order.
+type Writer interface {
+	Write(rows any) error
+}
+
+// FormatFlag registers the shared --format flag on fs
+func FormatFlag(fs *flag.FlagSet) *string {
+	return fs.String("format", Formats[0], "output format: "+strings.Join(Formats, ", "))
+}
+
+// New returns a Writer for format writing to w
+func New(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case "table":
+		return tableWriter{w}, nil
+	case "json":
+		return jsonWriter{w}, nil
+	case "ndjson":
+		return ndjsonWriter{w}, nil
+	case "csv":
+		return csvWriter{w}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q (want one of %s)", format, strings.Join(Formats, ", "))
+}
+
+// column is a field rendered by the table and CSV writers
+type column struct {
+	name  string
+	index int
+}
+
+// columns returns the rendered fields of the element type of a slice
+func columns(t reflect.Type) []column {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var cols []column
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		cols = append(cols, column{name: name, index: i})
+	}
+	return cols
+}
+
+// rowsOf checks that rows is a slice of structs and returns it with the
+// columns of its element type
+func rowsOf(rows any) (reflect.Value, []column, error) {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice {
+		return v, nil, fmt.Errorf("output: rows must be a slice, got %T", rows)
+	}
+	elem := v.Type().Elem()
+	for elem.Kind() == reflect.Pointer {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return v, nil, fmt.Errorf("output: rows must be structs, got %T", rows)
+	}
+	return v, columns(elem), nil
+}
+
+// cells formats the columns of one row as text
+func cells(row reflect.Value, cols []column) []string {
+	for row.Kind() == reflect.Pointer {
+		row = row.Elem()
+	}
+	out := make([]string, len(cols))
+	for i, c := range cols {
+		out[i] = format(row.Field(c.index).Interface())
+	}
+	return out
+}
+
+// format renders a single value for the table and CSV writers
+func format(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		if x.IsZero() {
+			return ""
+		}
+		return x.Format("2006-01-02 15:04")
+	case fmt.Stringer:
+		return x.String()
+	case []string:
+		return strings.Join(x, ", ")
+	case driver.Valuer:
+		// sql.Null* types render as their value, or empty when NULL
+		value, err := x.Value()
+		if err != nil || value == nil {
+			return ""
+		}
+		return format(value)
+	}
+	return fmt.Sprint(v)
+}
+
+// tableWriter aligns rows under upper-case headers
+type tableWriter struct{ w io.Writer }
+
+func (t tableWriter) Write(rows any) error {
+	v, cols, err := rowsOf(rows)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(t.w, 0, 0, 2, ' ', 0)
+	headers := make([]string, len(cols))
+	for i, c := range cols {
+		headers[i] = strings.ToUpper(c.name)
+	}
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	for i := 0; i < v.Len(); i++ {
+		fmt.Fprintln(tw, strings.Join(cells(v.Index(i), cols), "\t"))
+	}
+	return tw.Flush()
+}
+
+// csvWriter writes a header row of field names followed by the rows;
+// encoding/csv quotes values containing commas, quotes or newlines
+type csvWriter struct{ w io.Writer }
+
+func (c csvWriter) Write(rows any) error {
+	v, cols, err := rowsOf(rows)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(c.w)
+	headers := make([]string, len(cols))
+	for i, col := range cols {
+		headers[i] = col.name
+	}
+	cw.Write(headers)
+	for i := 0; i < v.Len(); i++ {
+		cw.Write(cells(v.Index(i), cols))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// jsonWriter writes the rows as one indented JSON array
+type jsonWriter struct{ w io.Writer }
+
+func (j jsonWriter) Write(rows any) error {
+	v, _, err := rowsOf(rows)
+	if err != nil {
+		return err
+	}
+	if v.Len() == 0 {
+		// Print an empty array rather than null for no rows
+		rows = []struct{}{}
+	}
+	enc := json.NewEncoder(j.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rows)
+}
+
+// ndjsonWriter writes one compact JSON object per line, for streaming into jq
+type ndjsonWriter struct{ w io.Writer }
+
+func (n ndjsonWriter) Write(rows any) error {
+	v, _, err := rowsOf(rows)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(n.w)
+	for i := 0; i < v.Len(); i++ {
+		if err := enc.Encode(v.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package parsers
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	Register("gau", gauParser{})
+}
+
+// gauParser handles gau's output of archived URLs, one per line
+type gauParser struct{}
+
+// Match never claims a line: gau prints bare URLs, which are
+// indistinguishable from any other URL list, so it is only used when the
+// tool is known to be gau
+func (gauParser) Match(line string) bool {
+	return false
+}
+
+func (gauParser) Parse(line string) (ParsedRecord, error) {
+	line = strings.TrimSpace(line)
+	if !isHTTPURL(line) {
+		return ParsedRecord{}, fmt.Errorf("not a URL")
+	}
+	return ParsedRecord{Target: line, Context: "Archived URL via gau"}, nil
+}
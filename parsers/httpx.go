@@ -0,0 +1,40 @@
+package parsers
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register("httpx", httpxParser{})
+}
+
+// httpxLine matches httpx's plain output: a URL followed by [status] and
+// optional further [...] groups such as title and technologies
+var httpxLine = regexp.MustCompile(`^(https?://\S+)\s+\[(\d{3})\](.*)$`)
+
+// httpxParser handles `httpx -sc -title -td` style output
+type httpxParser struct{}
+
+func (httpxParser) Match(line string) bool {
+	return httpxLine.MatchString(line)
+}
+
+func (httpxParser) Parse(line string) (ParsedRecord, error) {
+	m := httpxLine.FindStringSubmatch(line)
+	if m == nil {
+		return ParsedRecord{}, fmt.Errorf("not httpx output")
+	}
+
+	context := "status=" + m[2]
+	fields := map[string]string{"status": m[2]}
+	if extra := bracketFields(m[3]); len(extra) > 0 {
+		context += " " + strings.Join(extra, " | ")
+		fields["extra"] = strings.Join(extra, " | ")
+	}
+	alive := true
+	code, _ := strconv.Atoi(m[2])
+	return ParsedRecord{Target: m[1], Context: context, Alive: &alive, StatusCode: code, Fields: fields}, nil
+}
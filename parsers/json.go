@@ -0,0 +1,216 @@
+package parsers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonTargetKeys are the fields tried, in order, for the target of a JSON
+// line. Tools disagree on naming, e.g. httpx uses "url", nuclei
+// "matched-at" and subfinder/dnsx "host".
+var jsonTargetKeys = []string{"url", "matched-at", "matched_at", "host", "input"}
+
+// IsJSONLine reports whether a line is a JSON object, as emitted by
+// `httpx -json`, `nuclei -jsonl`, `dnsx -json` and friends
+func IsJSONLine(line string) bool {
+	return strings.HasPrefix(line, "{") && json.Valid([]byte(line))
+}
+
+// parseJSON extracts a record from a JSON line, using well-known fields to
+// attribute it to a tool when the pipeline did not say which one it was
+func parseJSON(tool, line string) (ParsedRecord, error) {
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		return ParsedRecord{}, err
+	}
+
+	record := ParsedRecord{Tool: tool, Fields: scalarFields(fields)}
+
+	// amass -json names the host "name" and lists every data source that
+	// reported it
+	if name := firstString(fields, "name"); name != "" && hasAny(fields, "sources") {
+		record.Tool = "amass"
+		record.Target = strings.TrimSpace(name)
+		record.Context = "sources=" + strings.Join(stringList(fields["sources"]), ",")
+		record.Fields["sources"] = strings.Join(stringList(fields["sources"]), ",")
+		if tag := firstString(fields, "tag"); tag != "" {
+			record.Context += " tag=" + tag
+		}
+		return record, nil
+	}
+
+	for _, key := range jsonTargetKeys {
+		if value, ok := fields[key].(string); ok && strings.TrimSpace(value) != "" {
+			record.Target = strings.TrimSpace(value)
+			break
+		}
+	}
+	if record.Target == "" {
+		return ParsedRecord{}, fmt.Errorf("no target field in JSON line")
+	}
+
+	switch {
+	case hasAny(fields, "template-id", "template_id", "templateID"):
+		record.Tool = "nuclei"
+		info, _ := fields["info"].(map[string]any)
+		record.Issue = &Issue{
+			Template: firstString(fields, "template-id", "template_id", "templateID"),
+			Name:     firstString(info, "name"),
+			Severity: firstString(info, "severity"),
+		}
+		record.Context = fmt.Sprintf("template=%s severity=%s", record.Issue.Template, record.Issue.Severity)
+	case firstString(fields, "source") != "" && firstString(fields, "host") != "":
+		// subfinder -oJ names the passive source (crtsh, dnsdumpster, ...)
+		// that found the host
+		record.Tool = "subfinder"
+		record.Context = "source=" + firstString(fields, "source")
+	case isDnsx(tool, fields):
+		// dnsx -json lists the answers per record type; its status_code
+		// is a DNS rcode like NOERROR, not an HTTP status
+		record.Tool = "dnsx"
+		var context []string
+		for _, key := range dnsxRecordKeys {
+			values := stringList(fields[key])
+			for _, value := range values {
+				record.DNSRecords = append(record.DNSRecords, DNSRecord{Type: strings.ToUpper(key), Value: value})
+			}
+			if len(values) > 0 {
+				context = append(context, key+"="+strings.Join(values, ","))
+				record.Fields[key] = strings.Join(values, ",")
+			}
+		}
+		record.Context = strings.Join(context, " ")
+		record.Rcode = strings.ToUpper(firstString(fields, "status_code"))
+	case hasAny(fields, "status_code", "status-code"):
+		record.Tool = "httpx"
+		record.Context = fmt.Sprintf("status=%v", firstValue(fields, "status_code", "status-code"))
+		if title := firstString(fields, "title"); title != "" {
+			record.Context += " " + title
+		}
+		// httpx -probe also lists hosts that did not answer
+		alive := fields["failed"] != true
+		record.Alive = &alive
+		record.Technologies = parseTechnologies(stringList(fields["tech"]))
+		record.BodyHash = bodyHash(fields)
+		record.StatusCode = statusCode(firstValue(fields, "status_code", "status-code"))
+	}
+	return record, nil
+}
+
+// dnsxRecordKeys are the record types dnsx -json reports, in the order
+// they are stored
+var dnsxRecordKeys = []string{"a", "aaaa", "cname", "ns", "mx"}
+
+// isDnsx reports whether a JSON line is dnsx output: the tool says so, or
+// the line names its resolvers rather than a URL, as dnsx -json does
+func isDnsx(tool string, fields map[string]any) bool {
+	if !hasAny(fields, dnsxRecordKeys...) {
+		return false
+	}
+	return tool == "dnsx" || (hasAny(fields, "resolver") && firstString(fields, "url") == "")
+}
+
+// bodyHash returns the response body hash httpx reports, either as a
+// body_hash string or inside its -hash object, preferring the strongest
+func bodyHash(fields map[string]any) string {
+	if hash := firstString(fields, "body_hash", "body-hash"); hash != "" {
+		return hash
+	}
+	if hash, ok := fields["hash"].(string); ok {
+		return hash
+	}
+	hashes, _ := fields["hash"].(map[string]any)
+	return firstString(hashes, "body_sha256", "body_sha1", "body_md5", "body_mmh3", "body_simhash")
+}
+
+// statusCode reads an HTTP status given as a JSON number or string, or
+// returns 0
+func statusCode(value any) int {
+	switch v := value.(type) {
+	case float64:
+		return int(v)
+	case string:
+		code, _ := strconv.Atoi(strings.TrimSpace(v))
+		return code
+	}
+	return 0
+}
+
+// parseTechnologies splits httpx's "Name:version" tech entries, e.g.
+// "Nginx:1.18.0" or "WordPress", dropping repeats
+func parseTechnologies(entries []string) []Technology {
+	var techs []Technology
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		name, version, _ := strings.Cut(entry, ":")
+		name, version = strings.TrimSpace(name), strings.TrimSpace(version)
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		techs = append(techs, Technology{Name: name, Version: version})
+	}
+	return techs
+}
+
+// scalarFields returns the top-level strings, numbers and booleans of a
+// JSON object as text
+func scalarFields(fields map[string]any) map[string]string {
+	scalars := make(map[string]string, len(fields))
+	for key, value := range fields {
+		switch v := value.(type) {
+		case string:
+			scalars[key] = v
+		case float64:
+			scalars[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			scalars[key] = strconv.FormatBool(v)
+		}
+	}
+	return scalars
+}
+
+// stringList returns the strings in a JSON array, or the value itself when
+// it is a single string
+func stringList(value any) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var list []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// hasAny reports whether any of the keys is present
+func hasAny(fields map[string]any, keys ...string) bool {
+	return firstValue(fields, keys...) != nil
+}
+
+// firstValue returns the value of the first key present
+func firstValue(fields map[string]any, keys ...string) any {
+	for _, key := range keys {
+		if value, ok := fields[key]; ok && value != nil {
+			return value
+		}
+	}
+	return nil
+}
+
+// firstString returns the first key holding a string value
+func firstString(fields map[string]any, keys ...string) string {
+	for _, key := range keys {
+		if value, ok := fields[key].(string); ok {
+			return value
+		}
+	}
+	return ""
+}
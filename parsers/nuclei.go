@@ -0,0 +1,74 @@
+package parsers
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	Register("nuclei", nucleiParser{})
+}
+
+// nucleiSeverities are the severity labels nuclei prints in brackets
+var nucleiSeverities = map[string]bool{
+	"info": true, "low": true, "medium": true, "high": true, "critical": true, "unknown": true,
+}
+
+// nucleiParser handles nuclei's plain output:
+// [template-id] [protocol] [severity] https://host/path [extra]
+type nucleiParser struct{}
+
+func (nucleiParser) Match(line string) bool {
+	if !strings.HasPrefix(line, "[") {
+		return false
+	}
+	for _, field := range bracketFields(line) {
+		if nucleiSeverities[strings.ToLower(field)] {
+			return true
+		}
+	}
+	return false
+}
+
+func (nucleiParser) Parse(line string) (ParsedRecord, error) {
+	fields := bracketFields(line)
+	if len(fields) < 3 {
+		return ParsedRecord{}, fmt.Errorf("not nuclei output")
+	}
+
+	// The matched location is the first token outside brackets
+	var target string
+	rest := line
+	for rest != "" {
+		rest = strings.TrimSpace(rest)
+		if strings.HasPrefix(rest, "[") {
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				break
+			}
+			rest = rest[end+1:]
+			continue
+		}
+		target = strings.Fields(rest)[0]
+		break
+	}
+	if target == "" {
+		return ParsedRecord{}, fmt.Errorf("no target in nuclei output")
+	}
+
+	var severity string
+	for _, field := range fields {
+		if nucleiSeverities[strings.ToLower(field)] {
+			severity = strings.ToLower(field)
+			break
+		}
+	}
+
+	context := fmt.Sprintf("template=%s severity=%s", fields[0], severity)
+	return ParsedRecord{
+		Target:  target,
+		Context: context,
+		Issue:   &Issue{Template: fields[0], Severity: severity},
+		Fields:  map[string]string{"template": fields[0], "severity": severity},
+	}, nil
+}
@@ -0,0 +1,159 @@
+package parsers
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ParsedRecord is what a parser extracts from a single line of tool output
+type ParsedRecord struct {
+	Target  string // asset to store, e.g. a host or URL
+	Tool    string // tool that produced the line
+	Context string // metadata stored in recon_data.context
+	// Issue is set when the line reports a vulnerability on the target,
+	// as scanner results such as nuclei's do
+	Issue *Issue
+	// Technologies lists the software a probe detected on the target
+	Technologies []Technology
+	// Alive is set when the line tells whether the target responded, as
+	// probes such as httpx do; nil leaves the stored status alone
+	Alive *bool
+	// BodyHash fingerprints the response body, so re-scans can tell when a
+	// page changed
+	BodyHash string
+	// StatusCode is the HTTP status the target answered with, or 0 when
+	// the line does not say
+	StatusCode int
+	// DNSRecords are the records a resolver such as dnsx returned for the
+	// target, in the order it returned them
+	DNSRecords []DNSRecord
+	// Rcode is the response code of that lookup, e.g. NOERROR or
+	// NXDOMAIN, or empty when the tool did not report one
+	Rcode string
+	// Fields holds named values from the line, such as httpx's status and
+	// title, for the context templates of processors.ContextTemplates.
+	// JSON lines carry every top-level scalar field.
+	Fields map[string]string
+}
+
+// Technology is a piece of software detected on a target, e.g. by httpx -td
+type Technology struct {
+	Name    string
+	Version string // empty when the tool did not detect one
+}
+
+// DNSRecord is one answer of a DNS lookup, e.g. a CNAME hop
+type DNSRecord struct {
+	Type  string // record type, e.g. "A" or "CNAME"
+	Value string
+}
+
+// Issue is a vulnerability a scanner reported, recorded as a finding
+type Issue struct {
+	Template string // scanner check that matched, e.g. a nuclei template id
+	Name     string // human-readable name of the check, if the tool gives one
+	Severity string // the tool's own severity label
+}
+
+// Parser understands the output format of one tool
+type Parser interface {
+	// Match reports whether the line is recognizably this tool's output
+	Match(line string) bool
+	// Parse extracts a record from a line of this tool's output
+	Parse(line string) (ParsedRecord, error)
+}
+
+// registry maps tool names to parsers; order keeps detection deterministic
+var (
+	registry = map[string]Parser{}
+	order    []string
+)
+
+// Register makes a parser available under a tool name. Parsers are tried
+// during detection in the order they were registered.
+func Register(tool string, p Parser) {
+	if _, exists := registry[tool]; !exists {
+		order = append(order, tool)
+	}
+	registry[tool] = p
+}
+
+// Get returns the parser registered for a tool
+func Get(tool string) (Parser, bool) {
+	p, ok := registry[tool]
+	return p, ok
+}
+
+// Detect returns the first registered parser whose Match accepts the line
+func Detect(line string) (string, Parser, bool) {
+	for _, tool := range order {
+		if registry[tool].Match(line) {
+			return tool, registry[tool], true
+		}
+	}
+	return "", nil, false
+}
+
+// Parse turns a line into a record. JSON lines have their target pulled
+// from well-known fields; other lines go to the parser registered for tool,
+// falling back to the first parser that recognizes the line. Lines no
+// parser understands are stored as-is, attributed to tool, except JSON
+// objects without a target field, which are rejected rather than stored
+// as a blob.
+func Parse(tool, line string) (ParsedRecord, error) {
+	line = StripANSI(line)
+
+	if IsJSONLine(line) {
+		return parseJSON(tool, line)
+	}
+
+	if p, ok := Get(tool); ok {
+		if record, err := p.Parse(line); err == nil && record.Target != "" {
+			record.Tool = tool
+			return record, nil
+		}
+	}
+
+	if detected, p, ok := Detect(line); ok {
+		if record, err := p.Parse(line); err == nil && record.Target != "" {
+			record.Tool = detected
+			return record, nil
+		}
+	}
+
+	return ParsedRecord{Target: line, Tool: tool}, nil
+}
+
+// ansiPattern matches terminal color escape sequences
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// StripANSI removes color codes that tools emit when not run with -nc
+func StripANSI(line string) string {
+	if !strings.Contains(line, "\x1b") {
+		return line
+	}
+	return ansiPattern.ReplaceAllString(line, "")
+}
+
+// bracketFields returns the contents of each [...] group in a line
+func bracketFields(line string) []string {
+	var fields []string
+	for {
+		start := strings.Index(line, "[")
+		if start < 0 {
+			return fields
+		}
+		end := strings.Index(line[start:], "]")
+		if end < 0 {
+			return fields
+		}
+		fields = append(fields, line[start+1:start+end])
+		line = line[start+end+1:]
+	}
+}
+
+// isHTTPURL reports whether s is an absolute http(s) URL
+func isHTTPURL(s string) bool {
+	lower := strings.ToLower(s)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
@@ -0,0 +1,208 @@
+package processors
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"ferri/models"
+)
+
+// BundleVersion is the format version ExportProgram writes and the newest
+// one ImportBundle reads
+const BundleVersion = 1
+
+// Bundle is a program and everything recorded on it, in a form that can be
+// shared as JSON and imported into another database
+type Bundle struct {
+	Version    int            `json:"version"`
+	ExportedAt time.Time      `json:"exported_at"`
+	Program    models.Program `json:"program"`
+	Targets    []BundleTarget `json:"targets"`
+}
+
+// BundleTarget is a target with its recon data and findings. IDs are those
+// of the exporting database; ImportBundle remaps them.
+type BundleTarget struct {
+	models.Target
+	ReconData []*models.ReconData `json:"recon_data"`
+	Findings  []*models.Finding   `json:"findings"`
+}
+
+// ExportProgram collects a program's targets, recon data and findings into
+// a bundle exported at now
+func ExportProgram(db *sql.DB, programID int, now time.Time) (*Bundle, error) {
+	program, err := models.NewProgramRepository(db).GetByID(programID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load program: %v", err)
+	}
+	targets, err := models.NewTargetRepository(db).ListByProgram(programID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load targets: %v", err)
+	}
+	recon, err := models.NewReconDataRepository(db).GetByProgramID(programID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load recon data: %v", err)
+	}
+	findings, err := models.NewFindingRepository(db).GetByProgramID(programID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load findings: %v", err)
+	}
+
+	bundle := &Bundle{
+		Version:    BundleVersion,
+		ExportedAt: now.UTC(),
+		Program:    *program,
+		Targets:    make([]BundleTarget, len(targets)),
+	}
+	index := make(map[int]*BundleTarget, len(targets))
+	for i, t := range targets {
+		bundle.Targets[i] = BundleTarget{
+			Target:    *t,
+			ReconData: []*models.ReconData{},
+			Findings:  []*models.Finding{},
+		}
+		index[t.ID] = &bundle.Targets[i]
+	}
+	for _, d := range recon {
+		if t := index[d.TargetID]; t != nil {
+			t.ReconData = append(t.ReconData, d)
+		}
+	}
+	for _, f := range findings {
+		if t := index[f.TargetID]; t != nil {
+			t.Findings = append(t.Findings, f)
+		}
+	}
+	return bundle, nil
+}
+
+// ImportResult counts what ImportBundle added and skipped
+type ImportResult struct {
+	ProgramID        int
+	ProgramCreated   bool
+	Targets          int
+	ExistingTargets  int
+	ReconRows        int
+	SkippedRecon     int
+	Findings         int
+	ExistingFindings int
+}
+
+const (
+	// importTargetSQL adds a bundled target unless the program already has it
+	importTargetSQL = `INSERT INTO targets (program_id, target, port, type, source, alive, last_checked,
+		tested, tested_date, test_notes, notes, created_at, body_hash, changed, screenshot_path, status_code)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT(program_id, target, port) DO NOTHING`
+	// importReconSQL adds a bundled recon row unless an identical one exists
+	importReconSQL = `INSERT INTO recon_data (target_id, tool, data, context, timestamp)
+		SELECT ?1, ?2, ?3, ?4, ?5 WHERE NOT EXISTS (
+			SELECT 1 FROM recon_data WHERE target_id = ?1 AND tool = ?2 AND data = ?3 AND timestamp = ?5)`
+	// importFindingSQL adds a bundled finding unless the target already has
+	// one with its title and type, or its report ID is taken
+	importFindingSQL = `INSERT INTO findings (target_id, title, type, severity, description,
+		proof_of_concept, status, reported_date, report_id, notes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`
+)
+
+// ImportBundle recreates a bundle's program, targets, recon data and
+// findings in one transaction. Everything is matched by value rather than
+// ID: the program by name, targets by value and port, recon rows by tool,
+// data and time, and findings by title and type. What already exists is
+// left as it is, so importing a bundle twice adds nothing the second time.
+func ImportBundle(db *sql.DB, bundle *Bundle) (*ImportResult, error) {
+	if bundle.Version < 1 || bundle.Version > BundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d (this ferri reads up to %d)", bundle.Version, BundleVersion)
+	}
+
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start import: %v", err)
+	}
+	defer tx.Rollback()
+
+	result := &ImportResult{}
+	p := bundle.Program
+	result.ProgramID, result.ProgramCreated, err = GetOrCreateProgramByNameContext(ctx, tx, p.Name, p.Scope.NullString)
+	if err != nil {
+		return nil, err
+	}
+	if result.ProgramCreated {
+		_, err := tx.ExecContext(ctx, "UPDATE programs SET url = ?, out_of_scope = ?, bounty_notes = ? WHERE id = ?",
+			p.URL, p.OutOfScope, p.BountyNotes, result.ProgramID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import program: %v", err)
+		}
+	}
+
+	// Bundle target IDs map to the IDs of the same targets here
+	ids := make(map[int]int, len(bundle.Targets))
+	for _, t := range bundle.Targets {
+		res, err := tx.ExecContext(ctx, importTargetSQL, result.ProgramID, t.Target.Target, t.Port, t.Type,
+			t.Source, t.Alive, t.LastChecked, t.Tested, t.TestedDate, t.TestNotes, t.Notes,
+			t.CreatedAt.UTC(), t.BodyHash, t.Changed, t.ScreenshotPath, t.StatusCode)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import target %s: %v", t.Address(), err)
+		}
+		if inserted, _ := res.RowsAffected(); inserted > 0 {
+			result.Targets++
+		} else {
+			result.ExistingTargets++
+		}
+
+		var id int
+		err = tx.QueryRowContext(ctx, "SELECT id FROM targets WHERE program_id = ? AND target = ? AND port = ?",
+			result.ProgramID, t.Target.Target, t.Port).Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get target ID: %v", err)
+		}
+		ids[t.ID] = id
+	}
+
+	for _, t := range bundle.Targets {
+		id := ids[t.ID]
+		if parent, ok := ids[int(t.ParentID.Int64)]; t.ParentID.Valid && ok {
+			_, err := tx.ExecContext(ctx, "UPDATE targets SET parent_id = ? WHERE id = ? AND parent_id IS NULL", parent, id)
+			if err != nil {
+				return nil, fmt.Errorf("failed to link target %s: %v", t.Address(), err)
+			}
+		}
+
+		for _, d := range t.ReconData {
+			res, err := tx.ExecContext(ctx, importReconSQL, id, d.Tool, d.Data, d.Context, d.Timestamp.UTC())
+			if err != nil {
+				return nil, fmt.Errorf("failed to import recon data for %s: %v", t.Address(), err)
+			}
+			if inserted, _ := res.RowsAffected(); inserted > 0 {
+				result.ReconRows++
+			} else {
+				result.SkippedRecon++
+			}
+		}
+
+		for _, f := range t.Findings {
+			severity, _ := ScannerSeverity(string(f.Severity))
+			status, err := models.ParseStatus(string(f.Status))
+			if err != nil {
+				status = models.StatusOpen
+			}
+			res, err := tx.ExecContext(ctx, importFindingSQL, id, f.Title, f.Type, severity, f.Description,
+				f.ProofOfConcept, status, f.ReportedDate, f.ReportID, f.Notes, f.CreatedAt.UTC())
+			if err != nil {
+				return nil, fmt.Errorf("failed to import finding %q on %s: %v", f.Title, t.Address(), err)
+			}
+			if inserted, _ := res.RowsAffected(); inserted > 0 {
+				result.Findings++
+			} else {
+				result.ExistingFindings++
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit import: %v", err)
+	}
+	return result, nil
+}
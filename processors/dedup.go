@@ -0,0 +1,155 @@
+package processors
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"ferri/models"
+)
+
+// DuplicateTarget is a target value stored under more than one program,
+// typically because program extraction guessed differently across ingests
+type DuplicateTarget struct {
+	Target    string
+	Port      int
+	Instances []TargetInstance
+}
+
+// TargetInstance is one program's copy of a duplicated target
+type TargetInstance struct {
+	TargetID    int
+	ProgramID   int
+	ProgramName string
+	CreatedAt   time.Time
+}
+
+// FindCrossProgramDuplicates returns every target value present in more
+// than one program, each with its copies ordered by when they were created
+func FindCrossProgramDuplicates(db *sql.DB) ([]DuplicateTarget, error) {
+	rows, err := db.Query(`SELECT t.target, t.port, t.id, p.id, p.name, t.created_at
+		FROM targets t
+		JOIN programs p ON p.id = t.program_id
+		WHERE (t.target, t.port) IN (
+			SELECT target, port FROM targets GROUP BY target, port HAVING COUNT(DISTINCT program_id) > 1
+		)
+		ORDER BY t.target, t.port, t.created_at, t.id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query duplicates: %v", err)
+	}
+	defer rows.Close()
+
+	var dups []DuplicateTarget
+	for rows.Next() {
+		var target string
+		var port int
+		var inst TargetInstance
+		if err := rows.Scan(&target, &port, &inst.TargetID, &inst.ProgramID, &inst.ProgramName, &inst.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to read duplicate: %v", err)
+		}
+		if len(dups) == 0 || dups[len(dups)-1].Target != target || dups[len(dups)-1].Port != port {
+			dups = append(dups, DuplicateTarget{Target: target, Port: port})
+		}
+		last := &dups[len(dups)-1]
+		last.Instances = append(last.Instances, inst)
+	}
+	return dups, rows.Err()
+}
+
+// sameFindingKey matches the finding d of target ?2 keyed like the finding
+// being updated
+const sameFindingKey = `d.target_id = ?2 AND d.title = findings.title AND COALESCE(d.type, '') = COALESCE(findings.type, '')`
+
+// mergeTargetStatements fold the target with id ?2 into the target with id
+// ?1: its recon data, findings, DNS records, tags, technologies, children
+// and the runs that saw it move over, flags and notes are combined, and the copy is
+// deleted
+var mergeTargetStatements = []string{
+	"UPDATE recon_data SET target_id = ?1 WHERE target_id = ?2",
+	// A finding both copies have is keyed the same, so the kept one takes
+	// the higher severity and the later status and the other is deleted
+	`UPDATE findings SET
+		severity = (SELECT CASE WHEN ` + models.SeverityRank("d.severity") + ` < ` + models.SeverityRank("findings.severity") + `
+			THEN d.severity ELSE findings.severity END FROM findings d WHERE ` + sameFindingKey + `),
+		status = (SELECT CASE WHEN ` + models.StatusRank("d.status") + ` > ` + models.StatusRank("findings.status") + `
+			THEN d.status ELSE findings.status END FROM findings d WHERE ` + sameFindingKey + `)
+		WHERE target_id = ?1 AND EXISTS (SELECT 1 FROM findings d WHERE ` + sameFindingKey + `)`,
+	// The runs that reported the deleted one count as reporting the kept one
+	`INSERT OR IGNORE INTO run_findings (run_id, finding_id) SELECT l.run_id, k.id FROM run_findings l
+		JOIN findings d ON d.id = l.finding_id
+		JOIN findings k ON k.target_id = ?1 AND k.title = d.title AND COALESCE(k.type, '') = COALESCE(d.type, '')
+		WHERE d.target_id = ?2`,
+	`DELETE FROM run_findings WHERE finding_id IN (SELECT d.id FROM findings d JOIN findings k
+		ON k.target_id = ?1 AND k.title = d.title AND COALESCE(k.type, '') = COALESCE(d.type, '') WHERE d.target_id = ?2)`,
+	`DELETE FROM findings WHERE target_id = ?2 AND EXISTS (SELECT 1 FROM findings k
+		WHERE k.target_id = ?1 AND k.title = findings.title AND COALESCE(k.type, '') = COALESCE(findings.type, ''))`,
+	"UPDATE findings SET target_id = ?1 WHERE target_id = ?2",
+	`INSERT OR IGNORE INTO dns_records (target_id, type, value, position, resolved_at)
+		SELECT ?1, type, value, position, resolved_at FROM dns_records WHERE target_id = ?2`,
+	"DELETE FROM dns_records WHERE target_id = ?2",
+	"INSERT OR IGNORE INTO target_tags (target_id, tag_id) SELECT ?1, tag_id FROM target_tags WHERE target_id = ?2",
+	"DELETE FROM target_tags WHERE target_id = ?2",
+	"INSERT OR IGNORE INTO technologies (target_id, name, version) SELECT ?1, name, version FROM technologies WHERE target_id = ?2",
+	"DELETE FROM technologies WHERE target_id = ?2",
+	"UPDATE target_status_history SET target_id = ?1 WHERE target_id = ?2",
+	"INSERT OR IGNORE INTO run_targets (run_id, target_id) SELECT run_id, ?1 FROM run_targets WHERE target_id = ?2",
+	"DELETE FROM run_targets WHERE target_id = ?2",
+	"UPDATE targets SET parent_id = ?1 WHERE parent_id = ?2",
+	`UPDATE targets SET
+		alive = alive OR (SELECT alive FROM targets WHERE id = ?2),
+		tested = tested OR (SELECT tested FROM targets WHERE id = ?2),
+		tested_date = COALESCE(tested_date, (SELECT tested_date FROM targets WHERE id = ?2)),
+		test_notes = COALESCE(test_notes, (SELECT test_notes FROM targets WHERE id = ?2)),
+		body_hash = COALESCE(body_hash, (SELECT body_hash FROM targets WHERE id = ?2)),
+		screenshot_path = COALESCE(screenshot_path, (SELECT screenshot_path FROM targets WHERE id = ?2)),
+		status_code = COALESCE(status_code, (SELECT status_code FROM targets WHERE id = ?2)),
+		notes = CASE
+			WHEN (SELECT notes FROM targets WHERE id = ?2) IS NULL THEN notes
+			WHEN notes IS NULL OR notes = '' THEN (SELECT notes FROM targets WHERE id = ?2)
+			ELSE notes || char(10) || (SELECT notes FROM targets WHERE id = ?2)
+		END
+		WHERE id = ?1`,
+	"DELETE FROM targets WHERE id = ?2",
+}
+
+// MergeDuplicates folds every copy of each duplicate into the copy owned by
+// keepProgramID, all in one transaction. Duplicates that keepProgramID has
+// no copy of are left alone. It returns how many copies were removed.
+func MergeDuplicates(db *sql.DB, dups []DuplicateTarget, keepProgramID int) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin merge: %v", err)
+	}
+	defer tx.Rollback()
+
+	removed := 0
+	for _, dup := range dups {
+		keepID := 0
+		for _, inst := range dup.Instances {
+			if inst.ProgramID == keepProgramID {
+				keepID = inst.TargetID
+				break
+			}
+		}
+		if keepID == 0 {
+			continue
+		}
+
+		for _, inst := range dup.Instances {
+			if inst.TargetID == keepID {
+				continue
+			}
+			for _, stmt := range mergeTargetStatements {
+				if _, err := tx.Exec(stmt, keepID, inst.TargetID); err != nil {
+					return 0, fmt.Errorf("failed to merge %s from program %s: %v", dup.Target, inst.ProgramName, err)
+				}
+			}
+			removed++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit merge: %v", err)
+	}
+	return removed, nil
+}
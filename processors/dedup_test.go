@@ -0,0 +1,164 @@
+package processors
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"testing"
+
+	"ferri/models"
+)
+
+func TestMergeDuplicatesFindings(t *testing.T) {
+	tests := []struct {
+		name string
+		// findings on the kept copy and on the copy merged into it
+		kept, merged []models.Finding
+		want         []models.Finding
+	}{
+		{
+			name:   "same finding keeps the higher severity and later status",
+			kept:   []models.Finding{{Title: "XSS", Severity: models.SeverityLow, Status: models.StatusTriaged}},
+			merged: []models.Finding{{Title: "XSS", Severity: models.SeverityHigh, Status: models.StatusOpen}},
+			want:   []models.Finding{{Title: "XSS", Severity: models.SeverityHigh, Status: models.StatusTriaged}},
+		},
+		{
+			name:   "kept copy already higher",
+			kept:   []models.Finding{{Title: "XSS", Severity: models.SeverityCritical, Status: models.StatusOpen}},
+			merged: []models.Finding{{Title: "XSS", Severity: models.SeverityLow, Status: models.StatusResolved}},
+			want:   []models.Finding{{Title: "XSS", Severity: models.SeverityCritical, Status: models.StatusResolved}},
+		},
+		{
+			name:   "other findings move over",
+			kept:   []models.Finding{{Title: "XSS", Severity: models.SeverityLow}},
+			merged: []models.Finding{{Title: "XSS", Severity: models.SeverityLow}, {Title: "SQLi", Severity: models.SeverityHigh}},
+			want: []models.Finding{
+				{Title: "SQLi", Severity: models.SeverityHigh, Status: models.StatusOpen},
+				{Title: "XSS", Severity: models.SeverityLow, Status: models.StatusOpen},
+			},
+		},
+		{
+			name:   "different type is not a collision",
+			kept:   []models.Finding{{Title: "XSS", Type: models.NewNullString("a"), Severity: models.SeverityLow}},
+			merged: []models.Finding{{Title: "XSS", Type: models.NewNullString("b"), Severity: models.SeverityLow}},
+			want: []models.Finding{
+				{Title: "XSS", Severity: models.SeverityLow, Status: models.StatusOpen},
+				{Title: "XSS", Severity: models.SeverityLow, Status: models.StatusOpen},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			keptID, mergedID := duplicateTarget(t, db)
+			repo := models.NewFindingRepository(db)
+			for targetID, findings := range map[int][]models.Finding{keptID: tt.kept, mergedID: tt.merged} {
+				for _, f := range findings {
+					f.TargetID = targetID
+					if err := repo.Create(&f); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			dups, err := FindCrossProgramDuplicates(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := MergeDuplicates(db, dups, 1); err != nil {
+				t.Fatalf("MergeDuplicates: %v", err)
+			}
+
+			got, err := repo.GetByTargetID(keptID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Slice(got, func(i, j int) bool { return got[i].Title < got[j].Title })
+			if len(got) != len(tt.want) {
+				t.Fatalf("%d findings after the merge, want %d", len(got), len(tt.want))
+			}
+			for i, want := range tt.want {
+				if got[i].Title != want.Title || got[i].Severity != want.Severity || got[i].Status != want.Status {
+					t.Errorf("finding %d = %s/%s/%s, want %s/%s/%s", i, got[i].Title, got[i].Severity, got[i].Status,
+						want.Title, want.Severity, want.Status)
+				}
+			}
+			if n := count(t, db, "SELECT COUNT(*) FROM findings WHERE target_id = ?", mergedID); n != 0 {
+				t.Errorf("%d findings left on the merged copy", n)
+			}
+		})
+	}
+}
+
+// duplicateTarget stores a.example.com under two programs and returns the
+// id of program 1's copy and of program 2's
+func duplicateTarget(t *testing.T, db *sql.DB) (int, int) {
+	t.Helper()
+	var ids [2]int
+	for i, name := range []string{"example", "example-old"} {
+		res, err := db.Exec("INSERT INTO programs (name) VALUES (?)", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		programID, _ := res.LastInsertId()
+		if ids[i], _, err = GetOrCreateTarget(db, "a.example.com", "manual", int(programID)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ids[0], ids[1]
+}
+
+func TestMergeDuplicatesDNSRecords(t *testing.T) {
+	tests := []struct {
+		name         string
+		kept, merged []models.DNSRecord
+		want         []string
+	}{
+		{
+			name:   "records only the copy has move over",
+			merged: []models.DNSRecord{{Type: models.DNSRecordCNAME, Value: "a.github.io"}},
+			want:   []string{"CNAME a.github.io"},
+		},
+		{
+			name:   "records both copies have are kept once",
+			kept:   []models.DNSRecord{{Type: models.DNSRecordA, Value: "192.0.2.1"}},
+			merged: []models.DNSRecord{{Type: models.DNSRecordA, Value: "192.0.2.1"}, {Type: models.DNSRecordA, Value: "192.0.2.2"}},
+			want:   []string{"A 192.0.2.1", "A 192.0.2.2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			keptID, mergedID := duplicateTarget(t, db)
+			for targetID, records := range map[int][]models.DNSRecord{keptID: tt.kept, mergedID: tt.merged} {
+				if err := ProcessDnsxLine(t.Context(), db, targetID, records); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			dups, err := FindCrossProgramDuplicates(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := MergeDuplicates(db, dups, 1); err != nil {
+				t.Fatalf("MergeDuplicates: %v", err)
+			}
+
+			records, err := models.NewDNSRecordRepository(db).GetByTargetID(keptID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range records {
+				got = append(got, string(r.Type)+" "+r.Value)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("records = %v, want %v", got, tt.want)
+			}
+			if n := count(t, db, "SELECT COUNT(*) FROM dns_records WHERE target_id = ?", mergedID); n != 0 {
+				t.Errorf("%d records left on the merged copy", n)
+			}
+		})
+	}
+}
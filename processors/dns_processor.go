@@ -0,0 +1,45 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+
+	"ferri/database"
+	"ferri/models"
+)
+
+const (
+	// clearDNSRecordsSQL drops a target's records of one type before a
+	// fresh answer replaces them
+	clearDNSRecordsSQL = "DELETE FROM dns_records WHERE target_id = ? AND type = ?"
+	// insertDNSRecordSQL stores one record of a target
+	insertDNSRecordSQL = `INSERT INTO dns_records (target_id, type, value, position, resolved_at) VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(target_id, type, value) DO UPDATE SET position = excluded.position, resolved_at = excluded.resolved_at`
+)
+
+// ProcessDnsxLine stores the records of a dnsx JSON line on its host
+// target. Each record type in the line replaces the records of that type
+// stored before; types the line leaves out are kept. Records keep their
+// position within their type, so a CNAME chain can be followed hop by hop
+// to the name a takeover would claim.
+func ProcessDnsxLine(ctx context.Context, q Querier, targetID int, records []models.DNSRecord) error {
+	now := nowOf(q)
+	cleared := make(map[models.DNSRecordType]int)
+	for _, record := range records {
+		position, seen := cleared[record.Type]
+		err := database.WithRetry(func() error {
+			if !seen {
+				if _, err := q.ExecContext(ctx, clearDNSRecordsSQL, targetID, record.Type); err != nil {
+					return err
+				}
+			}
+			_, err := q.ExecContext(ctx, insertDNSRecordSQL, targetID, record.Type, record.Value, position, now)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to store %s record %s: %v", record.Type, record.Value, err)
+		}
+		cleared[record.Type] = position + 1
+	}
+	return nil
+}
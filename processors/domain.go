@@ -0,0 +1,19 @@
+package processors
+
+import (
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// RegistrableDomain returns the registrable domain (eTLD+1) of a host,
+// e.g. api.example.co.uk -> example.co.uk. It returns an empty string when
+// the host has no registrable part, such as a bare TLD or a single label.
+func RegistrableDomain(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return ""
+	}
+	return domain
+}
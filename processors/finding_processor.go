@@ -0,0 +1,135 @@
+package processors
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"ferri/database"
+	"ferri/models"
+)
+
+// SeverityAliases map the severity labels of scanners that do not use
+// ferri's scale onto it. Keys are lowercase; the config file's
+// severity_map adds to them through AddSeverityAliases.
+var SeverityAliases = map[string]models.FindingSeverity{
+	"informational": models.SeverityInfo,
+	"information":   models.SeverityInfo,
+	"none":          models.SeverityInfo,
+	"unknown":       models.SeverityInfo,
+	"moderate":      models.SeverityMedium,
+	"important":     models.SeverityHigh,
+	"severe":        models.SeverityHigh,
+}
+
+// AddSeverityAliases adds label-to-severity mappings, such as
+// "warning": "low", to SeverityAliases, overriding existing ones
+func AddSeverityAliases(aliases map[string]string) error {
+	for label, name := range aliases {
+		severity, err := models.ParseSeverity(name)
+		if err != nil {
+			return fmt.Errorf("severity mapping for %q: %v", label, err)
+		}
+		SeverityAliases[strings.ToLower(strings.TrimSpace(label))] = severity
+	}
+	return nil
+}
+
+// ScannerSeverity maps a scanner's severity label onto ferri's scale,
+// directly or through SeverityAliases. Labels it does not know become info,
+// with ok false so the caller can warn about them.
+func ScannerSeverity(label string) (severity models.FindingSeverity, ok bool) {
+	if severity, err := models.ParseSeverity(label); err == nil {
+		return severity, true
+	}
+	if severity, ok := SeverityAliases[strings.ToLower(strings.TrimSpace(label))]; ok {
+		return severity, true
+	}
+	return models.SeverityInfo, false
+}
+
+// RecordFindingContext stores a finding reported by a scanner against a
+// target through models.UpsertFinding, so re-ingesting a scan does not
+// repeat it; a known finding only gets the new severity, as its status may
+// already have moved on in triage. The finding is linked to the ingest run
+// of q, if any, so undoing the run removes it. It returns the finding ID
+// and whether it was created.
+func RecordFindingContext(ctx context.Context, q Querier, targetID int, title, findingType string, severity models.FindingSeverity) (int, bool, error) {
+	f := &models.Finding{
+		TargetID: targetID,
+		Title:    title,
+		Type:     models.NewNullString(findingType),
+		Severity: severity,
+	}
+	var created bool
+	err := database.WithRetry(func() (err error) {
+		created, err = models.UpsertFinding(ctx, q, f)
+		return err
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to record finding: %v", err)
+	}
+	if err := linkRunFinding(ctx, q, f.ID, created); err != nil {
+		return 0, false, err
+	}
+	return f.ID, created, nil
+}
+
+// linkRunFinding records that the run writing through q, if any, reported
+// the finding id, attributing the finding to the run when it was created
+func linkRunFinding(ctx context.Context, q Querier, id int, created bool) error {
+	run := runOf(q)
+	if !run.Valid {
+		return nil
+	}
+	err := database.WithRetry(func() error {
+		if created {
+			if _, err := q.ExecContext(ctx, "UPDATE findings SET run_id = ? WHERE id = ?", run, id); err != nil {
+				return err
+			}
+		}
+		_, err := q.ExecContext(ctx, "INSERT OR IGNORE INTO run_findings (run_id, finding_id) VALUES (?, ?)", run, id)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to link finding to run: %v", err)
+	}
+	return nil
+}
+
+// RecordFinding stores a finding on a target given by value, creating the
+// program and target the way an ingest would when they do not exist yet.
+// The program is programName, or else the one derived from the target.
+// Everything happens in one transaction, so a failed insert leaves no
+// half-created program or target behind. On success f.TargetID and f.ID
+// are set.
+func RecordFinding(db *sql.DB, programName, targetStr string, f *models.Finding) error {
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var programID int
+	if programName != "" {
+		programID, _, err = GetOrCreateProgramByNameContext(ctx, tx, programName, sql.NullString{})
+	} else {
+		programID, _, err = GetOrCreateProgramContext(ctx, tx, targetStr)
+	}
+	if err != nil {
+		return err
+	}
+
+	if f.TargetID, _, err = GetOrCreateTargetContext(ctx, tx, targetStr, "manual", programID); err != nil {
+		return err
+	}
+	if err := models.NewFindingRepository(db).CreateTx(tx, f); err != nil {
+		return fmt.Errorf("failed to create finding: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit finding: %v", err)
+	}
+	return nil
+}
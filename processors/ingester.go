@@ -0,0 +1,188 @@
+package processors
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"ferri/models"
+	"ferri/utils"
+)
+
+// ingestQueries are the statements an ingest runs once per target
+var ingestQueries = append([]string{selectTargetSQL, insertTargetSQL, linkParentSQL, selectReconSQL, insertReconSQL, mergeReconSQL, linkRunReconSQL, insertTechnologySQL, clearDNSRecordsSQL, insertDNSRecordSQL, selectBodyHashSQL, updateBodyHashSQL, updateStatusCodeSQL, linkRunTargetSQL}, models.MarkAliveQueries...)
+
+// Ingester writes targets and recon data through statements prepared once
+// and reused for every line, batching the writes into transactions. It
+// satisfies Querier, so the regular get-or-create logic runs unchanged on
+// top of the prepared statements.
+type Ingester struct {
+	db      *sql.DB
+	stmts   map[string]*sql.Stmt
+	tx      *sql.Tx
+	txStmts map[string]*sql.Stmt
+	run     sql.NullInt64
+	clock   utils.Clock
+}
+
+// NewIngester prepares the ingest statements on db. Call Close when done.
+func NewIngester(ctx context.Context, db *sql.DB) (*Ingester, error) {
+	in := &Ingester{db: db, stmts: make(map[string]*sql.Stmt, len(ingestQueries)), clock: utils.RealClock{}}
+	for _, query := range ingestQueries {
+		stmt, err := db.PrepareContext(ctx, query)
+		if err != nil {
+			in.Close()
+			return nil, fmt.Errorf("failed to prepare statement: %v", err)
+		}
+		in.stmts[query] = stmt
+	}
+	return in, nil
+}
+
+// Begin starts a transaction and binds the prepared statements to it
+func (in *Ingester) Begin(ctx context.Context) error {
+	if in.tx != nil {
+		return fmt.Errorf("transaction already in progress")
+	}
+	tx, err := in.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	in.tx = tx
+	in.txStmts = make(map[string]*sql.Stmt, len(in.stmts))
+	for query, stmt := range in.stmts {
+		in.txStmts[query] = tx.StmtContext(ctx, stmt)
+	}
+	return nil
+}
+
+// SetRun attributes the targets and recon data written from now on to an
+// ingest run
+func (in *Ingester) SetRun(runID int) {
+	in.run = sql.NullInt64{Int64: int64(runID), Valid: true}
+}
+
+// RunID returns the run set with SetRun, or NULL
+func (in *Ingester) RunID() sql.NullInt64 {
+	return in.run
+}
+
+// SetClock stamps the rows written from now on with the time clock tells
+func (in *Ingester) SetClock(clock utils.Clock) {
+	in.clock = clock
+}
+
+// Now returns the time the rows written now are stamped with
+func (in *Ingester) Now() time.Time {
+	return in.clock.Now()
+}
+
+// InTx reports whether a transaction is open
+func (in *Ingester) InTx() bool {
+	return in.tx != nil
+}
+
+// Commit commits the open transaction, if any
+func (in *Ingester) Commit() error {
+	if in.tx == nil {
+		return nil
+	}
+	err := in.tx.Commit()
+	in.tx, in.txStmts = nil, nil
+	return err
+}
+
+// Rollback discards the open transaction, if any
+func (in *Ingester) Rollback() error {
+	if in.tx == nil {
+		return nil
+	}
+	err := in.tx.Rollback()
+	in.tx, in.txStmts = nil, nil
+	return err
+}
+
+// GetOrCreateTarget is GetOrCreateTargetContext on the prepared statements
+func (in *Ingester) GetOrCreateTarget(ctx context.Context, targetURL, toolName string, programID int) (int, bool, error) {
+	return GetOrCreateTargetContext(ctx, in, targetURL, toolName, programID)
+}
+
+// AddReconData is AddReconDataContext on the prepared statements
+func (in *Ingester) AddReconData(ctx context.Context, targetID int, tool, data, reconContext string) (bool, error) {
+	return AddReconDataContext(ctx, in, targetID, tool, data, reconContext)
+}
+
+// RecordFinding is RecordFindingContext on the prepared statements
+func (in *Ingester) RecordFinding(ctx context.Context, targetID int, title, findingType string, severity models.FindingSeverity) (int, bool, error) {
+	return RecordFindingContext(ctx, in, targetID, title, findingType, severity)
+}
+
+// ProcessDnsxLine is ProcessDnsxLine on the prepared statements
+func (in *Ingester) ProcessDnsxLine(ctx context.Context, targetID int, records []models.DNSRecord) error {
+	return ProcessDnsxLine(ctx, in, targetID, records)
+}
+
+// AddTechnology is AddTechnologyContext on the prepared statements
+func (in *Ingester) AddTechnology(ctx context.Context, targetID int, name, version string) error {
+	return AddTechnologyContext(ctx, in, targetID, name, version)
+}
+
+// UpdateBodyHash is UpdateBodyHashContext on the prepared statements
+func (in *Ingester) UpdateBodyHash(ctx context.Context, targetID int, hash string) (bool, error) {
+	return UpdateBodyHashContext(ctx, in, targetID, hash)
+}
+
+// UpdateStatusCode is UpdateStatusCodeContext on the prepared statements
+func (in *Ingester) UpdateStatusCode(ctx context.Context, targetID, code int) error {
+	return UpdateStatusCodeContext(ctx, in, targetID, code)
+}
+
+// MarkAlive is MarkAliveContext on the prepared statements
+func (in *Ingester) MarkAlive(ctx context.Context, targetID int, alive bool) (bool, error) {
+	return MarkAliveContext(ctx, in, targetID, alive)
+}
+
+// ExecContext runs query through its prepared statement when there is one
+func (in *Ingester) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if stmt := in.stmt(query); stmt != nil {
+		return stmt.ExecContext(ctx, args...)
+	}
+	if in.tx != nil {
+		return in.tx.ExecContext(ctx, query, args...)
+	}
+	return in.db.ExecContext(ctx, query, args...)
+}
+
+// QueryRowContext runs query through its prepared statement when there is one
+func (in *Ingester) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if stmt := in.stmt(query); stmt != nil {
+		return stmt.QueryRowContext(ctx, args...)
+	}
+	if in.tx != nil {
+		return in.tx.QueryRowContext(ctx, query, args...)
+	}
+	return in.db.QueryRowContext(ctx, query, args...)
+}
+
+// stmt returns the prepared statement for query, bound to the open
+// transaction if there is one
+func (in *Ingester) stmt(query string) *sql.Stmt {
+	if in.tx != nil {
+		return in.txStmts[query]
+	}
+	return in.stmts[query]
+}
+
+// Close rolls back any open transaction and releases the prepared statements
+func (in *Ingester) Close() error {
+	in.Rollback()
+	var firstErr error
+	for _, stmt := range in.stmts {
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	in.stmts = nil
+	return firstErr
+}
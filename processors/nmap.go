@@ -0,0 +1,184 @@
+package processors
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"ferri/models"
+)
+
+// NmapHost is a scanned host with the ports Nmap found open on it
+type NmapHost struct {
+	Address   string
+	Hostnames []string
+	Ports     []NmapPort
+}
+
+// NmapPort is an open port and the service Nmap identified on it
+type NmapPort struct {
+	Port     int
+	Protocol string
+	Service  string
+	Product  string
+	Version  string
+	Extra    string
+}
+
+// nmapRun mirrors the parts of Nmap's -oX output that are imported
+type nmapRun struct {
+	Hosts []struct {
+		Status struct {
+			State string `xml:"state,attr"`
+		} `xml:"status"`
+		Addresses []struct {
+			Addr string `xml:"addr,attr"`
+			Type string `xml:"addrtype,attr"`
+		} `xml:"address"`
+		Hostnames []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"hostnames>hostname"`
+		Ports []struct {
+			Protocol string `xml:"protocol,attr"`
+			PortID   string `xml:"portid,attr"`
+			State    struct {
+				State string `xml:"state,attr"`
+			} `xml:"state"`
+			Service struct {
+				Name      string `xml:"name,attr"`
+				Product   string `xml:"product,attr"`
+				Version   string `xml:"version,attr"`
+				ExtraInfo string `xml:"extrainfo,attr"`
+			} `xml:"service"`
+		} `xml:"ports>port"`
+	} `xml:"host"`
+}
+
+// ParseNmapXML reads Nmap's XML output (nmap -oX) and returns the hosts
+// that were up, each with its open ports. MAC addresses are ignored.
+func ParseNmapXML(r io.Reader) ([]NmapHost, error) {
+	var run nmapRun
+	if err := xml.NewDecoder(r).Decode(&run); err != nil {
+		return nil, fmt.Errorf("failed to parse Nmap XML: %v", err)
+	}
+
+	var hosts []NmapHost
+	for _, h := range run.Hosts {
+		if h.Status.State != "" && h.Status.State != "up" {
+			continue
+		}
+		host := NmapHost{}
+		for _, a := range h.Addresses {
+			if a.Type == "ipv4" || a.Type == "ipv6" {
+				host.Address = a.Addr
+				break
+			}
+		}
+		if host.Address == "" {
+			continue
+		}
+		for _, name := range h.Hostnames {
+			if name.Name != "" {
+				host.Hostnames = append(host.Hostnames, name.Name)
+			}
+		}
+		for _, p := range h.Ports {
+			if p.State.State != "open" {
+				continue
+			}
+			port, err := strconv.Atoi(p.PortID)
+			if err != nil || port < 1 || port > 65535 {
+				return nil, fmt.Errorf("invalid port %q on %s", p.PortID, host.Address)
+			}
+			host.Ports = append(host.Ports, NmapPort{
+				Port:     port,
+				Protocol: p.Protocol,
+				Service:  p.Service.Name,
+				Product:  p.Service.Product,
+				Version:  p.Service.Version,
+				Extra:    p.Service.ExtraInfo,
+			})
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+// String renders a port the way Nmap lists it, e.g.
+// "443/tcp https nginx 1.18.0 (Ubuntu)"
+func (p NmapPort) String() string {
+	fields := []string{fmt.Sprintf("%d/%s", p.Port, p.Protocol)}
+	for _, f := range []string{p.Service, p.Product, p.Version} {
+		if f != "" {
+			fields = append(fields, f)
+		}
+	}
+	if p.Extra != "" {
+		fields = append(fields, "("+p.Extra+")")
+	}
+	return strings.Join(fields, " ")
+}
+
+// NmapImport counts what ImportNmapContext stored
+type NmapImport struct {
+	Hosts   int
+	Ports   int
+	Created int
+}
+
+// ImportNmapContext stores each host as an IP target and each open port as
+// a target with its port set, recording the service Nmap identified as
+// recon data of the port
+func ImportNmapContext(ctx context.Context, q Querier, programID int, hosts []NmapHost) (*NmapImport, error) {
+	summary := &NmapImport{}
+	for _, host := range hosts {
+		hostID, created, err := GetOrCreateTargetContext(ctx, q, host.Address, "nmap", programID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store host %s: %v", host.Address, err)
+		}
+		summary.Hosts++
+		if created {
+			summary.Created++
+		}
+		reconContext := "Discovered via nmap"
+		if len(host.Hostnames) > 0 {
+			reconContext = "hostnames=" + strings.Join(host.Hostnames, ",")
+		}
+		if _, err := AddReconDataContext(ctx, q, hostID, "nmap", host.Address, reconContext); err != nil {
+			return nil, err
+		}
+
+		for _, port := range host.Ports {
+			address := models.JoinHostPort(host.Address, port.Port)
+			portID, created, err := GetOrCreateTargetContext(ctx, q, address, "nmap", programID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to store port %s: %v", address, err)
+			}
+			summary.Ports++
+			if created {
+				summary.Created++
+			}
+			if _, err := AddReconDataContext(ctx, q, portID, "nmap", port.String(), nmapServiceContext(port)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return summary, nil
+}
+
+// nmapServiceContext describes an identified service as key=value pairs
+func nmapServiceContext(p NmapPort) string {
+	var pairs []string
+	for _, kv := range [][2]string{{"service", p.Service}, {"product", p.Product}, {"version", p.Version}} {
+		if kv[1] != "" {
+			pairs = append(pairs, kv[0]+"="+kv[1])
+		}
+	}
+	if len(pairs) == 0 {
+		return "Discovered via nmap"
+	}
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,96 @@
+package processors
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"ferri/utils"
+
+	"golang.org/x/net/idna"
+)
+
+// defaultPorts maps URL schemes to the port implied when none is given
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// NormalizeURL reduces equivalent spellings of a URL to one form so they
+// are stored as a single target: the scheme and host are lowercased, the
+// scheme's default port is dropped, a bare "/" path is removed and the
+// fragment is discarded. Input that does not parse as an absolute URL is
+// returned unchanged.
+func NormalizeURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return raw
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if strings.Contains(host, ":") {
+		// IPv6 literals keep their brackets
+		host = "[" + host + "]"
+	}
+	if port := u.Port(); port != "" && port != defaultPorts[u.Scheme] {
+		host += ":" + port
+	}
+	u.Host = host
+
+	if u.Path == "/" {
+		u.Path = ""
+		u.RawPath = ""
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	return u.String()
+}
+
+// CanonicalizeTarget reduces the spellings tools emit for one host to a
+// single form: the host is lowercased, a trailing dot is dropped and
+// Unicode labels are converted to punycode, so Example.com and example.com.
+// are the same target and a homoglyph such as еxample.com (Cyrillic е)
+// shows up as xn--xample-2of.com. URLs have their host canonicalized and
+// are otherwise left to NormalizeURL; IPs are returned unchanged.
+func CanonicalizeTarget(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "://") {
+		u, err := url.Parse(s)
+		if err != nil || u.Host == "" {
+			return s
+		}
+		host := canonicalHost(u.Hostname())
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		if port := u.Port(); port != "" {
+			host += ":" + port
+		}
+		u.Host = host
+		return u.String()
+	}
+
+	if host, rest, ok := utils.SplitSchemelessURL(s); ok {
+		return CanonicalizeTarget(host) + rest
+	}
+	if host, port, err := net.SplitHostPort(s); err == nil {
+		return net.JoinHostPort(canonicalHost(host), port)
+	}
+	return canonicalHost(s)
+}
+
+// canonicalHost lowercases a host, drops its trailing dot and converts it
+// to punycode. Hosts idna rejects, such as ones with underscores, are only
+// lowercased.
+func canonicalHost(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" || net.ParseIP(host) != nil {
+		return host
+	}
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		return ascii
+	}
+	return host
+}
@@ -0,0 +1,70 @@
+package processors
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"https://example.com/", "https://example.com"},
+		{"https://example.com", "https://example.com"},
+		{"https://example.com:443/", "https://example.com"},
+		{"http://example.com:80/", "http://example.com"},
+		{"HTTPS://Example.COM/Path", "https://example.com/Path"},
+		{"https://example.com:8443/", "https://example.com:8443"},
+		{"http://example.com:443/", "http://example.com:443"},
+		{"https://example.com/admin/", "https://example.com/admin/"},
+		{"https://example.com/#top", "https://example.com"},
+		{"https://example.com/a?b=1#c", "https://example.com/a?b=1"},
+		{"https://[2001:DB8::1]:443/", "https://[2001:db8::1]"},
+		{"example.com", "example.com"},
+		{"not a url", "not a url"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeURL(tt.raw); got != tt.want {
+			t.Errorf("NormalizeURL(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestCanonicalizeTarget(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"Example.com", "example.com"},
+		{"example.com.", "example.com"},
+		{"  API.Example.COM.  ", "api.example.com"},
+		{"еxample.com", "xn--xample-2of.com"}, // Cyrillic е
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"Example.com:8443", "example.com:8443"},
+		{"https://Example.com./Path", "https://example.com/Path"},
+		{"https://еxample.com:8443/", "https://xn--xample-2of.com:8443/"},
+		{"Example.com/Admin", "example.com/Admin"},
+		{"192.0.2.1", "192.0.2.1"},
+		{"2001:DB8::1", "2001:db8::1"},
+		{"_dmarc.Example.com", "_dmarc.example.com"},
+	}
+	for _, tt := range tests {
+		if got := CanonicalizeTarget(tt.input); got != tt.want {
+			t.Errorf("CanonicalizeTarget(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestGetOrCreateTargetStoresSpellingsOnce(t *testing.T) {
+	db := newTestDB(t)
+	programID, _, err := GetOrCreateProgram(db, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, spelling := range []string{"example.com", "Example.com", "example.com.", "EXAMPLE.COM."} {
+		if _, _, err := GetOrCreateTarget(db, spelling, "manual", programID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM targets"); n != 1 {
+		t.Errorf("%d targets stored for spellings of example.com, want 1", n)
+	}
+}
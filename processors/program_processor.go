@@ -1,12 +1,35 @@
 package processors
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"regexp"
 	"strings"
+
+	"ferri/database"
+	"ferri/utils"
 )
 
+// StripPrefixes are the leading labels ExtractDomain removes from hosts
+// whose registrable domain cannot be determined, such as IPs or single
+// labels. Normal hostnames never need them: api.example.com and
+// example.com share the registrable domain example.com.
+var StripPrefixes = []string{"www.", "api.", "app.", "dev.", "test."}
+
+// GuessScope makes GetOrCreateProgram give new programs a *.domain scope
+// guessed from the target. When false they are created without a scope,
+// to be imported later.
+var GuessScope = true
+
+// CreatePrograms lets GetOrCreateProgram create the programs it does not
+// find. When false it only finds existing ones, failing with
+// ErrProgramNotFound otherwise.
+var CreatePrograms = true
+
 // ExtractDomain extracts the organization name from a domain
 func ExtractDomain(input string) string {
 	// Remove protocol and path
@@ -17,13 +40,22 @@ func ExtractDomain(input string) string {
 	}
 
 	domain := matches[2]
+	if host, _, err := net.SplitHostPort(domain); err == nil {
+		domain = host
+	}
+
+	// Base the organization on the registrable domain, so every host
+	// under example.co.uk maps to "example"
+	if net.ParseIP(domain) == nil {
+		if registrable := RegistrableDomain(domain); registrable != "" {
+			return strings.SplitN(registrable, ".", 2)[0]
+		}
+	}
 	
-	// Remove www. prefix and common subdomains
-	domain = strings.TrimPrefix(domain, "www.")
-	domain = strings.TrimPrefix(domain, "api.")
-	domain = strings.TrimPrefix(domain, "app.")
-	domain = strings.TrimPrefix(domain, "dev.")
-	domain = strings.TrimPrefix(domain, "test.")
+	// Otherwise remove common subdomain prefixes
+	for _, prefix := range StripPrefixes {
+		domain = strings.TrimPrefix(domain, prefix)
+	}
 	
 	// Extract organization name (example.com -> example)
 	parts := strings.Split(domain, ".")
@@ -34,36 +66,224 @@ func ExtractDomain(input string) string {
 	return domain
 }
 
-// GetOrCreateProgram finds or creates a program based on domain
-func GetOrCreateProgram(db *sql.DB, domain string) (int, error) {
-	orgName := ExtractDomain(domain)
+// ProgramNamer derives a program name from the host of a target
+type ProgramNamer func(domain string) string
+
+// ProgramNamers are the naming strategies SetProgramNaming accepts:
+// first-label names acme.example.co.uk's program "example",
+// registrable-domain "example.co.uk" and full-host "acme.example.co.uk"
+var ProgramNamers = map[string]ProgramNamer{
+	"first-label":        ExtractDomain,
+	"registrable-domain": programRoot,
+	"full-host":          programHost,
+}
+
+// DefaultProgramNaming is the strategy programs are named with unless
+// SetProgramNaming picks another
+const DefaultProgramNaming = "first-label"
+
+// NameProgram names the programs created for targets that are not aliased
+// to an existing one
+var NameProgram ProgramNamer = ExtractDomain
+
+// SetProgramNaming makes NameProgram the named strategy of ProgramNamers
+func SetProgramNaming(strategy string) error {
+	namer, ok := ProgramNamers[strategy]
+	if !ok {
+		return fmt.Errorf("unknown program naming %q (use first-label, registrable-domain or full-host)", strategy)
+	}
+	NameProgram = namer
+	return nil
+}
+
+// ProgramDomain extracts the host used to pick the program from a target
+func ProgramDomain(target string) string {
+	domain := target
+	if strings.Contains(target, "://") {
+		// Extract domain from URL
+		re := regexp.MustCompile(`(?i)https?://([^/]+)`)
+		if matches := re.FindStringSubmatch(target); len(matches) > 1 {
+			domain = matches[1]
+		}
+	} else if host, _, ok := utils.SplitSchemelessURL(target); ok {
+		domain = host
+	}
+	return domain
+}
+
+// ErrInvalidProgramDomain is returned when no sensible program name can be
+// derived from a target, e.g. for localhost, an IP address or empty input
+var ErrInvalidProgramDomain = errors.New("cannot derive a program from target")
+
+// ErrProgramNotFound is returned for a program that does not exist while
+// CreatePrograms is off
+var ErrProgramNotFound = errors.New("program does not exist")
+
+// ValidProgramDomain reports whether a target's host has a registrable
+// domain that a program name can be derived from
+func ValidProgramDomain(input string) bool {
+	return programRoot(input) != ""
+}
+
+// programRoot returns the registrable domain of a target's host, or "" when
+// it has none
+func programRoot(input string) string {
+	host := programHost(input)
+	if host == "" {
+		return ""
+	}
+	return RegistrableDomain(host)
+}
+
+// programHost returns the lowercase host of a target without its port, or
+// "" for IP addresses
+func programHost(input string) string {
+	re := regexp.MustCompile(`(?i)^(https?://)?([^/]+)`)
+	matches := re.FindStringSubmatch(strings.TrimSpace(input))
+	if len(matches) < 3 {
+		return ""
+	}
+
+	host := matches[2]
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "" || net.ParseIP(strings.Trim(host, "[]")) != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// ProgramNameContext returns the name of the program a target belongs to:
+// the program its root domain is an alias of, or else the name
+// NameProgram derives from it
+func ProgramNameContext(ctx context.Context, q Querier, domain string) (string, error) {
+	root := programRoot(domain)
+	if root == "" {
+		return "", fmt.Errorf("%w %q", ErrInvalidProgramDomain, domain)
+	}
+
+	var name string
+	err := q.QueryRowContext(ctx, `SELECT p.name FROM program_aliases a
+		JOIN programs p ON p.id = a.program_id WHERE a.domain = ?`, root).Scan(&name)
+	if err == nil {
+		return name, nil
+	} else if err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to look up program alias: %v", err)
+	}
+	return strings.ToLower(NameProgram(domain)), nil
+}
+
+// GetOrCreateProgram finds or creates the program of a target (a URL or
+// host), following program aliases so every root domain of an organization
+// lands in one program. It is safe to call from concurrent ingests: the
+// insert is a no-op when another process created the program first, and
+// the id is re-read afterwards. The returned bool reports whether this
+// call created the program.
+func GetOrCreateProgram(db *sql.DB, target string) (int, bool, error) {
+	return GetOrCreateProgramContext(context.Background(), db, target)
+}
+
+// GetOrCreateProgramContext is GetOrCreateProgram with cancellation support
+func GetOrCreateProgramContext(ctx context.Context, q Querier, target string) (int, bool, error) {
+	orgName, err := ProgramNameContext(ctx, q, ProgramDomain(target))
+	if err != nil {
+		return 0, false, err
+	}
+	return GetOrCreateNamedProgramContext(ctx, q, target, orgName)
+}
+
+// GetOrCreateNamedProgramContext is GetOrCreateProgramContext for a caller
+// that already looked up the program name of target with
+// ProgramNameContext, so the alias is not looked up twice
+func GetOrCreateNamedProgramContext(ctx context.Context, q Querier, target, orgName string) (int, bool, error) {
+	domain := ProgramDomain(target)
+	// The scope only applies to a program this call creates; an existing
+	// program's scope is never touched
+	var scope sql.NullString
+	if GuessScope {
+		scope = sql.NullString{String: fmt.Sprintf("*.%s", strings.TrimPrefix(domain, "www.")), Valid: true}
+	}
+	programID, created, err := GetOrCreateProgramByNameContext(ctx, q, orgName, scope)
+	if err != nil || !created {
+		return programID, created, err
+	}
+
+	// Likewise a program created from a URL gets that site as its URL
+	if programURL := ProgramURL(target); programURL != "" {
+		if _, err := q.ExecContext(ctx, "UPDATE programs SET url = ? WHERE id = ? AND url IS NULL",
+			programURL, programID); err != nil {
+			return 0, false, fmt.Errorf("failed to set program URL: %v", err)
+		}
+	}
+	return programID, true, nil
+}
+
+// ProgramURL returns the scheme and host of a URL target, such as
+// https://app.example.com for https://app.example.com/login, or "" for a
+// target that is not an http(s) URL. With GuessScheme, a URL written
+// without a scheme counts as https.
+func ProgramURL(target string) string {
+	if host, _, ok := utils.SplitSchemelessURL(target); ok && GuessScheme {
+		return "https://" + host
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return ""
+	}
+	return scheme + "://" + u.Host
+}
+
+// GetOrCreateProgramByNameContext finds or creates a program with a name,
+// ignoring case, using scope only when the program is created
+func GetOrCreateProgramByNameContext(ctx context.Context, q Querier, orgName string, scope sql.NullString) (int, bool, error) {
+	orgName = strings.TrimSpace(orgName)
+	if orgName == "" {
+		return 0, false, fmt.Errorf("program name cannot be empty")
+	}
 	
 	// Try to find existing program
 	var programID int
-	err := db.QueryRow("SELECT id FROM programs WHERE name = ?", orgName).Scan(&programID)
+	err := q.QueryRowContext(ctx, "SELECT id FROM programs WHERE name = ? COLLATE NOCASE", orgName).Scan(&programID)
 	
-	if err == sql.ErrNoRows {
-		// Program doesn't exist, create it
-		scope := fmt.Sprintf("*.%s", strings.TrimPrefix(domain, "www."))
-		result, err := db.Exec(
-			"INSERT INTO programs (name, scope) VALUES (?, ?)",
-			orgName, scope,
-		)
+	if err == sql.ErrNoRows && !CreatePrograms {
+		return 0, false, fmt.Errorf("%w: %s", ErrProgramNotFound, orgName)
+	} else if err == sql.ErrNoRows {
+		// Program doesn't exist, create it unless someone beat us to it
+		var result sql.Result
+		err := database.WithRetry(func() (err error) {
+			result, err = q.ExecContext(ctx,
+				"INSERT INTO programs (name, scope) VALUES (?, ?) ON CONFLICT DO NOTHING",
+				orgName, scope,
+			)
+			return err
+		})
 		if err != nil {
-			return 0, fmt.Errorf("failed to create program: %v", err)
+			return 0, false, fmt.Errorf("failed to create program: %v", err)
 		}
 		
-		id, err := result.LastInsertId()
+		created, err := result.RowsAffected()
 		if err != nil {
-			return 0, fmt.Errorf("failed to get program ID: %v", err)
+			return 0, false, fmt.Errorf("failed to create program: %v", err)
 		}
 		
-		fmt.Printf("✨ Created new program: %s (ID: %d)\n", orgName, id)
-		return int(id), nil
+		err = q.QueryRowContext(ctx, "SELECT id FROM programs WHERE name = ? COLLATE NOCASE", orgName).Scan(&programID)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to get program ID: %v", err)
+		}
+		
+		if created > 0 {
+			utils.Statusf("✨ Created new program: %s (ID: %d)\n", orgName, programID)
+			return programID, true, nil
+		}
 	} else if err != nil {
-		return 0, fmt.Errorf("failed to query program: %v", err)
+		return 0, false, fmt.Errorf("failed to query program: %v", err)
 	}
 	
-	fmt.Printf("🔍 Using existing program: %s (ID: %d)\n", orgName, programID)
-	return programID, nil
+	utils.Statusf("🔍 Using existing program: %s (ID: %d)\n", orgName, programID)
+	return programID, false, nil
 }
@@ -0,0 +1,68 @@
+package processors
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGetOrCreateProgramRejectsUnnamableTargets(t *testing.T) {
+	tests := []struct {
+		target  string
+		wantErr bool
+	}{
+		{"localhost", true},
+		{"127.0.0.1", true},
+		{"", true},
+		{"   ", true},
+		{"http://localhost:8080/admin", true},
+		{"[::1]:8080", true},
+		{"intranet", true},
+		{"example.com", false},
+		{"https://api.example.com/login", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			if ValidProgramDomain(tt.target) == tt.wantErr {
+				t.Errorf("ValidProgramDomain(%q) = %v", tt.target, tt.wantErr)
+			}
+			db := newTestDB(t)
+			_, _, err := GetOrCreateProgram(db, tt.target)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidProgramDomain) {
+					t.Errorf("GetOrCreateProgram(%q) error = %v, want ErrInvalidProgramDomain", tt.target, err)
+				}
+				if n := count(t, db, "SELECT COUNT(*) FROM programs"); n != 0 {
+					t.Errorf("GetOrCreateProgram(%q) created %d programs", tt.target, n)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("GetOrCreateProgram(%q): %v", tt.target, err)
+			}
+		})
+	}
+}
+
+func TestGetOrCreateProgramIgnoresCase(t *testing.T) {
+	db := newTestDB(t)
+	var ids []int
+	for _, target := range []string{"API.Example.com", "api.example.com", "https://EXAMPLE.COM/login", "example.com."} {
+		id, _, err := GetOrCreateProgram(db, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	for i, id := range ids[1:] {
+		if id != ids[0] {
+			t.Errorf("target %d landed in program %d, want %d", i+2, id, ids[0])
+		}
+	}
+	var name string
+	if err := db.QueryRow("SELECT name FROM programs").Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if name != "example" {
+		t.Errorf("program named %q, want example", name)
+	}
+}
@@ -0,0 +1,42 @@
+package processors
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Querier is the subset of *sql.DB and *sql.Tx used by the processors, so
+// the same functions work both inside and outside a transaction
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// runScoped is implemented by queriers that attribute the targets and recon
+// data they write to an ingest run, as Ingester does once SetRun is called
+type runScoped interface {
+	RunID() sql.NullInt64
+}
+
+// runOf returns the run the rows written through q belong to, or NULL
+func runOf(q Querier) sql.NullInt64 {
+	if r, ok := q.(runScoped); ok {
+		return r.RunID()
+	}
+	return sql.NullInt64{}
+}
+
+// clocked is implemented by queriers that tell the time to stamp the rows
+// written through them with, as Ingester does
+type clocked interface {
+	Now() time.Time
+}
+
+// nowOf returns the time to stamp the rows written through q with, in UTC
+func nowOf(q Querier) time.Time {
+	if c, ok := q.(clocked); ok {
+		return c.Now().UTC()
+	}
+	return time.Now().UTC()
+}
@@ -0,0 +1,91 @@
+package processors
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// TypeChange counts the targets a reclassification moved from one type to
+// another
+type TypeChange struct {
+	From  string
+	To    string
+	Count int
+}
+
+// ReclassifyResult describes what ReclassifyTargets changed
+type ReclassifyResult struct {
+	Checked int
+	Changed int
+	Changes []TypeChange
+}
+
+// ReclassifyTargets runs ClassifyTarget, the type detection of ingest, over
+// every stored target and updates the types that changed, in one
+// transaction. Target values are left as they are. With dryRun the
+// transaction is rolled back, so the result only reports what would change.
+func ReclassifyTargets(db *sql.DB, dryRun bool) (*ReclassifyResult, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin reclassify: %v", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, target, type FROM targets ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query targets: %v", err)
+	}
+	type update struct {
+		id       int
+		from, to string
+	}
+	result := &ReclassifyResult{}
+	var updates []update
+	for rows.Next() {
+		var id int
+		var target string
+		var stored sql.NullString
+		if err := rows.Scan(&id, &target, &stored); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read target: %v", err)
+		}
+		result.Checked++
+		if _, detected, _ := ClassifyTarget(target); detected != stored.String {
+			updates = append(updates, update{id, stored.String, detected})
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return nil, fmt.Errorf("failed to read targets: %v", err)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read targets: %v", err)
+	}
+
+	counts := make(map[[2]string]int)
+	for _, u := range updates {
+		if _, err := tx.Exec("UPDATE targets SET type = ? WHERE id = ?", u.to, u.id); err != nil {
+			return nil, fmt.Errorf("failed to update target %d: %v", u.id, err)
+		}
+		counts[[2]string{u.from, u.to}]++
+	}
+	result.Changed = len(updates)
+	for change, count := range counts {
+		result.Changes = append(result.Changes, TypeChange{From: change[0], To: change[1], Count: count})
+	}
+	sort.Slice(result.Changes, func(i, j int) bool {
+		a, b := result.Changes[i], result.Changes[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.From+"\x00"+a.To < b.From+"\x00"+b.To
+	})
+
+	if dryRun {
+		return result, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit reclassify: %v", err)
+	}
+	return result, nil
+}
@@ -1,19 +1,165 @@
 package processors
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"time"
+	"strings"
+	"text/template"
+
+	"ferri/database"
+)
+
+const (
+	// selectReconSQL finds the row a tool already stored for the same data
+	selectReconSQL = "SELECT id, context FROM recon_data WHERE target_id = ? AND tool = ? AND data = ? ORDER BY id LIMIT 1"
+	// insertReconSQL records one piece of recon data for a target
+	insertReconSQL = "INSERT INTO recon_data (target_id, tool, data, context, timestamp, run_id) VALUES (?, ?, ?, ?, ?, ?)"
+	// mergeReconSQL refreshes a rediscovered row
+	mergeReconSQL = "UPDATE recon_data SET context = ?, timestamp = ? WHERE id = ?"
+	// linkRunReconSQL records that a run stored or saw a recon row again
+	linkRunReconSQL = "INSERT OR IGNORE INTO run_recon_data (run_id, recon_id) VALUES (?, ?)"
 )
 
-// AddReconData adds reconnaissance data to the database
-func AddReconData(db *sql.DB, targetID int, tool, data, context string) error {
-	_, err := db.Exec(
-		"INSERT INTO recon_data (target_id, tool, data, context, timestamp) VALUES (?, ?, ?, ?, ?)",
-		targetID, tool, data, context, time.Now(),
-	)
+// ContextTemplates build the stored recon context of a tool's records from
+// the fields its parser extracted, e.g. `status={{.status_code}}
+// title={{.title}}` for httpx. Tools without one keep their parser's
+// context. The config file's context_templates fill this through
+// AddContextTemplates.
+var ContextTemplates = map[string]*template.Template{}
+
+// AddContextTemplates parses tool-to-template mappings into
+// ContextTemplates, overriding existing ones. Besides the record's fields,
+// a template can use {{.tool}}, {{.target}} and {{.context}}, the
+// parser's own context; missing fields are empty.
+func AddContextTemplates(templates map[string]string) error {
+	for tool, text := range templates {
+		tool = strings.ToLower(strings.TrimSpace(tool))
+		tmpl, err := template.New(tool).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return fmt.Errorf("context template for %s: %v", tool, err)
+		}
+		ContextTemplates[tool] = tmpl
+	}
+	return nil
+}
+
+// ReconContext returns the context stored with a record of tool: its
+// template applied to fields, or else parsed, the parser's context, or
+// else "Discovered via <tool>"
+func ReconContext(tool, target, parsed string, fields map[string]string) string {
+	if parsed == "" {
+		parsed = "Discovered via " + tool
+	}
+	tmpl, ok := ContextTemplates[strings.ToLower(tool)]
+	if !ok {
+		return parsed
+	}
+
+	data := make(map[string]string, len(fields)+3)
+	for key, value := range fields {
+		data[key] = value
+	}
+	data["tool"], data["target"], data["context"] = tool, target, parsed
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return parsed
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// AddReconData adds reconnaissance data to the database. Data a tool
+// already reported for the target is not stored again: the existing row
+// gains the new context, if it differs, and its timestamp becomes the time
+// it was last seen.
+func AddReconData(db *sql.DB, targetID int, tool, data, reconContext string) error {
+	_, err := AddReconDataContext(context.Background(), db, targetID, tool, data, reconContext)
+	return err
+}
+
+// AddReconDataContext is AddReconData with cancellation support. The
+// returned bool reports whether a new row was added rather than merged.
+func AddReconDataContext(ctx context.Context, q Querier, targetID int, tool, data, reconContext string) (bool, error) {
+	reconContext = strings.TrimSpace(contextLine(reconContext))
+	var id int
+	var stored sql.NullString
+	err := q.QueryRowContext(ctx, selectReconSQL, targetID, tool, data).Scan(&id, &stored)
+	if err == nil {
+		err := database.WithRetry(func() error {
+			_, err := q.ExecContext(ctx, mergeReconSQL,
+				MergeContext(stored.String, reconContext), nowOf(q), id,
+			)
+			return err
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed to merge recon data: %v", err)
+		}
+		return false, linkRunRecon(ctx, q, id)
+	} else if err != sql.ErrNoRows {
+		return false, fmt.Errorf("failed to look up recon data: %v", err)
+	}
+
+	var result sql.Result
+	err = database.WithRetry(func() (err error) {
+		result, err = q.ExecContext(ctx, insertReconSQL,
+			targetID, tool, data, reconContext, nowOf(q), runOf(q),
+		)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to insert recon data: %v", err)
+	}
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return false, fmt.Errorf("failed to get recon data ID: %v", err)
+	}
+	return true, linkRunRecon(ctx, q, int(newID))
+}
+
+// linkRunRecon records that the run writing through q, if any, stored or
+// saw the recon row id
+func linkRunRecon(ctx context.Context, q Querier, id int) error {
+	run := runOf(q)
+	if !run.Valid {
+		return nil
+	}
+	err := database.WithRetry(func() error {
+		_, err := q.ExecContext(ctx, linkRunReconSQL, run, id)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("failed to insert recon data: %v", err)
+		return fmt.Errorf("failed to link recon data to run: %v", err)
 	}
 	return nil
 }
+
+// contextSeparator joins the contexts merged into one recon row. Contexts
+// are stored on one line each, so it cannot appear inside one.
+const contextSeparator = "\n"
+
+// contextLine flattens a context onto one line, as a template may spread
+// it over several
+func contextLine(s string) string {
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == '\r' }), " ")
+}
+
+// MergeContext adds a context to the contexts already stored with a recon
+// row, as a list without repeats, e.g. "source=crtsh" and "source=alienvault"
+// become "source=crtsh" and "source=alienvault" on separate lines. Entries
+// are compared whole, so a context containing ", " is still found again.
+func MergeContext(stored, added string) string {
+	added = strings.TrimSpace(contextLine(added))
+	if stored == "" {
+		return added
+	}
+	if added == "" {
+		return stored
+	}
+	for _, existing := range strings.Split(stored, contextSeparator) {
+		if existing == added {
+			return stored
+		}
+	}
+	return stored + contextSeparator + added
+}
@@ -0,0 +1,72 @@
+package processors
+
+import (
+	"testing"
+)
+
+func TestMergeContext(t *testing.T) {
+	tests := []struct {
+		stored, added string
+		want          string
+	}{
+		{"", "source=crtsh", "source=crtsh"},
+		{"source=crtsh", "", "source=crtsh"},
+		{"source=crtsh", "source=crtsh", "source=crtsh"},
+		{"source=crtsh", " source=crtsh ", "source=crtsh"},
+		{"source=crtsh", "source=alienvault", "source=crtsh\nsource=alienvault"},
+		{"source=crtsh\nsource=alienvault", "source=alienvault", "source=crtsh\nsource=alienvault"},
+		{"title=Acme, Inc.", "title=Acme, Inc.", "title=Acme, Inc."},
+		{"title=Acme, Inc.", "Inc.", "title=Acme, Inc.\nInc."},
+		{"status=200", "title=Acme, Inc.", "status=200\ntitle=Acme, Inc."},
+		{"status=200\ntitle=Acme, Inc.", "title=Acme, Inc.", "status=200\ntitle=Acme, Inc."},
+		{"status=200", "title=one\ntwo", "status=200\ntitle=one two"},
+	}
+	for _, tt := range tests {
+		if got := MergeContext(tt.stored, tt.added); got != tt.want {
+			t.Errorf("MergeContext(%q, %q) = %q, want %q", tt.stored, tt.added, got, tt.want)
+		}
+	}
+}
+
+func TestAddReconDataKeepsContextsWithCommasOnce(t *testing.T) {
+	tests := []struct {
+		name     string
+		contexts []string
+		want     string
+	}{
+		{"same title every time", []string{"status=200 title=Acme, Inc.", "status=200 title=Acme, Inc.", "status=200 title=Acme, Inc."},
+			"status=200 title=Acme, Inc."},
+		{"title changes and comes back", []string{"status=200 title=Acme, Inc.", "status=302 title=Login, Acme", "status=200 title=Acme, Inc.", "status=302 title=Login, Acme"},
+			"status=200 title=Acme, Inc.\nstatus=302 title=Login, Acme"},
+		{"multi-line context", []string{"title=a\nb", "title=a b"}, "title=a b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			programID, _, err := GetOrCreateProgram(db, "a.example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			targetID, _, err := GetOrCreateTarget(db, "https://a.example.com", "httpx", programID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, reconContext := range tt.contexts {
+				if err := AddReconData(db, targetID, "httpx", "https://a.example.com", reconContext); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if n := count(t, db, "SELECT COUNT(*) FROM recon_data WHERE target_id = ?", targetID); n != 1 {
+				t.Errorf("%d recon rows, want 1", n)
+			}
+			var got string
+			if err := db.QueryRow("SELECT context FROM recon_data WHERE target_id = ?", targetID).Scan(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("context = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package processors
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"ferri/utils"
+
+	"golang.org/x/time/rate"
+)
+
+// ResolveOptions configures ResolveTargets
+type ResolveOptions struct {
+	// ProgramID limits resolution to one program; zero resolves every program
+	ProgramID int
+	// Workers is how many lookups run at once
+	Workers int
+	// Timeout bounds each lookup
+	Timeout time.Duration
+	// FreshFor skips targets that resolved more recently than this
+	FreshFor time.Duration
+	// Rate caps lookups per second across all workers; zero is unlimited
+	Rate float64
+	// Resolver performs the lookups; nil uses net.DefaultResolver
+	Resolver *net.Resolver
+	// Clock stamps the stored records and dates the freshness cutoff; nil
+	// uses the system clock
+	Clock utils.Clock
+}
+
+// Resolution is the outcome of looking up one target
+type Resolution struct {
+	TargetID int
+	Host     string
+	IPs      []net.IP
+	// Err is set when the lookup failed; NotFound tells a name that does
+	// not exist apart from a timeout or server failure
+	Err      error
+	NotFound bool
+}
+
+// ResolveSummary counts what ResolveTargets did
+type ResolveSummary struct {
+	Candidates int
+	Fresh      int
+	Resolved   int
+	NotFound   int
+	Failed     int
+}
+
+// resolveCandidatesSQL selects the domain targets to look up together with
+// whether they were looked up or stored records after the freshness
+// cutoff, so names that no longer exist count as fresh too
+const resolveCandidatesSQL = `SELECT t.id, t.target,
+	IFNULL(julianday(t.resolved_at) >= julianday(?1), 0)
+		OR EXISTS (SELECT 1 FROM dns_records d WHERE d.target_id = t.id AND julianday(d.resolved_at) >= julianday(?1))
+	FROM targets t
+	WHERE t.type IN ('domain', 'subdomain') AND instr(t.target, '*') = 0 AND (?2 = 0 OR t.program_id = ?2)
+	ORDER BY t.id`
+
+// ResolveTargets looks up the A and AAAA records of domain and subdomain
+// targets on a bounded pool of workers and stores them in dns_records,
+// replacing what the target resolved to before. Writes happen on the
+// calling goroutine, one target per transaction. onResult, if set, is
+// called after each target is stored. Canceling ctx, or failing to store a
+// result, stops handing out lookups and returns what was stored so far.
+func ResolveTargets(ctx context.Context, db *sql.DB, opts ResolveOptions, onResult func(Resolution)) (*ResolveSummary, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	resolver := opts.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	clock := opts.Clock
+	if clock == nil {
+		clock = utils.RealClock{}
+	}
+
+	cutoff := clock.Now().UTC().Add(-opts.FreshFor).Format("2006-01-02 15:04:05")
+	rows, err := db.QueryContext(ctx, resolveCandidatesSQL, cutoff, opts.ProgramID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list targets to resolve: %v", err)
+	}
+	// Collect the candidates before writing anything so the read does not
+	// hold a connection open while results are stored
+	summary := &ResolveSummary{}
+	var jobs []Resolution
+	for rows.Next() {
+		var job Resolution
+		var fresh bool
+		if err := rows.Scan(&job.TargetID, &job.Host, &fresh); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read target: %v", err)
+		}
+		summary.Candidates++
+		if fresh && opts.FreshFor > 0 {
+			summary.Fresh++
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list targets to resolve: %v", err)
+	}
+
+	pending := make(chan Resolution)
+	results := make(chan Resolution)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range pending {
+				results <- lookup(ctx, resolver, opts.Timeout, job)
+			}
+		}()
+	}
+	// One limiter paces the hand-out, so the rate holds however many
+	// workers there are
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	if opts.Rate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(opts.Rate), 1)
+	}
+	go func() {
+		defer close(pending)
+		for _, job := range jobs {
+			if err := limiter.Wait(ctx); err != nil {
+				return
+			}
+			select {
+			case pending <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var storeErr error
+	for res := range results {
+		if storeErr != nil {
+			// Keep draining so the workers can exit
+			continue
+		}
+		switch {
+		case res.Err == nil:
+			summary.Resolved++
+		case res.NotFound:
+			summary.NotFound++
+		default:
+			summary.Failed++
+		}
+		if res.Err == nil || res.NotFound {
+			if err := storeResolution(db, res, clock.Now().UTC()); err != nil {
+				// Stop the lookups; what is in flight is drained below
+				storeErr = err
+				cancel()
+				continue
+			}
+		}
+		if onResult != nil {
+			onResult(res)
+		}
+	}
+	return summary, storeErr
+}
+
+// lookup resolves one host within its own timeout
+func lookup(ctx context.Context, resolver *net.Resolver, timeout time.Duration, job Resolution) Resolution {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	addrs, err := resolver.LookupIPAddr(ctx, strings.TrimSuffix(job.Host, "."))
+	if err != nil {
+		var dnsErr *net.DNSError
+		job.Err = err
+		job.NotFound = errors.As(err, &dnsErr) && dnsErr.IsNotFound
+		return job
+	}
+	for _, addr := range addrs {
+		job.IPs = append(job.IPs, addr.IP)
+	}
+	return job
+}
+
+// storeResolution replaces a target's address records with the ones it
+// resolved to, which is none for a name that no longer exists, and marks
+// the target as checked and looked up at now
+func storeResolution(db *sql.DB, res Resolution, now time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin storing %s: %v", res.Host, err)
+	}
+	defer tx.Rollback()
+
+	// Only addresses are looked up; CNAMEs stored from dnsx stay
+	if _, err := tx.Exec("DELETE FROM dns_records WHERE target_id = ? AND type IN ('A', 'AAAA')", res.TargetID); err != nil {
+		return fmt.Errorf("failed to clear records of %s: %v", res.Host, err)
+	}
+	for _, ip := range res.IPs {
+		recordType := "AAAA"
+		if ip.To4() != nil {
+			recordType = "A"
+		}
+		if _, err := tx.Exec(`INSERT INTO dns_records (target_id, type, value, resolved_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT(target_id, type, value) DO NOTHING`, res.TargetID, recordType, ip.String(), now); err != nil {
+			return fmt.Errorf("failed to store records of %s: %v", res.Host, err)
+		}
+	}
+	if _, err := tx.Exec("UPDATE targets SET last_checked = ?1, resolved_at = ?1 WHERE id = ?2", now, res.TargetID); err != nil {
+		return fmt.Errorf("failed to update %s: %v", res.Host, err)
+	}
+	return tx.Commit()
+}
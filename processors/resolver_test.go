@@ -0,0 +1,181 @@
+package processors
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ferri/utils"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeDNS answers A queries for the names in hosts and NXDOMAIN for every
+// other name, counting the A queries it receives per name
+type fakeDNS struct {
+	hosts map[string][4]byte
+	mu    sync.Mutex
+	asked map[string]int
+}
+
+// start serves on a local UDP port until the test ends and returns a
+// resolver that sends every query there
+func (s *fakeDNS) start(t *testing.T) *net.Resolver {
+	t.Helper()
+	s.asked = make(map[string]int)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if reply, ok := s.answer(buf[:n]); ok {
+				pc.WriteTo(reply, addr)
+			}
+		}
+	}()
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", pc.LocalAddr().String())
+		},
+	}
+}
+
+func (s *fakeDNS) answer(query []byte) ([]byte, bool) {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil {
+		return nil, false
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil, false
+	}
+	name := strings.TrimSuffix(q.Name.String(), ".")
+	ip, known := s.hosts[name]
+	if q.Type == dnsmessage.TypeA {
+		s.mu.Lock()
+		s.asked[name]++
+		s.mu.Unlock()
+	}
+
+	reply := dnsmessage.Header{ID: header.ID, Response: true, Authoritative: true}
+	if !known {
+		reply.RCode = dnsmessage.RCodeNameError
+	}
+	b := dnsmessage.NewBuilder(nil, reply)
+	b.StartQuestions()
+	b.Question(q)
+	b.StartAnswers()
+	if known && q.Type == dnsmessage.TypeA {
+		b.AResource(dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+			dnsmessage.AResource{A: ip})
+	}
+	msg, err := b.Finish()
+	return msg, err == nil
+}
+
+// lookups returns how many times name was asked for
+func (s *fakeDNS) lookups(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.asked[name]
+}
+
+// resolveTargetsDB returns a database holding a subdomain target for each
+// of hosts
+func resolveTargetsDB(t *testing.T, hosts ...string) *sql.DB {
+	t.Helper()
+	db := newTestDB(t)
+	programID, _, err := GetOrCreateProgram(db, "example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range hosts {
+		if _, _, err := GetOrCreateTarget(db, host, "manual", programID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestResolveTargetsHonoursFreshnessForMissingNames(t *testing.T) {
+	server := &fakeDNS{hosts: map[string][4]byte{"a.example.test": {192, 0, 2, 1}}}
+	resolver := server.start(t)
+	db := resolveTargetsDB(t, "a.example.test", "gone.example.test")
+	clock := utils.NewFakeClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	opts := ResolveOptions{Workers: 2, Timeout: 5 * time.Second, FreshFor: time.Hour, Resolver: resolver, Clock: clock}
+
+	// example.test, stored as the parent of both, does not exist either
+	tests := []struct {
+		name    string
+		advance time.Duration
+		want    ResolveSummary
+		// wantLookups is how often gone.example.test was asked for by then
+		wantLookups int
+	}{
+		{"first run", 0, ResolveSummary{Candidates: 3, Resolved: 1, NotFound: 2}, 1},
+		{"within the window", 30 * time.Minute, ResolveSummary{Candidates: 3, Fresh: 3}, 1},
+		{"after the window", time.Hour, ResolveSummary{Candidates: 3, Resolved: 1, NotFound: 2}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.Advance(tt.advance)
+			summary, err := ResolveTargets(t.Context(), db, opts, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *summary != tt.want {
+				t.Errorf("summary = %+v, want %+v", *summary, tt.want)
+			}
+			if n := server.lookups("gone.example.test"); n != tt.wantLookups {
+				t.Errorf("gone.example.test looked up %d times, want %d", n, tt.wantLookups)
+			}
+		})
+	}
+}
+
+func TestResolveTargetsStopsOnStoreError(t *testing.T) {
+	const n = 50
+	server := &fakeDNS{hosts: make(map[string][4]byte)}
+	hosts := make([]string, n)
+	for i := range hosts {
+		hosts[i] = fmt.Sprintf("host%d.example.test", i)
+		server.hosts[hosts[i]] = [4]byte{192, 0, 2, byte(i)}
+	}
+	resolver := server.start(t)
+	db := resolveTargetsDB(t, hosts...)
+	if _, err := db.Exec(`CREATE TRIGGER fail_dns AFTER INSERT ON dns_records BEGIN
+		SELECT RAISE(FAIL, 'disk full'); END`); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := ResolveOptions{Workers: 2, Timeout: 5 * time.Second, Resolver: resolver}
+	if _, err := ResolveTargets(t.Context(), db, opts, nil); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("ResolveTargets error = %v, want the store error", err)
+	}
+	looked := 0
+	for _, host := range hosts {
+		if server.lookups(host) > 0 {
+			looked++
+		}
+	}
+	// The failing lookup, the ones in flight on the workers and the one
+	// being handed out
+	if limit := opts.Workers + 2; looked > limit {
+		t.Errorf("%d of %d hosts looked up after the first store error, want at most %d", looked, n, limit)
+	}
+}
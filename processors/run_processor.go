@@ -0,0 +1,182 @@
+package processors
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"ferri/database"
+)
+
+// StartRunContext records the start of an ingest of source by tool at now
+// and returns the run's id
+func StartRunContext(ctx context.Context, q Querier, tool, source string, now time.Time) (int, error) {
+	var result sql.Result
+	err := database.WithRetry(func() (err error) {
+		result, err = q.ExecContext(ctx, "INSERT INTO runs (started_at, tool, source) VALUES (?, ?, ?)",
+			now.UTC(), tool, source)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to record run: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to record run: %v", err)
+	}
+	return int(id), nil
+}
+
+// FinishRunContext stores the final tool, program and target count of a
+// run that finished at now. A programID of 0 leaves the program empty.
+func FinishRunContext(ctx context.Context, q Querier, runID int, tool string, programID, targetCount int, now time.Time) error {
+	program := sql.NullInt64{Int64: int64(programID), Valid: programID > 0}
+	err := database.WithRetry(func() error {
+		_, err := q.ExecContext(ctx,
+			"UPDATE runs SET finished_at = ?, tool = ?, program_id = ?, target_count = ? WHERE id = ?",
+			now.UTC(), tool, program, targetCount, runID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to finish run: %v", err)
+	}
+	return nil
+}
+
+// UndoResult counts what UndoRun removed and kept
+type UndoResult struct {
+	ReconRows int
+	Findings  int
+	Targets   int
+	// KeptTargets were created by the run but are still needed: other
+	// runs saw them, they have findings that stay, or they are the root
+	// domain of a target that stays
+	KeptTargets int
+}
+
+// orphanedRunTargets selects the targets run ?1 created that no other run
+// has seen and nothing else refers to anymore once its recon data is gone
+const orphanedRunTargets = `SELECT id FROM targets t WHERE t.run_id = ?1
+	AND NOT EXISTS (SELECT 1 FROM run_targets l WHERE l.target_id = t.id AND l.run_id != ?1)
+	AND NOT EXISTS (SELECT 1 FROM recon_data d WHERE d.target_id = t.id)
+	AND NOT EXISTS (SELECT 1 FROM findings f WHERE f.target_id = t.id)
+	AND NOT EXISTS (SELECT 1 FROM targets c WHERE c.parent_id = t.id)`
+
+// undoTargetStatements delete the orphaned targets of run ?1 along with the
+// tags, technologies, status history and DNS records stored on them
+var undoTargetStatements = []string{
+	"DELETE FROM target_tags WHERE target_id IN (" + orphanedRunTargets + ")",
+	"DELETE FROM technologies WHERE target_id IN (" + orphanedRunTargets + ")",
+	"DELETE FROM target_status_history WHERE target_id IN (" + orphanedRunTargets + ")",
+	"DELETE FROM dns_records WHERE target_id IN (" + orphanedRunTargets + ")",
+	"DELETE FROM run_targets WHERE target_id IN (" + orphanedRunTargets + ")",
+	"DELETE FROM targets WHERE id IN (" + orphanedRunTargets + ")",
+}
+
+// undoRowStatements delete the rows of table that run ?1 stored and no
+// other run has reported since, along with their links in the links table
+// keyed by column, and hand the rows seen again to the earliest run that
+// did. Recon data and findings are undone this way.
+func undoRowStatements(table, links, column string) []string {
+	return []string{
+		fmt.Sprintf(`DELETE FROM %[2]s WHERE %[3]s IN (SELECT d.id FROM %[1]s d WHERE d.run_id = ?1
+		AND NOT EXISTS (SELECT 1 FROM %[2]s l WHERE l.%[3]s = d.id AND l.run_id != ?1))`, table, links, column),
+		fmt.Sprintf(`DELETE FROM %[1]s WHERE run_id = ?1
+		AND NOT EXISTS (SELECT 1 FROM %[2]s l WHERE l.%[3]s = %[1]s.id AND l.run_id != ?1)`, table, links, column),
+		fmt.Sprintf(`UPDATE %[1]s SET run_id = (SELECT MIN(l.run_id) FROM %[2]s l
+		WHERE l.%[3]s = %[1]s.id AND l.run_id != ?1) WHERE run_id = ?1`, table, links, column),
+		fmt.Sprintf("DELETE FROM %s WHERE run_id = ?1", links),
+	}
+}
+
+// undoReconStatements and undoFindingStatements undo the recon data and the
+// findings of run ?1; the second statement of each does the deleting
+var (
+	undoReconStatements   = undoRowStatements("recon_data", "run_recon_data", "recon_id")
+	undoFindingStatements = undoRowStatements("findings", "run_findings", "finding_id")
+)
+
+// UndoRun removes what an ingest run stored, in one transaction: the recon
+// data, findings and targets it created that no other run has seen since. What later
+// runs saw again is kept and attributed to them. Targets and recon data
+// that predate the run are never touched. The run itself is deleted
+// too. With dryRun the transaction is rolled back, so the result only
+// reports what would be removed.
+func UndoRun(db *sql.DB, runID int, dryRun bool) (*UndoResult, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin undo: %v", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow("SELECT id FROM runs WHERE id = ?", runID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no run with ID %d", runID)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to look up run: %v", err)
+	}
+
+	result := &UndoResult{}
+	for _, rows := range []struct {
+		what       string
+		statements []string
+		removed    *int
+	}{
+		{"recon data", undoReconStatements, &result.ReconRows},
+		{"findings", undoFindingStatements, &result.Findings},
+	} {
+		for i, stmt := range rows.statements {
+			res, err := tx.Exec(stmt, runID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to remove %s: %v", rows.what, err)
+			}
+			if i == 1 {
+				removed, _ := res.RowsAffected()
+				*rows.removed = int(removed)
+			}
+		}
+	}
+
+	// Removing a subdomain can orphan the root domain created alongside
+	// it, so repeat until a pass removes nothing
+	for {
+		var res sql.Result
+		for _, stmt := range undoTargetStatements {
+			if res, err = tx.Exec(stmt, runID); err != nil {
+				return nil, fmt.Errorf("failed to remove targets: %v", err)
+			}
+		}
+		removed, _ := res.RowsAffected()
+		if removed == 0 {
+			break
+		}
+		result.Targets += int(removed)
+	}
+
+	// Kept targets outlive the run they came from, passing to the earliest
+	// other run that saw them, if any
+	res, err := tx.Exec(`UPDATE targets SET run_id = (SELECT MIN(l.run_id) FROM run_targets l
+		WHERE l.target_id = targets.id AND l.run_id != ?1) WHERE run_id = ?1`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detach kept targets: %v", err)
+	}
+	kept, _ := res.RowsAffected()
+	result.KeptTargets = int(kept)
+	if _, err := tx.Exec("DELETE FROM run_targets WHERE run_id = ?", runID); err != nil {
+		return nil, fmt.Errorf("failed to detach kept targets: %v", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM runs WHERE id = ?", runID); err != nil {
+		return nil, fmt.Errorf("failed to remove run: %v", err)
+	}
+
+	if dryRun {
+		return result, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit undo: %v", err)
+	}
+	return result, nil
+}
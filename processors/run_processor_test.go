@@ -0,0 +1,336 @@
+package processors
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ferri/database"
+	"ferri/models"
+)
+
+// newTestDB returns a migrated database in a temporary directory
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bounty.db")
+	if err := database.EnsureDBExists(path); err != nil {
+		t.Fatal(err)
+	}
+	db, err := database.InitDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// ingestRun stores targets as one subfinder run would and returns the run
+func ingestRun(t *testing.T, db *sql.DB, targets ...string) int {
+	t.Helper()
+	ctx := context.Background()
+	programID, _, err := GetOrCreateProgram(db, targets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	runID, err := StartRunContext(ctx, db, "subfinder", "test", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := NewIngester(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	in.SetRun(runID)
+	if err := in.Begin(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range targets {
+		targetID, _, err := in.GetOrCreateTarget(ctx, target, "subfinder", programID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := in.AddReconData(ctx, targetID, "subfinder", target, "source=crtsh"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := in.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := FinishRunContext(ctx, db, runID, "subfinder", programID, len(targets), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	return runID
+}
+
+// count runs a COUNT(*) query
+func count(t *testing.T, db *sql.DB, query string, args ...any) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestUndoRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		runs        [][]string
+		undo        int // index into runs
+		wantTargets []string
+		wantRecon   int
+	}{
+		{
+			name:        "only run",
+			runs:        [][]string{{"a.example.com"}},
+			undo:        0,
+			wantTargets: nil,
+			wantRecon:   0,
+		},
+		{
+			name:        "first run seen again by a later run",
+			runs:        [][]string{{"a.example.com"}, {"a.example.com"}},
+			undo:        0,
+			wantTargets: []string{"a.example.com", "example.com"},
+			wantRecon:   1,
+		},
+		{
+			name:        "later run that added a target",
+			runs:        [][]string{{"a.example.com"}, {"a.example.com", "b.example.com"}},
+			undo:        1,
+			wantTargets: []string{"a.example.com", "example.com"},
+			wantRecon:   1,
+		},
+		{
+			name:        "first run, later run kept its own target",
+			runs:        [][]string{{"a.example.com", "b.example.com"}, {"a.example.com"}},
+			undo:        0,
+			wantTargets: []string{"a.example.com", "example.com"},
+			wantRecon:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			var runIDs []int
+			for _, targets := range tt.runs {
+				runIDs = append(runIDs, ingestRun(t, db, targets...))
+			}
+
+			if _, err := UndoRun(db, runIDs[tt.undo], false); err != nil {
+				t.Fatalf("UndoRun: %v", err)
+			}
+
+			rows, err := db.Query("SELECT target FROM targets ORDER BY target")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			var got []string
+			for rows.Next() {
+				var target string
+				if err := rows.Scan(&target); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, target)
+			}
+			if len(got) != len(tt.wantTargets) {
+				t.Fatalf("targets = %v, want %v", got, tt.wantTargets)
+			}
+			for i := range got {
+				if got[i] != tt.wantTargets[i] {
+					t.Fatalf("targets = %v, want %v", got, tt.wantTargets)
+				}
+			}
+			if n := count(t, db, "SELECT COUNT(*) FROM recon_data"); n != tt.wantRecon {
+				t.Errorf("recon rows = %d, want %d", n, tt.wantRecon)
+			}
+			if n := count(t, db, "SELECT COUNT(*) FROM recon_data WHERE run_id = ?", runIDs[tt.undo]); n != 0 {
+				t.Errorf("%d recon rows still belong to the undone run", n)
+			}
+			if n := count(t, db, "SELECT COUNT(*) FROM run_targets WHERE run_id = ?", runIDs[tt.undo]); n != 0 {
+				t.Errorf("%d target links still belong to the undone run", n)
+			}
+		})
+	}
+}
+
+func TestUndoRunKeepsTargetsThatPredateIt(t *testing.T) {
+	db := newTestDB(t)
+	programID, _, err := GetOrCreateProgram(db, "a.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := GetOrCreateTarget(db, "a.example.com", "manual", programID); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddReconData(db, 1, "manual", "a.example.com", "added by hand"); err != nil {
+		t.Fatal(err)
+	}
+	runID := ingestRun(t, db, "a.example.com")
+
+	if _, err := UndoRun(db, runID, false); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM targets WHERE target = 'a.example.com'"); n != 1 {
+		t.Errorf("a target that predates the run was removed")
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM recon_data WHERE tool = 'manual'"); n != 1 {
+		t.Errorf("recon data that predates the run was removed")
+	}
+}
+
+// ingestFindings stores scanner findings on targets as one nuclei run
+// would and returns the run
+func ingestFindings(t *testing.T, db *sql.DB, findings ...[2]string) int {
+	t.Helper()
+	ctx := context.Background()
+	programID, _, err := GetOrCreateProgram(db, findings[0][0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	runID, err := StartRunContext(ctx, db, "nuclei", "test", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := NewIngester(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	in.SetRun(runID)
+	if err := in.Begin(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range findings {
+		targetID, _, err := in.GetOrCreateTarget(ctx, f[0], "nuclei", programID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := in.AddReconData(ctx, targetID, "nuclei", f[0]+" "+f[1], "template="+f[1]); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := in.RecordFinding(ctx, targetID, f[1], f[1], models.SeverityHigh); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := in.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := FinishRunContext(ctx, db, runID, "nuclei", programID, len(findings), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	return runID
+}
+
+func TestUndoNucleiRun(t *testing.T) {
+	tests := []struct {
+		name string
+		// subfinder, when set, is ingested first as a run of its own
+		subfinder    []string
+		runs         [][][2]string
+		undo         int // index into runs
+		wantFindings []string
+		wantTargets  []string
+	}{
+		{
+			name:        "only run",
+			runs:        [][][2]string{{{"a.example.com", "xss"}, {"b.example.com", "sqli"}}},
+			undo:        0,
+			wantTargets: nil,
+		},
+		{
+			name:         "findings on targets an earlier run found",
+			subfinder:    []string{"a.example.com"},
+			runs:         [][][2]string{{{"a.example.com", "xss"}}},
+			undo:         0,
+			wantTargets:  []string{"a.example.com", "example.com"},
+			wantFindings: nil,
+		},
+		{
+			name:         "finding reported again by a later run",
+			runs:         [][][2]string{{{"a.example.com", "xss"}}, {{"a.example.com", "xss"}}},
+			undo:         0,
+			wantTargets:  []string{"a.example.com", "example.com"},
+			wantFindings: []string{"a.example.com xss"},
+		},
+		{
+			name:         "later run that added a finding",
+			runs:         [][][2]string{{{"a.example.com", "xss"}}, {{"a.example.com", "xss"}, {"b.example.com", "sqli"}}},
+			undo:         1,
+			wantTargets:  []string{"a.example.com", "example.com"},
+			wantFindings: []string{"a.example.com xss"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			if tt.subfinder != nil {
+				ingestRun(t, db, tt.subfinder...)
+			}
+			var runIDs []int
+			for _, findings := range tt.runs {
+				runIDs = append(runIDs, ingestFindings(t, db, findings...))
+			}
+
+			result, err := UndoRun(db, runIDs[tt.undo], false)
+			if err != nil {
+				t.Fatalf("UndoRun: %v", err)
+			}
+
+			gotFindings := column(t, db, "SELECT t.target || ' ' || f.title FROM findings f JOIN targets t ON t.id = f.target_id ORDER BY 1")
+			if strings.Join(gotFindings, ", ") != strings.Join(tt.wantFindings, ", ") {
+				t.Errorf("findings = %v, want %v", gotFindings, tt.wantFindings)
+			}
+			if got := column(t, db, "SELECT target FROM targets ORDER BY target"); strings.Join(got, ", ") != strings.Join(tt.wantTargets, ", ") {
+				t.Errorf("targets = %v, want %v", got, tt.wantTargets)
+			}
+			if n := count(t, db, "SELECT COUNT(*) FROM findings WHERE run_id = ?", runIDs[tt.undo]); n != 0 {
+				t.Errorf("%d findings still belong to the undone run", n)
+			}
+			if n := count(t, db, "SELECT COUNT(*) FROM run_findings WHERE run_id = ?", runIDs[tt.undo]); n != 0 {
+				t.Errorf("%d finding links still belong to the undone run", n)
+			}
+			if stored := count(t, db, "SELECT COUNT(*) FROM findings"); result.Findings != countDistinct(tt.runs)-stored {
+				t.Errorf("UndoRun reported %d findings removed, %d of %d remain", result.Findings, stored, countDistinct(tt.runs))
+			}
+		})
+	}
+}
+
+// countDistinct counts the different findings of runs
+func countDistinct(runs [][][2]string) int {
+	seen := map[[2]string]bool{}
+	for _, findings := range runs {
+		for _, f := range findings {
+			seen[f] = true
+		}
+	}
+	return len(seen)
+}
+
+// column runs a query selecting one text column and collects it
+func column(t *testing.T, db *sql.DB, query string, args ...any) []string {
+	t.Helper()
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, v)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
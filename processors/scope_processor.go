@@ -0,0 +1,106 @@
+package processors
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Scope holds the in-scope and out-of-scope asset patterns of a program
+type Scope struct {
+	InScope    []string
+	OutOfScope []string
+}
+
+// hackerOneScope is a single structured scope as returned by HackerOne
+type hackerOneScope struct {
+	Attributes struct {
+		AssetIdentifier       string `json:"asset_identifier"`
+		AssetType             string `json:"asset_type"`
+		EligibleForSubmission *bool  `json:"eligible_for_submission"`
+	} `json:"attributes"`
+}
+
+// ParseScope reads a scope file, either a plain list of patterns prefixed
+// with "+" (in scope) or "-" (out of scope), or a JSON export of
+// HackerOne's structured scopes
+func ParseScope(data []byte) (*Scope, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return parseHackerOneScope(trimmed)
+	}
+
+	scope := &Scope{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		switch line[0] {
+		case '-':
+			if pattern := strings.TrimSpace(line[1:]); pattern != "" {
+				scope.OutOfScope = append(scope.OutOfScope, pattern)
+			}
+		case '+':
+			if pattern := strings.TrimSpace(line[1:]); pattern != "" {
+				scope.InScope = append(scope.InScope, pattern)
+			}
+		default:
+			// Unprefixed lines are treated as in scope
+			scope.InScope = append(scope.InScope, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read scope file: %v", err)
+	}
+
+	return scope, nil
+}
+
+// parseHackerOneScope accepts the structured_scopes API response
+// ({"data": [...]}), a program export with the scopes under
+// relationships.structured_scopes, or a bare array of scopes
+func parseHackerOneScope(data []byte) (*Scope, error) {
+	var entries []hackerOneScope
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse scope JSON: %v", err)
+		}
+	} else {
+		var doc struct {
+			Data          []hackerOneScope `json:"data"`
+			Relationships struct {
+				StructuredScopes struct {
+					Data []hackerOneScope `json:"data"`
+				} `json:"structured_scopes"`
+			} `json:"relationships"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse scope JSON: %v", err)
+		}
+		entries = append(doc.Data, doc.Relationships.StructuredScopes.Data...)
+	}
+
+	scope := &Scope{}
+	for _, entry := range entries {
+		identifier := strings.TrimSpace(entry.Attributes.AssetIdentifier)
+		if identifier == "" {
+			continue
+		}
+		eligible := entry.Attributes.EligibleForSubmission
+		if eligible != nil && !*eligible {
+			scope.OutOfScope = append(scope.OutOfScope, identifier)
+		} else {
+			scope.InScope = append(scope.InScope, identifier)
+		}
+	}
+
+	if len(scope.InScope) == 0 && len(scope.OutOfScope) == 0 {
+		return nil, fmt.Errorf("no structured scopes found in JSON")
+	}
+	return scope, nil
+}
@@ -0,0 +1,161 @@
+package processors
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// ProgramStats summarizes how much a program holds
+type ProgramStats struct {
+	Targets   int
+	Alive     int
+	ReconRows int
+	Findings  int
+}
+
+// GetProgramStats counts the targets, recon rows and findings of a program
+func GetProgramStats(db *sql.DB, programID int) (*ProgramStats, error) {
+	stats := &ProgramStats{}
+	err := db.QueryRow(`SELECT
+		(SELECT COUNT(*) FROM targets WHERE program_id = ?1),
+		(SELECT COUNT(*) FROM targets WHERE program_id = ?1 AND alive = 1),
+		(SELECT COUNT(*) FROM recon_data r JOIN targets t ON t.id = r.target_id WHERE t.program_id = ?1),
+		(SELECT COUNT(*) FROM findings f JOIN targets t ON t.id = f.target_id WHERE t.program_id = ?1)`,
+		programID,
+	).Scan(&stats.Targets, &stats.Alive, &stats.ReconRows, &stats.Findings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count program data: %v", err)
+	}
+	return stats, nil
+}
+
+// ReconVolumeByTool counts a program's recon rows per tool
+func ReconVolumeByTool(db *sql.DB, programID int) (map[string]int, error) {
+	rows, err := db.Query(`SELECT r.tool, COUNT(*) FROM recon_data r
+		JOIN targets t ON t.id = r.target_id
+		WHERE t.program_id = ?
+		GROUP BY r.tool`, programID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count recon data: %v", err)
+	}
+	defer rows.Close()
+
+	volume := make(map[string]int)
+	for rows.Next() {
+		var tool string
+		var count int
+		if err := rows.Scan(&tool, &count); err != nil {
+			return nil, fmt.Errorf("failed to read recon volume: %v", err)
+		}
+		volume[tool] = count
+	}
+	return volume, rows.Err()
+}
+
+// StatusCodeHistogram counts a program's targets per HTTP status they last
+// answered with; targets never probed are left out
+func StatusCodeHistogram(db *sql.DB, programID int) (map[int]int, error) {
+	rows, err := db.Query(`SELECT status_code, COUNT(*) FROM targets
+		WHERE program_id = ? AND status_code IS NOT NULL
+		GROUP BY status_code`, programID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count status codes: %v", err)
+	}
+	defer rows.Close()
+
+	histogram := make(map[int]int)
+	for rows.Next() {
+		var code, count int
+		if err := rows.Scan(&code, &count); err != nil {
+			return nil, fmt.Errorf("failed to read status codes: %v", err)
+		}
+		histogram[code] = count
+	}
+	return histogram, rows.Err()
+}
+
+// GetCachedProgramStats reads a program's counts from the stats cache the
+// database keeps current as rows are written, without scanning the tables
+// GetProgramStats counts
+func GetCachedProgramStats(db *sql.DB, programID int) (*ProgramStats, error) {
+	stats := &ProgramStats{}
+	err := db.QueryRow("SELECT targets, alive, recon_rows, findings FROM stats_cache WHERE program_id = ?",
+		programID).Scan(&stats.Targets, &stats.Alive, &stats.ReconRows, &stats.Findings)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to read cached stats: %v", err)
+	}
+	return stats, nil
+}
+
+// CachedReconVolumeByTool reads a program's recon rows per tool from the
+// stats cache
+func CachedReconVolumeByTool(db *sql.DB, programID int) (map[string]int, error) {
+	rows, err := db.Query("SELECT tool, recon_rows FROM stats_cache_tools WHERE program_id = ? AND recon_rows > 0", programID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached recon volume: %v", err)
+	}
+	defer rows.Close()
+
+	volume := make(map[string]int)
+	for rows.Next() {
+		var tool string
+		var count int
+		if err := rows.Scan(&tool, &count); err != nil {
+			return nil, fmt.Errorf("failed to read recon volume: %v", err)
+		}
+		volume[tool] = count
+	}
+	return volume, rows.Err()
+}
+
+// Totals are database-wide counts, as ferri metrics reports them
+type Totals struct {
+	Programs int
+	Targets  int
+	Alive    int
+	// FindingsBySeverity and ReconRowsByTool leave out zero counts
+	FindingsBySeverity map[string]int
+	ReconRowsByTool    map[string]int
+}
+
+// GetTotals counts programs, targets, findings per severity and recon rows
+// per tool across every program, reading the stats cache where it can
+func GetTotals(db *sql.DB) (*Totals, error) {
+	totals := &Totals{FindingsBySeverity: make(map[string]int), ReconRowsByTool: make(map[string]int)}
+	err := db.QueryRow(`SELECT
+		(SELECT COUNT(*) FROM programs),
+		(SELECT IFNULL(SUM(targets), 0) FROM stats_cache),
+		(SELECT IFNULL(SUM(alive), 0) FROM stats_cache)`,
+	).Scan(&totals.Programs, &totals.Targets, &totals.Alive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count totals: %v", err)
+	}
+
+	for _, count := range []struct {
+		query string
+		into  map[string]int
+	}{
+		{"SELECT severity, COUNT(*) FROM findings GROUP BY severity", totals.FindingsBySeverity},
+		{"SELECT tool, SUM(recon_rows) FROM stats_cache_tools GROUP BY tool HAVING SUM(recon_rows) > 0", totals.ReconRowsByTool},
+	} {
+		rows, err := db.Query(count.query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count totals: %v", err)
+		}
+		for rows.Next() {
+			var key sql.NullString
+			var n int
+			if err := rows.Scan(&key, &n); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to read totals: %v", err)
+			}
+			count.into[key.String] += n
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read totals: %v", err)
+		}
+	}
+	return totals, nil
+}
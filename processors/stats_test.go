@@ -0,0 +1,113 @@
+package processors
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"ferri/models"
+)
+
+// checkStatsCache fails when the cached stats of any program differ from
+// counting its rows
+func checkStatsCache(t *testing.T, db *sql.DB) {
+	t.Helper()
+	programs, err := models.NewProgramRepository(db).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range programs {
+		live, err := GetProgramStats(db, p.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cached, err := GetCachedProgramStats(db, p.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *cached != *live {
+			t.Errorf("program %s: cached stats %+v, counted %+v", p.Name, *cached, *live)
+		}
+
+		liveTools, err := ReconVolumeByTool(db, p.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cachedTools, err := CachedReconVolumeByTool(db, p.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(cachedTools, liveTools) {
+			t.Errorf("program %s: cached recon rows per tool %v, counted %v", p.Name, cachedTools, liveTools)
+		}
+	}
+}
+
+func TestStatsCacheFollowsChanges(t *testing.T) {
+	db := newTestDB(t)
+	steps := []struct {
+		name string
+		run  func(t *testing.T)
+	}{
+		{"ingest", func(t *testing.T) {
+			ingestRun(t, db, "a.example.com", "b.example.com")
+			ingestFindings(t, db, [2]string{"a.example.com", "xss"}, [2]string{"b.example.com", "sqli"})
+		}},
+		{"undo", func(t *testing.T) {
+			runID := ingestFindings(t, db, [2]string{"a.example.com", "xss"}, [2]string{"c.example.com", "lfi"})
+			if _, err := UndoRun(db, runID, false); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"dedup --merge", func(t *testing.T) {
+			res, err := db.Exec("INSERT INTO programs (name) VALUES ('example-old')")
+			if err != nil {
+				t.Fatal(err)
+			}
+			oldID, _ := res.LastInsertId()
+			for _, target := range []string{"a.example.com", "b.example.com"} {
+				targetID, _, err := GetOrCreateTarget(db, target, "manual", int(oldID))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := AddReconData(db, targetID, "httpx", "https://"+target, ""); err != nil {
+					t.Fatal(err)
+				}
+				if _, _, err := RecordFindingContext(context.Background(), db, targetID, "xss", "xss", models.SeverityLow); err != nil {
+					t.Fatal(err)
+				}
+			}
+			checkStatsCache(t, db)
+
+			dups, err := FindCrossProgramDuplicates(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := MergeDuplicates(db, dups, 1); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"prune", func(t *testing.T) {
+			if _, err := models.NewReconDataRepository(db).PruneOlderThan(time.Now().Add(time.Hour), models.PruneFilter{Tool: "subfinder"}); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"delete a target with data", func(t *testing.T) {
+			target, err := models.NewTargetRepository(db).GetByProgramAndTarget(1, "a.example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := models.NewTargetRepository(db).Delete(target.ID); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			step.run(t)
+			checkStatsCache(t, db)
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package processors
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"ferri/models"
+)
+
+// TakeoverTitle is the title of the findings CheckTakeover leads to
+const TakeoverTitle = "Potential subdomain takeover"
+
+// TakeoverFingerprint marks CNAME targets matching Pattern as belonging to
+// Service, a hosting service whose unclaimed names anyone can register
+type TakeoverFingerprint struct {
+	Service string
+	Pattern *regexp.Regexp
+}
+
+// TakeoverFingerprints are tried in order by CheckTakeover. The config
+// file's takeover_fingerprints add to them through AddTakeoverFingerprint.
+var TakeoverFingerprints = []TakeoverFingerprint{
+	{"github-pages", regexp.MustCompile(`\.github\.io$`)},
+	{"aws-s3", regexp.MustCompile(`\.s3([.-][a-z0-9-]+)*\.amazonaws\.com$`)},
+	{"aws-elastic-beanstalk", regexp.MustCompile(`\.elasticbeanstalk\.com$`)},
+	{"heroku", regexp.MustCompile(`\.(herokuapp|herokudns|herokussl)\.com$`)},
+	{"azure", regexp.MustCompile(`\.(azurewebsites|cloudapp|trafficmanager|azureedge|azurefd)\.net$|\.blob\.core\.windows\.net$`)},
+	{"shopify", regexp.MustCompile(`\.myshopify\.com$`)},
+	{"fastly", regexp.MustCompile(`\.fastly\.net$`)},
+	{"netlify", regexp.MustCompile(`\.netlify\.(app|com)$`)},
+	{"surge", regexp.MustCompile(`\.surge\.sh$`)},
+	{"bitbucket", regexp.MustCompile(`\.bitbucket\.io$`)},
+	{"ghost", regexp.MustCompile(`\.ghost\.io$`)},
+	{"pantheon", regexp.MustCompile(`\.pantheonsite\.io$`)},
+	{"readme", regexp.MustCompile(`\.readme\.io$`)},
+	{"webflow", regexp.MustCompile(`\.webflow\.io$`)},
+	{"zendesk", regexp.MustCompile(`\.zendesk\.com$`)},
+	{"unbounce", regexp.MustCompile(`\.unbouncepages\.com$`)},
+	{"wordpress", regexp.MustCompile(`\.wordpress\.com$`)},
+}
+
+// AddTakeoverFingerprint appends a fingerprint marking CNAME targets that
+// match pattern as belonging to service
+func AddTakeoverFingerprint(service, pattern string) error {
+	service = strings.TrimSpace(service)
+	if service == "" {
+		return fmt.Errorf("takeover fingerprint %q has no service", pattern)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("takeover fingerprint for %s: %v", service, err)
+	}
+	TakeoverFingerprints = append(TakeoverFingerprints, TakeoverFingerprint{Service: service, Pattern: re})
+	return nil
+}
+
+// RcodeNXDOMAIN is the DNS response code of a name that does not exist
+const RcodeNXDOMAIN = "NXDOMAIN"
+
+// CheckTakeover reports whether the DNS answer for target points it at a
+// dangling name on a service known for takeovers, and which service. A
+// CNAME to such a service only counts while the chain is dangling: the
+// lookup failed with NXDOMAIN, or the answer ends without any A or AAAA
+// record. rcode is the lookup's response code, or "" when the tool did not
+// report one. CNAMEs within target's own registrable domain are not
+// flagged, as claiming those takes control of the domain already.
+func CheckTakeover(target string, records []models.DNSRecord, rcode string) (string, bool) {
+	if !strings.EqualFold(strings.TrimSpace(rcode), RcodeNXDOMAIN) {
+		for _, r := range records {
+			if r.Type == models.DNSRecordA || r.Type == models.DNSRecordAAAA {
+				return "", false
+			}
+		}
+	}
+	for _, r := range records {
+		if r.Type != models.DNSRecordCNAME {
+			continue
+		}
+		if service, ok := takeoverService(target, r.Value); ok {
+			return service, true
+		}
+	}
+	return "", false
+}
+
+// takeoverService reports whether target's CNAME cname names one of the
+// services of TakeoverFingerprints, and which one
+func takeoverService(target, cname string) (string, bool) {
+	cname = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(cname)), ".")
+	if cname == "" {
+		return "", false
+	}
+	host := target
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		host = u.Hostname()
+	}
+	if domain := RegistrableDomain(host); domain != "" && domain == RegistrableDomain(cname) {
+		return "", false
+	}
+	for _, fp := range TakeoverFingerprints {
+		if fp.Pattern.MatchString(cname) {
+			return fp.Service, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,43 @@
+package processors
+
+import (
+	"testing"
+
+	"ferri/models"
+)
+
+func TestCheckTakeover(t *testing.T) {
+	cname := func(value string) models.DNSRecord {
+		return models.DNSRecord{Type: models.DNSRecordCNAME, Value: value}
+	}
+	a := models.DNSRecord{Type: models.DNSRecordA, Value: "192.0.2.1"}
+	aaaa := models.DNSRecord{Type: models.DNSRecordAAAA, Value: "2001:db8::1"}
+	tests := []struct {
+		name        string
+		target      string
+		records     []models.DNSRecord
+		rcode       string
+		wantService string
+	}{
+		{"NXDOMAIN chain", "docs.example.com", []models.DNSRecord{cname("example.github.io")}, "NXDOMAIN", "github-pages"},
+		{"NXDOMAIN in lower case", "docs.example.com", []models.DNSRecord{cname("example.github.io.")}, "nxdomain", "github-pages"},
+		{"NXDOMAIN wins over stale addresses", "docs.example.com", []models.DNSRecord{cname("example.github.io"), a}, "NXDOMAIN", "github-pages"},
+		{"chain without addresses", "cdn.example.com", []models.DNSRecord{cname("example.azureedge.net")}, "", "azure"},
+		{"chain without addresses under NOERROR", "cdn.example.com", []models.DNSRecord{cname("example.azureedge.net")}, "NOERROR", "azure"},
+		{"later hop of a chain", "shop.example.com", []models.DNSRecord{cname("shop.example.net"), cname("example.myshopify.com")}, "NXDOMAIN", "shopify"},
+		{"URL target", "https://docs.example.com/", []models.DNSRecord{cname("example.github.io")}, "NXDOMAIN", "github-pages"},
+		{"healthy CDN customer", "www.example.com", []models.DNSRecord{cname("example.map.fastly.net"), a}, "NOERROR", ""},
+		{"healthy SaaS customer over IPv6", "help.example.com", []models.DNSRecord{cname("example.zendesk.com"), aaaa}, "", ""},
+		{"healthy blog", "blog.example.com", []models.DNSRecord{cname("example.wordpress.com"), a}, "", ""},
+		{"unknown service", "a.example.com", []models.DNSRecord{cname("a.example.net")}, "NXDOMAIN", ""},
+		{"no CNAME", "a.example.com", nil, "NXDOMAIN", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, ok := CheckTakeover(tt.target, tt.records, tt.rcode)
+			if service != tt.wantService || ok != (tt.wantService != "") {
+				t.Errorf("CheckTakeover = %q, %v; want %q", service, ok, tt.wantService)
+			}
+		})
+	}
+}
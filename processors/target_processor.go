@@ -1,54 +1,218 @@
 package processors
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
-	"time"
+
+	"ferri/database"
+	"ferri/models"
+	"ferri/utils"
+)
+
+// Statements behind target get-or-create, shared with Ingester so it can
+// prepare them once
+const (
+	selectTargetSQL = "SELECT id, parent_id FROM targets WHERE target = ? AND port = ? AND program_id = ?"
+	insertTargetSQL = `INSERT INTO targets (program_id, target, port, type, source, last_checked, parent_id, run_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT(program_id, target, port) DO NOTHING`
+	linkParentSQL       = "UPDATE targets SET parent_id = ? WHERE id = ?"
+	selectBodyHashSQL   = "SELECT body_hash FROM targets WHERE id = ?"
+	updateBodyHashSQL   = "UPDATE targets SET body_hash = ?, changed = ? WHERE id = ?"
+	updateStatusCodeSQL = "UPDATE targets SET status_code = ? WHERE id = ?"
+	linkRunTargetSQL    = "INSERT OR IGNORE INTO run_targets (run_id, target_id) VALUES (?, ?)"
 )
 
-// GetOrCreateTarget checks if a target exists and creates it if not
-func GetOrCreateTarget(db *sql.DB, targetURL, toolName string, programID int) (int, error) {
-	// Determine target type
-	targetType := "url"
-	switch {
-	case strings.Count(targetURL, ".") == 1 && !strings.Contains(targetURL, "/") && !strings.Contains(targetURL, ":"):
-		targetType = "domain"
-	case strings.Count(targetURL, ".") > 1 && !strings.Contains(targetURL, "/") && !strings.Contains(targetURL, ":"):
-		targetType = "subdomain"
-	case strings.Contains(targetURL, "://"):
-		targetType = "url"
-	case strings.Contains(targetURL, ":"):
-		targetType = "ip_port"
-	default:
-		targetType = "unknown"
+// GuessScheme makes ClassifyTarget store URLs written without a scheme, such
+// as example.com/admin, as https URLs. When false they are stored as given,
+// still typed as urls.
+var GuessScheme = true
+
+// ClassificationRule gives targets matching Pattern the type Type, for
+// assets the built-in classification does not know, such as S3 buckets or
+// mobile app IDs
+type ClassificationRule struct {
+	Pattern *regexp.Regexp
+	Type    string
+}
+
+// ClassificationRules are tried in order by ClassifyTarget before its
+// built-in rules. The config file's target_types fill them through
+// AddClassificationRule.
+var ClassificationRules []ClassificationRule
+
+// AddClassificationRule appends a rule typing targets that match pattern
+// as targetType, which may be any name
+func AddClassificationRule(pattern, targetType string) error {
+	targetType = strings.TrimSpace(targetType)
+	if targetType == "" {
+		return fmt.Errorf("target type rule %q has no type", pattern)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("target type rule for %s: %v", targetType, err)
+	}
+	ClassificationRules = append(ClassificationRules, ClassificationRule{Pattern: re, Type: targetType})
+	return nil
+}
+
+// GetOrCreateTarget checks if a target exists and creates it if not. The
+// returned bool reports whether this call created the target.
+func GetOrCreateTarget(db *sql.DB, targetURL, toolName string, programID int) (int, bool, error) {
+	return GetOrCreateTargetContext(context.Background(), db, targetURL, toolName, programID)
+}
+
+// GetOrCreateTargetContext is GetOrCreateTarget with cancellation support
+func GetOrCreateTargetContext(ctx context.Context, q Querier, targetURL, toolName string, programID int) (int, bool, error) {
+	targetURL, targetType, port := ClassifyTarget(targetURL)
+
+	// Link subdomains to their root domain, creating the root if needed
+	var parentID sql.NullInt64
+	if targetType == "subdomain" {
+		if apex := RegistrableDomain(targetURL); apex != "" && apex != strings.ToLower(targetURL) {
+			id, _, err := GetOrCreateTargetContext(ctx, q, apex, toolName, programID)
+			if err != nil {
+				return 0, false, fmt.Errorf("failed to create root domain %s: %v", apex, err)
+			}
+			parentID = sql.NullInt64{Int64: int64(id), Valid: true}
+		}
 	}
 
 	// Check if target already exists
 	var targetID int
-	err := db.QueryRow(
-		"SELECT id FROM targets WHERE target = ? AND program_id = ?",
-		targetURL, programID,
-	).Scan(&targetID)
+	var existingParent sql.NullInt64
+	created := false
+	err := q.QueryRowContext(ctx, selectTargetSQL, targetURL, port, programID).Scan(&targetID, &existingParent)
 
 	if err == sql.ErrNoRows {
-		// Target doesn't exist, create it
-		result, err := db.Exec(
-			"INSERT INTO targets (program_id, target, type, source, last_checked) VALUES (?, ?, ?, ?, ?)",
-			programID, targetURL, targetType, toolName, time.Now(),
-		)
+		// Target doesn't exist, create it; a concurrent ingest may have
+		// inserted it in the meantime, so ignore the conflict and re-read
+		var result sql.Result
+		err := database.WithRetry(func() (err error) {
+			result, err = q.ExecContext(ctx, insertTargetSQL,
+				programID, targetURL, port, targetType, toolName, nowOf(q), parentID, runOf(q),
+			)
+			return err
+		})
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to create target: %v", err)
+		}
+		inserted, err := result.RowsAffected()
 		if err != nil {
-			return 0, fmt.Errorf("failed to create target: %v", err)
+			return 0, false, fmt.Errorf("failed to create target: %v", err)
 		}
+		created = inserted > 0
 
-		id, err := result.LastInsertId()
+		err = q.QueryRowContext(ctx, selectTargetSQL, targetURL, port, programID).Scan(&targetID, &existingParent)
 		if err != nil {
-			return 0, fmt.Errorf("failed to get target ID: %v", err)
+			return 0, false, fmt.Errorf("failed to get target ID: %v", err)
 		}
-		return int(id), nil
 	} else if err != nil {
-		return 0, fmt.Errorf("failed to query target: %v", err)
+		return 0, false, fmt.Errorf("failed to query target: %v", err)
+	}
+
+	// Backfill the link for targets stored before parents were tracked
+	if parentID.Valid && !existingParent.Valid {
+		err := database.WithRetry(func() error {
+			_, err := q.ExecContext(ctx, linkParentSQL, parentID, targetID)
+			return err
+		})
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to link target to root domain: %v", err)
+		}
+	}
+
+	// Every run that sees the target is recorded, so undoing one of them
+	// keeps what the others saw
+	if run := runOf(q); run.Valid {
+		err := database.WithRetry(func() error {
+			_, err := q.ExecContext(ctx, linkRunTargetSQL, run, targetID)
+			return err
+		})
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to link target to run: %v", err)
+		}
+	}
+
+	return targetID, created, nil
+}
+
+// UpdateBodyHashContext stores the latest response body hash of a target and
+// reports whether it differs from the previous one, flagging the target as
+// changed. A target seen for the first time has nothing to differ from, and
+// a scan with the same hash clears the flag.
+func UpdateBodyHashContext(ctx context.Context, q Querier, targetID int, hash string) (bool, error) {
+	var previous sql.NullString
+	if err := q.QueryRowContext(ctx, selectBodyHashSQL, targetID).Scan(&previous); err != nil {
+		return false, fmt.Errorf("failed to read body hash: %v", err)
+	}
+	changed := previous.Valid && previous.String != hash
+	err := database.WithRetry(func() error {
+		_, err := q.ExecContext(ctx, updateBodyHashSQL, hash, changed, targetID)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to store body hash: %v", err)
+	}
+	return changed, nil
+}
+
+// UpdateStatusCodeContext stores the HTTP status a target last answered with
+func UpdateStatusCodeContext(ctx context.Context, q Querier, targetID, code int) error {
+	err := database.WithRetry(func() error {
+		_, err := q.ExecContext(ctx, updateStatusCodeSQL, code, targetID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store status code: %v", err)
 	}
+	return nil
+}
+
+// MarkAliveContext stores whether a target responded when it was last
+// checked, adding to its status history when the status changed; see
+// models.MarkAlive. It reports whether the status changed.
+func MarkAliveContext(ctx context.Context, q Querier, targetID int, alive bool) (bool, error) {
+	return models.MarkAlive(ctx, q, targetID, alive, nowOf(q))
+}
 
-	return targetID, nil
+// ClassifyTarget returns the value, type and port a target is stored with.
+// Ports are kept apart from bare hosts so services can be queried by port.
+// A target matching one of ClassificationRules is stored as it is, with the
+// rule's type and no port.
+func ClassifyTarget(target string) (string, string, int) {
+	target = CanonicalizeTarget(target)
+	for _, rule := range ClassificationRules {
+		if rule.Pattern.MatchString(target) {
+			return target, rule.Type, 0
+		}
+	}
+	if host, _, ok := utils.SplitSchemelessURL(target); ok {
+		if !GuessScheme {
+			_, port := utils.SplitPort(host)
+			return target, "url", port
+		}
+		target = "https://" + target
+	}
+	if strings.Contains(target, "://") {
+		// Store equivalent URLs once, e.g. https://example.com:443/ and https://example.com
+		target = NormalizeURL(target)
+		return target, "url", urlPort(target)
+	}
+	host, port := utils.SplitPort(target)
+	return host, utils.ClassifyHost(host), port
+}
+
+// urlPort returns the explicit port of a URL, or 0 when it has none
+func urlPort(rawURL string) int {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0
+	}
+	port, _ := strconv.Atoi(u.Port())
+	return port
 }
@@ -0,0 +1,149 @@
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"ferri/models"
+	"ferri/utils"
+)
+
+func TestClassifyTarget(t *testing.T) {
+	tests := []struct {
+		input     string
+		wantValue string
+		wantType  string
+		wantPort  int
+	}{
+		{"example.com", "example.com", "domain", 0},
+		{"api.example.com", "api.example.com", "subdomain", 0},
+		{"a.b.example.co.uk", "a.b.example.co.uk", "subdomain", 0},
+		{"192.0.2.1", "192.0.2.1", "ip", 0},
+		{"2001:db8::1", "2001:db8::1", "ip", 0},
+		{"api.example.com:8443", "api.example.com", "subdomain", 8443},
+		{"192.0.2.1:8080", "192.0.2.1", "ip", 8080},
+		{"[2001:db8::1]:8080", "2001:db8::1", "ip", 8080},
+		{"https://example.com/", "https://example.com", "url", 0},
+		{"http://example.com:8080/admin", "http://example.com:8080/admin", "url", 8080},
+		{"localhost", "localhost", "unknown", 0},
+	}
+	for _, tt := range tests {
+		value, targetType, port := ClassifyTarget(tt.input)
+		if value != tt.wantValue || targetType != tt.wantType || port != tt.wantPort {
+			t.Errorf("ClassifyTarget(%q) = %q, %q, %d; want %q, %q, %d", tt.input,
+				value, targetType, port, tt.wantValue, tt.wantType, tt.wantPort)
+		}
+	}
+}
+
+func TestGetOrCreateTargetStoresURLSpellingsOnce(t *testing.T) {
+	db := newTestDB(t)
+	programID, _, err := GetOrCreateProgram(db, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, spelling := range []string{"https://example.com/", "https://example.com", "https://example.com:443/", "HTTPS://EXAMPLE.com#x"} {
+		id, _, err := GetOrCreateTarget(db, spelling, "manual", programID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	for i, id := range ids[1:] {
+		if id != ids[0] {
+			t.Errorf("spelling %d stored as target %d, want %d", i+2, id, ids[0])
+		}
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM targets WHERE type = 'url'"); n != 1 {
+		t.Errorf("%d url targets stored, want 1", n)
+	}
+}
+
+func TestClassifySchemelessURL(t *testing.T) {
+	tests := []struct {
+		input       string
+		guessScheme bool
+		wantValue   string
+		wantType    string
+		wantPort    int
+	}{
+		{"example.com/path", true, "https://example.com/path", "url", 0},
+		{"sub.example.com/a/b?x=1", true, "https://sub.example.com/a/b?x=1", "url", 0},
+		{"Example.COM/Admin", true, "https://example.com/Admin", "url", 0},
+		{"example.com:8443/admin", true, "https://example.com:8443/admin", "url", 8443},
+		{"192.0.2.1/login", true, "https://192.0.2.1/login", "url", 0},
+		{"example.com/path", false, "example.com/path", "url", 0},
+		{"sub.example.com/a/b?x=1", false, "sub.example.com/a/b?x=1", "url", 0},
+		{"example.com:8443/admin", false, "example.com:8443/admin", "url", 8443},
+		{"192.0.2.0/24", true, "192.0.2.0/24", "unknown", 0}, // CIDR ranges are not URLs
+	}
+	defer func(guess bool) { GuessScheme = guess }(GuessScheme)
+	for _, tt := range tests {
+		GuessScheme = tt.guessScheme
+		value, targetType, port := ClassifyTarget(tt.input)
+		if value != tt.wantValue || targetType != tt.wantType || port != tt.wantPort {
+			t.Errorf("ClassifyTarget(%q) with GuessScheme=%v = %q, %q, %d; want %q, %q, %d", tt.input, tt.guessScheme,
+				value, targetType, port, tt.wantValue, tt.wantType, tt.wantPort)
+		}
+	}
+}
+
+func TestStoredTimesAreUTC(t *testing.T) {
+	tests := []struct {
+		name string
+		zone *time.Location
+	}{
+		{"UTC", time.UTC},
+		{"ahead of UTC", time.FixedZone("IST", 5*3600+1800)},
+		{"behind UTC", time.FixedZone("PDT", -7*3600)},
+	}
+	defer func(local *time.Location) { time.Local = local }(time.Local)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			time.Local = tt.zone
+			now := time.Date(2024, 3, 1, 23, 30, 0, 0, tt.zone)
+			db := newTestDB(t)
+
+			programID, _, err := GetOrCreateProgram(db, "example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			in, err := NewIngester(t.Context(), db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer in.Close()
+			in.SetClock(utils.NewFakeClock(now))
+			targetID, _, err := in.GetOrCreateTarget(t.Context(), "a.example.com", "manual", programID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := in.AddReconData(t.Context(), targetID, "manual", "a.example.com", ""); err != nil {
+				t.Fatal(err)
+			}
+
+			target, err := models.NewTargetRepository(db).GetByID(targetID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			recon, err := models.NewReconDataRepository(db).GetByTargetID(targetID)
+			if err != nil || len(recon) != 1 {
+				t.Fatalf("recon data = %v, %v", recon, err)
+			}
+			times := map[string]time.Time{
+				"target last_checked": target.LastChecked.Time,
+				"target created_at":   target.CreatedAt,
+				"recon timestamp":     recon[0].Timestamp,
+			}
+			for name, got := range times {
+				if got.Location() != time.UTC {
+					t.Errorf("%s read back in %v, want UTC", name, got.Location())
+				}
+			}
+			if !target.LastChecked.Time.Equal(now) {
+				t.Errorf("last_checked = %v, want %v", target.LastChecked.Time, now.UTC())
+			}
+		})
+	}
+}
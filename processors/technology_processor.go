@@ -0,0 +1,29 @@
+package processors
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"ferri/database"
+)
+
+// insertTechnologySQL records a technology on a target once, keeping the
+// last version detected
+const insertTechnologySQL = `INSERT INTO technologies (target_id, name, version) VALUES (?, ?, ?)
+	ON CONFLICT(target_id, name) DO UPDATE SET version = COALESCE(excluded.version, version)`
+
+// AddTechnologyContext records that a target runs a technology. Detecting it
+// again only updates the version, and an empty version keeps the stored one.
+func AddTechnologyContext(ctx context.Context, q Querier, targetID int, name, version string) error {
+	err := database.WithRetry(func() error {
+		_, err := q.ExecContext(ctx, insertTechnologySQL,
+			targetID, name, sql.NullString{String: version, Valid: version != ""},
+		)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store technology %s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+// Package server exposes ferri's data as a read-only JSON API for
+// dashboards and other tooling.
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"ferri/models"
+)
+
+const (
+	// defaultLimit is the page size when a request gives no limit
+	defaultLimit = 100
+	// maxLimit bounds the page size a request may ask for
+	maxLimit = 1000
+)
+
+// Server answers API requests from the repositories
+type Server struct {
+	programs *models.ProgramRepository
+	targets  *models.TargetRepository
+	recon    *models.ReconDataRepository
+	findings *models.FindingRepository
+	mux      *http.ServeMux
+}
+
+// New returns a server reading from db
+func New(db *sql.DB) *Server {
+	s := &Server{
+		programs: models.NewProgramRepository(db),
+		targets:  models.NewTargetRepository(db),
+		recon:    models.NewReconDataRepository(db),
+		findings: models.NewFindingRepository(db),
+		mux:      http.NewServeMux(),
+	}
+	s.mux.HandleFunc("GET /programs", s.listPrograms)
+	s.mux.HandleFunc("GET /programs/{id}", s.getProgram)
+	s.mux.HandleFunc("GET /programs/{id}/targets", s.listTargets)
+	s.mux.HandleFunc("GET /targets/{id}", s.getTarget)
+	s.mux.HandleFunc("GET /targets/{id}/recon", s.listRecon)
+	s.mux.HandleFunc("GET /findings", s.listFindings)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// page is one slice of a listing along with where it sits in the whole
+type page[T any] struct {
+	Items  []T `json:"items"`
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// pageParams reads the page selected by the limit and offset query
+// parameters, which the repositories then read from the database
+func pageParams(r *http.Request) (models.Page, error) {
+	limit, err := intParam(r, "limit", defaultLimit)
+	if err != nil {
+		return models.Page{}, err
+	}
+	if limit < 1 || limit > maxLimit {
+		return models.Page{}, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+	}
+	offset, err := intParam(r, "offset", 0)
+	if err != nil {
+		return models.Page{}, err
+	}
+	if offset < 0 {
+		return models.Page{}, fmt.Errorf("offset cannot be negative")
+	}
+	return models.Page{Limit: limit, Offset: offset}, nil
+}
+
+// intParam reads an integer query parameter, or def when it is absent
+func intParam(r *http.Request, name string, def int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer", name)
+	}
+	return n, nil
+}
+
+// pathID reads the numeric {id} of the request path
+func pathID(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid id %q", r.PathValue("id"))
+	}
+	return id, nil
+}
+
+// writeJSON sends v with the given status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("⚠️ Error writing response: %v\n", err)
+	}
+}
+
+// writeError sends an error as {"error": "..."}
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// writeLookupError reports a failed lookup as 404 when the row does not
+// exist and 500 otherwise
+func writeLookupError(w http.ResponseWriter, what string, id int, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s %d not found", what, id))
+		return
+	}
+	log.Printf("⚠️ Error reading %s %d: %v\n", what, id, err)
+	writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to read %s", what))
+}
+
+// writePage sends the items of a page out of total
+func writePage[T any](w http.ResponseWriter, p models.Page, items []T, total int) {
+	if items == nil {
+		items = []T{}
+	}
+	writeJSON(w, http.StatusOK, &page[T]{Items: items, Total: total, Limit: p.Limit, Offset: p.Offset})
+}
+
+// listPrograms serves GET /programs
+func (s *Server) listPrograms(w http.ResponseWriter, r *http.Request) {
+	p, err := pageParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	programs, total, err := s.programs.ListPage(p)
+	if err != nil {
+		log.Printf("⚠️ Error listing programs: %v\n", err)
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to list programs"))
+		return
+	}
+	writePage(w, p, programs, total)
+}
+
+// getProgram serves GET /programs/{id}
+func (s *Server) getProgram(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	program, err := s.programs.GetByID(id)
+	if err != nil {
+		writeLookupError(w, "program", id, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, program)
+}
+
+// listTargets serves GET /programs/{id}/targets, filtered by the q (a glob
+// such as *.api.example.com), type and alive query parameters
+func (s *Server) listTargets(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if _, err := s.programs.GetByID(id); err != nil {
+		writeLookupError(w, "program", id, err)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := models.SearchOptions{ProgramID: id, Type: models.TargetType(query.Get("type"))}
+	if alive := query.Get("alive"); alive != "" {
+		if opts.AliveOnly, err = strconv.ParseBool(alive); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("alive must be true or false"))
+			return
+		}
+	}
+	p, err := pageParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	targets, total, err := s.targets.SearchPage(query.Get("q"), opts, p)
+	if err != nil {
+		log.Printf("⚠️ Error listing targets of program %d: %v\n", id, err)
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to list targets"))
+		return
+	}
+	writePage(w, p, targets, total)
+}
+
+// getTarget serves GET /targets/{id}
+func (s *Server) getTarget(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	target, err := s.targets.GetByID(id)
+	if err != nil {
+		writeLookupError(w, "target", id, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, target)
+}
+
+// listRecon serves GET /targets/{id}/recon, newest first, optionally
+// narrowed to one tool
+func (s *Server) listRecon(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if _, err := s.targets.GetByID(id); err != nil {
+		writeLookupError(w, "target", id, err)
+		return
+	}
+
+	p, err := pageParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	data, total, err := s.recon.ListByTarget(id, r.URL.Query().Get("tool"), p)
+	if err != nil {
+		log.Printf("⚠️ Error listing recon data of target %d: %v\n", id, err)
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to list recon data"))
+		return
+	}
+	writePage(w, p, data, total)
+}
+
+// listFindings serves GET /findings, filtered by the program, severity and
+// status query parameters
+func (s *Server) listFindings(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.FindingFilter{ProgramName: query.Get("program")}
+	var err error
+	if severity := query.Get("severity"); severity != "" {
+		if filter.Severity, err = models.ParseSeverity(severity); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if status := query.Get("status"); status != "" {
+		if filter.Status, err = models.ParseStatus(status); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	p, err := pageParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	findings, total, err := s.findings.ListPage(filter, p)
+	if err != nil {
+		log.Printf("⚠️ Error listing findings: %v\n", err)
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to list findings"))
+		return
+	}
+	writePage(w, p, findings, total)
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"ferri/database"
+	"ferri/utils"
+)
+
+// newTestServer serves a database holding program 1 with 150 subdomains,
+// every third one alive, plus its root domain; target 1 has recon data from
+// two tools and five findings
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	status := utils.Status
+	utils.Status = io.Discard
+	t.Cleanup(func() { utils.Status = status })
+
+	path := filepath.Join(t.TempDir(), "bounty.db")
+	if err := database.EnsureDBExists(path); err != nil {
+		t.Fatal(err)
+	}
+	db, err := database.InitDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	stmts := []string{
+		"INSERT INTO programs (name) VALUES ('example'), ('other')",
+		`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 150)
+			INSERT INTO targets (program_id, target, type, alive) SELECT 1, printf('h%03d.example.com', i), 'subdomain', i % 3 = 0 FROM n`,
+		"INSERT INTO targets (program_id, target, type) VALUES (1, 'example.com', 'domain')",
+		`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 7)
+			INSERT INTO recon_data (target_id, tool, data) SELECT 1, CASE WHEN i <= 4 THEN 'httpx' ELSE 'subfinder' END, 'line ' || i FROM n`,
+		`INSERT INTO findings (target_id, title, severity, status) VALUES
+			(1, 'a', 'high', 'Open'), (1, 'b', 'high', 'Open'), (1, 'c', 'high', 'Triaged'), (1, 'd', 'low', 'Open'), (1, 'e', 'critical', 'Open')`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	srv := httptest.NewServer(New(db))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestListEndpoints(t *testing.T) {
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantTotal  int
+		wantItems  int
+		// wantFirst is a field of the first item, "" for none to check
+		wantFirst string
+	}{
+		{"/programs", 200, 2, 2, "example"},
+		{"/programs?limit=1&offset=1", 200, 2, 1, "other"},
+		{"/programs/1/targets", 200, 151, 100, "example.com"},
+		{"/programs/1/targets?limit=10&offset=145", 200, 151, 6, "h145.example.com"},
+		{"/programs/1/targets?offset=500", 200, 151, 0, ""},
+		{"/programs/1/targets?type=subdomain&limit=5", 200, 150, 5, "h001.example.com"},
+		{"/programs/1/targets?alive=true&limit=1000", 200, 50, 50, "h003.example.com"},
+		{"/programs/1/targets?q=h14*&alive=true", 200, 3, 3, "h141.example.com"},
+		{"/programs/2/targets", 200, 0, 0, ""},
+		{"/targets/1/recon", 200, 7, 7, ""},
+		{"/targets/1/recon?tool=httpx&limit=3", 200, 4, 3, "httpx"},
+		{"/findings", 200, 5, 5, "e"},
+		{"/findings?severity=high&limit=2&offset=2", 200, 3, 1, ""},
+		{"/findings?status=triaged", 200, 1, 1, "c"},
+		{"/programs?limit=0", 400, 0, 0, ""},
+		{"/programs?limit=1001", 400, 0, 0, ""},
+		{"/findings?offset=-1", 400, 0, 0, ""},
+		{"/programs/9/targets", 404, 0, 0, ""},
+	}
+	srv := newTestServer(t)
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var got struct {
+				Items []map[string]any `json:"items"`
+				Total int              `json:"total"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Total != tt.wantTotal || len(got.Items) != tt.wantItems {
+				t.Errorf("%d items of %d, want %d of %d", len(got.Items), got.Total, tt.wantItems, tt.wantTotal)
+			}
+			if tt.wantFirst == "" || len(got.Items) == 0 {
+				return
+			}
+			first := got.Items[0]
+			for _, key := range []string{"name", "title", "tool", "target"} {
+				if v, ok := first[key]; ok {
+					if fmt.Sprint(v) != tt.wantFirst {
+						t.Errorf("first item has %s %v, want %s", key, v, tt.wantFirst)
+					}
+					return
+				}
+			}
+			t.Errorf("first item %v has no field to compare", first)
+		})
+	}
+}
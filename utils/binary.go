@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"bufio"
+	"io"
+	"unicode/utf8"
+)
+
+// sniffSize is how much of an input LooksBinary inspects
+const sniffSize = 8192
+
+// LooksBinary peeks at the start of r and reports whether it looks like
+// binary data, such as a pcap or an image, rather than tool output: it
+// holds a NUL byte, or more than a tenth of it is invalid UTF-8 or control
+// characters other than whitespace and ANSI escapes. Only the first read is
+// inspected, so a tool streaming its output slowly is not held up until
+// sniffSize bytes arrive. The returned reader still yields the whole input.
+func LooksBinary(r io.Reader) (io.Reader, bool) {
+	br := bufio.NewReaderSize(r, sniffSize)
+	br.Peek(1)
+	head, _ := br.Peek(br.Buffered())
+	if len(head) == 0 {
+		return br, false
+	}
+
+	suspicious := 0
+	for i := 0; i < len(head); {
+		c, size := utf8.DecodeRune(head[i:])
+		switch {
+		case c == 0:
+			return br, true
+		case c == utf8.RuneError && size == 1:
+			// A multi-byte rune cut off by the end of the sample is fine
+			if len(head)-i >= utf8.UTFMax {
+				suspicious++
+			}
+		case c < 0x20 && c != '\n' && c != '\r' && c != '\t' && c != 0x1b:
+			suspicious++
+		}
+		i += size
+	}
+	return br, suspicious*10 > len(head)
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowReader hands out first, then blocks until the test ends, like a tool
+// that prints a few lines and keeps working
+type slowReader struct {
+	first []byte
+	done  chan struct{}
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if len(r.first) > 0 {
+		n := copy(p, r.first)
+		r.first = r.first[n:]
+		return n, nil
+	}
+	<-r.done
+	return 0, io.EOF
+}
+
+func TestLooksBinaryDoesNotWaitForMoreInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		first string
+		want  bool
+	}{
+		{"tool output", "a.example.com\nb.example.com\n", false},
+		{"ANSI colours", "\x1b[32ma.example.com\x1b[0m\n", false},
+		{"NUL byte", "\xd4\xc3\xb2\xa1\x02\x00\x04\x00", true},
+		{"control characters", "\x01\x02\x03\x04\x05abc", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &slowReader{first: []byte(tt.first), done: make(chan struct{})}
+			defer close(r.done)
+
+			type sniffed struct {
+				r      io.Reader
+				binary bool
+			}
+			result := make(chan sniffed, 1)
+			go func() {
+				br, binary := LooksBinary(r)
+				result <- sniffed{br, binary}
+			}()
+
+			select {
+			case got := <-result:
+				if got.binary != tt.want {
+					t.Errorf("LooksBinary = %v, want %v", got.binary, tt.want)
+				}
+				buf := make([]byte, len(tt.first))
+				if _, err := io.ReadFull(got.r, buf); err != nil || string(buf) != tt.first {
+					t.Errorf("reader yielded %q, %v; want %q", buf, err, tt.first)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("LooksBinary waited for more input than the first read")
+			}
+		})
+	}
+}
+
+func TestLooksBinaryEmptyInput(t *testing.T) {
+	r, binary := LooksBinary(strings.NewReader(""))
+	if binary {
+		t.Error("empty input looks binary")
+	}
+	if n, err := r.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("Read = %d, %v; want EOF", n, err)
+	}
+}
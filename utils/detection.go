@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"path/filepath"
 	"regexp"
+	"strings"
 )
 
 // Tool patterns for auto-detection
@@ -11,6 +13,7 @@ var toolPatterns = map[string]*regexp.Regexp{
 	"assetfinder": regexp.MustCompile(`assetfinder`),
 	"httpx":       regexp.MustCompile(`httpx|http`),
 	"nuclei":      regexp.MustCompile(`nuclei`),
+	"dnsx":        regexp.MustCompile(`dnsx`),
 	"waybackurls": regexp.MustCompile(`wayback|archive`),
 	"gau":         regexp.MustCompile(`gau`),
 	"ffuf":        regexp.MustCompile(`ffuf|fuzz`),
@@ -22,3 +25,21 @@ func DetectTool() string {
 	// Simple detection based on common patterns
 	return "pipeline_auto"
 }
+
+// DetectToolFromName guesses the tool that produced a file from its name,
+// e.g. "httpx-live.txt". When several patterns match, the one matching
+// earliest in the name wins. It returns "" when nothing matches.
+func DetectToolFromName(name string) string {
+	base := strings.ToLower(filepath.Base(name))
+	best, bestAt := "", -1
+	for tool, re := range toolPatterns {
+		loc := re.FindStringIndex(base)
+		if loc == nil {
+			continue
+		}
+		if bestAt == -1 || loc[0] < bestAt || (loc[0] == bestAt && tool < best) {
+			best, bestAt = tool, loc[0]
+		}
+	}
+	return best
+}
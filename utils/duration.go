@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// durationUnits are the calendar-ish units ParseDuration accepts on top of
+// time.ParseDuration; months and years are approximated as 30 and 365 days
+var durationUnits = []struct {
+	suffix string
+	unit   time.Duration
+}{
+	{"mo", 30 * 24 * time.Hour},
+	{"y", 365 * 24 * time.Hour},
+	{"w", 7 * 24 * time.Hour},
+	{"d", 24 * time.Hour},
+}
+
+// ParseDuration parses human durations such as "90d", "6mo", "2w" or "1y",
+// falling back to time.ParseDuration for "12h" or "30m". The duration must
+// be positive, so "0d" or "-1h" are errors rather than ages of now.
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	for _, u := range durationUnits {
+		if !strings.HasSuffix(s, u.suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(s, u.suffix))
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * u.unit, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q (use e.g. 12h, 30d, 6mo)", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"90d", 90 * day, false},
+		{"2w", 14 * day, false},
+		{"6mo", 180 * day, false},
+		{"1y", 365 * day, false},
+		{" 1Y ", 365 * day, false},
+		{"12h", 12 * time.Hour, false},
+		{"30m", 30 * time.Minute, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"0", 0, true},
+		{"0d", 0, true},
+		{"0mo", 0, true},
+		{"0s", 0, true},
+		{"-1d", 0, true},
+		{"-1h", 0, true},
+		{"d", 0, true},
+		{"1.5d", 0, true},
+		{"soon", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseDuration(%q) = %v, %v; want %v, error %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
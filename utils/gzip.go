@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+)
+
+// MaybeGzipReader returns a reader that decompresses r when it starts with
+// the gzip magic bytes and passes it through unchanged otherwise
+func MaybeGzipReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil {
+		// Shorter than the magic bytes (e.g. empty input) cannot be gzip
+		return br, nil
+	}
+	if magic[0] != 0x1f || magic[1] != 0x8b {
+		return br, nil
+	}
+	return gzip.NewReader(br)
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// cidrSuffix matches the prefix length of a CIDR range such as 10.0.0.0/24
+var cidrSuffix = regexp.MustCompile(`^/\d{1,3}$`)
+
+// SplitSchemelessURL splits a URL written without its scheme, such as
+// example.com/admin or sub.example.com/a/b?x=1, into the host (with any
+// port) and the path and query. ok is false unless the part before the
+// first / or ? is a domain or IP; CIDR ranges are not URLs.
+func SplitSchemelessURL(s string) (host, rest string, ok bool) {
+	i := strings.IndexAny(s, "/?")
+	if i <= 0 || strings.Contains(s, "://") {
+		return "", "", false
+	}
+	host, rest = s[:i], s[i:]
+	bare, _ := SplitPort(host)
+	switch ClassifyHost(bare) {
+	case "unknown":
+		return "", "", false
+	case "ip":
+		if cidrSuffix.MatchString(rest) {
+			return "", "", false
+		}
+	}
+	return host, rest, true
+}
+
+// TargetHost returns the bare host of a target as processors.ClassifyTarget
+// reads it: the host of a URL, written with or without its scheme, or else
+// the target without its port
+func TargetHost(target string) string {
+	if host, _, ok := SplitSchemelessURL(target); ok {
+		target = host
+	} else if u, err := url.Parse(target); err == nil && u.Host != "" && strings.Contains(target, "://") {
+		return u.Hostname()
+	}
+	host, _ := SplitPort(target)
+	return host
+}
+
+// SplitPort separates a trailing :port from a bare host, unwrapping
+// bracketed IPv6 literals like [::1]:8080. Values without a valid port,
+// including unbracketed IPv6 addresses, are returned unchanged.
+func SplitPort(target string) (string, int) {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return target, 0
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return target, 0
+	}
+	return host, port
+}
+
+// ClassifyHost determines the type of a target that is not a URL
+func ClassifyHost(host string) string {
+	switch {
+	case net.ParseIP(host) != nil:
+		return "ip"
+	case strings.ContainsAny(host, "/:"):
+		return "unknown"
+	case strings.Count(host, ".") == 1:
+		return "domain"
+	case strings.Count(host, ".") > 1:
+		return "subdomain"
+	}
+	return "unknown"
+}
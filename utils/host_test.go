@@ -0,0 +1,26 @@
+package utils
+
+import "testing"
+
+func TestTargetHost(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"example.com", "example.com"},
+		{"example.com:8443", "example.com"},
+		{"example.com/admin", "example.com"},
+		{"example.com:8443/admin?x=1", "example.com"},
+		{"https://example.com/admin", "example.com"},
+		{"https://[2001:db8::1]:8443/", "2001:db8::1"},
+		{"[2001:db8::1]:8080", "2001:db8::1"},
+		{"2001:db8::1", "2001:db8::1"},
+		{"192.0.2.1/login", "192.0.2.1"},
+		{"192.0.2.0/24", "192.0.2.0/24"},
+	}
+	for _, tt := range tests {
+		if got := TargetHost(tt.target); got != tt.want {
+			t.Errorf("TargetHost(%q) = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Status is where ferri writes its human-readable progress messages. It
+// defaults to stderr so stdout only ever carries data for the next tool.
+var Status io.Writer = os.Stderr
+
+// Statusf writes a formatted progress message to Status
+func Statusf(format string, args ...any) {
+	fmt.Fprintf(Status, format, args...)
+}
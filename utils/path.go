@@ -2,18 +2,36 @@ package utils
 
 import (
 	"os"
+	"os/user"
 	"path/filepath"
 	"strings"
 )
 
-// ExpandPath expands ~ to home directory
+// ExpandPath expands a leading ~ to the home directory and ~user to that
+// user's home directory, as a shell would. Paths whose home cannot be
+// found are returned unchanged.
 func ExpandPath(path string) string {
-	if strings.HasPrefix(path, "~/") {
-		home, err := os.UserHomeDir()
+	if !strings.HasPrefix(path, "~") {
+		return path
+	}
+	name, rest := path[1:], ""
+	if i := strings.IndexFunc(name, func(r rune) bool { return r < 128 && os.IsPathSeparator(uint8(r)) }); i >= 0 {
+		name, rest = name[:i], name[i+1:]
+	}
+
+	var home string
+	if name == "" {
+		dir, err := os.UserHomeDir()
 		if err != nil {
 			return path // fallback to original if error
 		}
-		return filepath.Join(home, path[2:])
+		home = dir
+	} else {
+		u, err := user.Lookup(name)
+		if err != nil || u.HomeDir == "" {
+			return path // no such user, or no home to expand to
+		}
+		home = u.HomeDir
 	}
-	return path
+	return filepath.Join(home, rest)
 }
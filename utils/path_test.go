@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"os/user"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	root, err := user.Lookup("root")
+	if err != nil {
+		t.Skipf("no root user to expand ~root: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"~", home},
+		{"~/", home},
+		{"~/x", filepath.Join(home, "x")},
+		{"~/x/y.db", filepath.Join(home, "x", "y.db")},
+		{"~root/x", filepath.Join(root.HomeDir, "x")},
+		{"~root", root.HomeDir},
+		{"~no-such-user-ferri/x", "~no-such-user-ferri/x"},
+		{"/var/lib/ferri.db", "/var/lib/ferri.db"},
+		{"data/~/x", "data/~/x"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ExpandPath(tt.path); got != tt.want {
+			t.Errorf("ExpandPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
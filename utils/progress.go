@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// progressEvery is how many steps may pass between progress updates
+const progressEvery = 1000
+
+// Progress prints a throttled processed/total line with a rough rate. On a
+// terminal the line is redrawn in place, otherwise plain lines are written.
+// A total of zero means the total is not known in advance.
+type Progress struct {
+	out     io.Writer
+	total   int
+	done    int
+	shown   int
+	inPlace bool
+	started time.Time
+	last    time.Time
+}
+
+// NewProgress creates a progress reporter for total steps
+func NewProgress(out io.Writer, total int) *Progress {
+	now := time.Now()
+	return &Progress{
+		out:     out,
+		total:   total,
+		inPlace: IsTerminal(out),
+		started: now,
+		last:    now,
+	}
+}
+
+// Update records that done steps have finished, printing if an update is due
+func (p *Progress) Update(done int) {
+	p.done = done
+	if p.done-p.shown >= progressEvery || time.Since(p.last) >= time.Second {
+		p.print()
+	}
+}
+
+// Finish prints the final state and ends the in-place line
+func (p *Progress) Finish() {
+	if p.shown != p.done {
+		p.print()
+	}
+	if p.inPlace {
+		fmt.Fprintln(p.out)
+	}
+}
+
+func (p *Progress) print() {
+	p.last = time.Now()
+	p.shown = p.done
+	rate := 0.0
+	if elapsed := p.last.Sub(p.started).Seconds(); elapsed > 0 {
+		rate = float64(p.done) / elapsed
+	}
+
+	line := fmt.Sprintf("⏳ %d/%d (%.0f/s)", p.done, p.total, rate)
+	if p.total == 0 {
+		line = fmt.Sprintf("⏳ %d processed (%.0f/s)", p.done, rate)
+	}
+	if p.inPlace {
+		fmt.Fprintf(p.out, "\r%s\033[K", line)
+	} else {
+		fmt.Fprintln(p.out, line)
+	}
+}
+
+// IsTerminal reports whether w is an interactive terminal
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return (stat.Mode() & os.ModeCharDevice) != 0
+}
@@ -1,9 +1,30 @@
 package utils
 
-import "os"
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
 
 // HasStdinData checks if there's data available on stdin
 func HasStdinData() bool {
 	stat, _ := os.Stdin.Stat()
 	return (stat.Mode() & os.ModeCharDevice) == 0
 }
+
+// Confirm asks a yes/no question on the status output and reads the answer
+// from stdin. It returns false without asking when stdin is not a terminal.
+func Confirm(question string) bool {
+	if HasStdinData() {
+		return false
+	}
+	fmt.Fprintf(Status, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		// No answer (e.g. stdin is /dev/null); end the prompt line
+		fmt.Fprintln(Status)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}